@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS device_album_mappings;
+DROP TABLE IF EXISTS device_image_mappings;
+ALTER TABLE images DROP COLUMN album_id;
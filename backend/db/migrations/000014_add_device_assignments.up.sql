@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS device_image_mappings (
+    device_id INTEGER,
+    image_id INTEGER,
+    PRIMARY KEY (device_id, image_id)
+);
+CREATE INDEX IF NOT EXISTS idx_device_image_mappings_image_id ON device_image_mappings(image_id);
+
+CREATE TABLE IF NOT EXISTS device_album_mappings (
+    device_id INTEGER,
+    source TEXT,
+    album_id TEXT,
+    PRIMARY KEY (device_id, source, album_id)
+);
+
+ALTER TABLE images ADD COLUMN album_id TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS shuffle_entries;
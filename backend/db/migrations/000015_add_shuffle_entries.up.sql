@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS shuffle_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id INTEGER NOT NULL,
+    pool TEXT NOT NULL,
+    image_id INTEGER NOT NULL,
+    sort_key REAL NOT NULL,
+    played BOOLEAN NOT NULL DEFAULT 0,
+    played_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_shuffle_entries_device_pool ON shuffle_entries(device_id, pool);
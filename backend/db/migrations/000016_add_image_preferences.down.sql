@@ -0,0 +1,3 @@
+ALTER TABLE devices DROP COLUMN selection_strategy;
+ALTER TABLE images DROP COLUMN rating;
+ALTER TABLE images DROP COLUMN favorite;
@@ -0,0 +1,3 @@
+ALTER TABLE images ADD COLUMN favorite BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN rating INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN selection_strategy TEXT NOT NULL DEFAULT 'uniform';
@@ -0,0 +1,2 @@
+ALTER TABLE devices DROP COLUMN timezone;
+DROP TABLE IF EXISTS device_schedules;
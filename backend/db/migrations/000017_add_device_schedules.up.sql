@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS device_schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    device_id INTEGER NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    days INTEGER NOT NULL DEFAULT 0,
+    start_minute INTEGER NOT NULL DEFAULT 0,
+    end_minute INTEGER NOT NULL DEFAULT 0,
+    source TEXT NOT NULL,
+    album_id TEXT NOT NULL DEFAULT '',
+    layout TEXT NOT NULL DEFAULT '',
+    priority INTEGER NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    created_at DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_device_schedules_device_id ON device_schedules(device_id);
+
+ALTER TABLE devices ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
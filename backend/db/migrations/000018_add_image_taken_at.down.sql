@@ -0,0 +1,3 @@
+ALTER TABLE devices DROP COLUMN memories_window_days;
+DROP INDEX IF EXISTS idx_images_taken_at;
+ALTER TABLE images DROP COLUMN taken_at;
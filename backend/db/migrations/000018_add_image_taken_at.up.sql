@@ -0,0 +1,4 @@
+ALTER TABLE images ADD COLUMN taken_at DATETIME;
+CREATE INDEX IF NOT EXISTS idx_images_taken_at ON images(taken_at);
+
+ALTER TABLE devices ADD COLUMN memories_window_days INTEGER NOT NULL DEFAULT 7;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS device_source_weights (
+    device_id INTEGER,
+    source TEXT,
+    weight INTEGER NOT NULL DEFAULT 1,
+    PRIMARY KEY (device_id, source)
+);
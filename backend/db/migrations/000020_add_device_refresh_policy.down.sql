@@ -0,0 +1,5 @@
+ALTER TABLE devices DROP COLUMN event_wake_delay_minutes;
+ALTER TABLE devices DROP COLUMN wake_for_events;
+ALTER TABLE devices DROP COLUMN quiet_end_minute;
+ALTER TABLE devices DROP COLUMN quiet_start_minute;
+ALTER TABLE devices DROP COLUMN refresh_interval_minutes;
@@ -0,0 +1,5 @@
+ALTER TABLE devices ADD COLUMN refresh_interval_minutes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN quiet_start_minute INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN quiet_end_minute INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN wake_for_events BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN event_wake_delay_minutes INTEGER NOT NULL DEFAULT 2;
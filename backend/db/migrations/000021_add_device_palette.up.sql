@@ -0,0 +1 @@
+ALTER TABLE devices ADD COLUMN palette TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE devices ADD COLUMN frame_format TEXT NOT NULL DEFAULT '';
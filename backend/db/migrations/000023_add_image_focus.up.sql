@@ -0,0 +1,2 @@
+ALTER TABLE images ADD COLUMN focus_x REAL;
+ALTER TABLE images ADD COLUMN focus_y REAL;
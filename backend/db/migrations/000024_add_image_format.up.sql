@@ -0,0 +1 @@
+ALTER TABLE images ADD COLUMN format TEXT NOT NULL DEFAULT '';
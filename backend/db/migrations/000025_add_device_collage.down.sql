@@ -0,0 +1,3 @@
+ALTER TABLE devices DROP COLUMN collage_background;
+ALTER TABLE devices DROP COLUMN collage_gutter;
+ALTER TABLE devices DROP COLUMN collage_layout;
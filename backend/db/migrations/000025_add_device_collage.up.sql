@@ -0,0 +1,3 @@
+ALTER TABLE devices ADD COLUMN collage_layout TEXT NOT NULL DEFAULT '';
+ALTER TABLE devices ADD COLUMN collage_gutter INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE devices ADD COLUMN collage_background TEXT NOT NULL DEFAULT '';
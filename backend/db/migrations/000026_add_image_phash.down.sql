@@ -0,0 +1,2 @@
+ALTER TABLE images DROP COLUMN duplicate_of;
+ALTER TABLE images DROP COLUMN phash;
@@ -0,0 +1,2 @@
+ALTER TABLE images ADD COLUMN phash TEXT NOT NULL DEFAULT '';
+ALTER TABLE images ADD COLUMN duplicate_of INTEGER;
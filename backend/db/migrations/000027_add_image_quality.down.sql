@@ -0,0 +1,6 @@
+ALTER TABLE images DROP COLUMN quality_issues;
+ALTER TABLE images DROP COLUMN screenshot;
+ALTER TABLE images DROP COLUMN colorfulness;
+ALTER TABLE images DROP COLUMN exposure;
+ALTER TABLE images DROP COLUMN sharpness;
+ALTER TABLE images DROP COLUMN quality_score;
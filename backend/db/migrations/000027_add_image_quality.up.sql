@@ -0,0 +1,6 @@
+ALTER TABLE images ADD COLUMN quality_score REAL;
+ALTER TABLE images ADD COLUMN sharpness REAL NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN exposure REAL NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN colorfulness REAL NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN screenshot BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE images ADD COLUMN quality_issues TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE images DROP COLUMN crop_portrait;
+ALTER TABLE images DROP COLUMN crop_landscape;
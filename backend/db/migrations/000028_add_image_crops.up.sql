@@ -0,0 +1,2 @@
+ALTER TABLE images ADD COLUMN crop_landscape TEXT;
+ALTER TABLE images ADD COLUMN crop_portrait TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE devices DROP COLUMN layout_template_id;
+DROP TABLE IF EXISTS layout_templates;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS layout_templates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL DEFAULT '',
+    html TEXT NOT NULL DEFAULT '',
+    fields TEXT,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+ALTER TABLE devices ADD COLUMN layout_template_id INTEGER;
@@ -0,0 +1 @@
+ALTER TABLE devices ADD COLUMN renderer TEXT DEFAULT '';
@@ -0,0 +1,3 @@
+ALTER TABLE images ADD COLUMN focus_source TEXT DEFAULT '';
+-- Crop windows are only ever set by hand, along with the focus
+UPDATE images SET focus_source = 'manual' WHERE focus_x IS NOT NULL AND (crop_landscape IS NOT NULL OR crop_portrait IS NOT NULL);
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type AssignmentHandler struct {
+	assignments *service.AssignmentService
+	db          *gorm.DB
+}
+
+func NewAssignmentHandler(assignments *service.AssignmentService, db *gorm.DB) *AssignmentHandler {
+	return &AssignmentHandler{assignments: assignments, db: db}
+}
+
+type AssignPhotosRequest struct {
+	ImageIDs []uint `json:"image_ids"`
+}
+
+type AssignAlbumRequest struct {
+	Source  string `json:"source"`
+	AlbumID string `json:"album_id"`
+}
+
+// findDevice resolves the :id route parameter to an existing device.
+func (h *AssignmentHandler) findDevice(c echo.Context) (*model.Device, error) {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// GET /api/devices/:id/assignments
+func (h *AssignmentHandler) GetAssignments(c echo.Context) error {
+	device, err := h.findDevice(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	assignments, err := h.assignments.GetAssignments(device.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, assignments)
+}
+
+// POST /api/devices/:id/assignments/photos
+func (h *AssignmentHandler) AssignPhotos(c echo.Context) error {
+	device, err := h.findDevice(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	var req AssignPhotosRequest
+	if err := c.Bind(&req); err != nil || len(req.ImageIDs) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "image_ids required"})
+	}
+
+	// Only assign photos that actually exist
+	var imageIDs []uint
+	if err := h.db.Model(&model.Image{}).Where("id IN ?", req.ImageIDs).Pluck("id", &imageIDs).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if err := h.assignments.AssignPhotos(device.ID, imageIDs); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"status": "assigned", "count": len(imageIDs)})
+}
+
+// DELETE /api/devices/:id/assignments/photos
+func (h *AssignmentHandler) UnassignPhotos(c echo.Context) error {
+	device, err := h.findDevice(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	var req AssignPhotosRequest
+	if err := c.Bind(&req); err != nil || len(req.ImageIDs) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "image_ids required"})
+	}
+	if err := h.assignments.UnassignPhotos(device.ID, req.ImageIDs); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "unassigned"})
+}
+
+// POST /api/devices/:id/assignments/albums
+func (h *AssignmentHandler) AssignAlbum(c echo.Context) error {
+	device, err := h.findDevice(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	var req AssignAlbumRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := h.assignments.AssignAlbum(device.ID, req.Source, req.AlbumID); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "assigned"})
+}
+
+// DELETE /api/devices/:id/assignments/albums
+func (h *AssignmentHandler) UnassignAlbum(c echo.Context) error {
+	device, err := h.findDevice(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	var req AssignAlbumRequest
+	if err := c.Bind(&req); err != nil || req.Source == "" || req.AlbumID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "source and album_id required"})
+	}
+	if err := h.assignments.UnassignAlbum(device.ID, req.Source, req.AlbumID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "unassigned"})
+}
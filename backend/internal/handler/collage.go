@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type CollageHandler struct {
+	deviceService *service.DeviceService
+	db            *gorm.DB
+}
+
+func NewCollageHandler(deviceService *service.DeviceService, db *gorm.DB) *CollageHandler {
+	return &CollageHandler{deviceService: deviceService, db: db}
+}
+
+// GET /api/devices/:id/collage
+func (h *CollageHandler) GetCollage(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	return c.JSON(http.StatusOK, service.DeviceCollage(&device))
+}
+
+// PUT /api/devices/:id/collage
+// e.g. {"layout": "mosaic", "gutter": 8, "background": "#000000"}
+// Collages are switched on and off with the device's enable_collage.
+func (h *CollageHandler) UpdateCollage(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	var req service.CollageSettings
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := h.deviceService.SetCollage(&device, req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, service.DeviceCollage(&device))
+}
@@ -81,6 +81,12 @@ func (h *DeviceHandler) ConfigureDeviceSource(c echo.Context) error {
 		imageURL = fmt.Sprintf("http://%s/image/ai_generation", host)
 	case model.SourceImmich:
 		imageURL = fmt.Sprintf("http://%s/image/immich", host)
+	case model.SourceSchedule:
+		imageURL = fmt.Sprintf("http://%s/image/schedule", host)
+	case model.SourceMix:
+		imageURL = fmt.Sprintf("http://%s/image/mix", host)
+	case model.SourceDashboard:
+		imageURL = fmt.Sprintf("http://%s/image/dashboard", host)
 	case model.SourceTelegram: // Added telegram source
 		imageURL = fmt.Sprintf("http://%s/image/telegram", host)
 		// Update Telegram Settings (Append if not exists)
@@ -172,6 +178,10 @@ func (h *DeviceHandler) AddDevice(c echo.Context) error {
 		ShowCalendar       bool    `json:"show_calendar"`
 		CalendarID         string  `json:"calendar_id"`
 		DateFormat         string  `json:"date_format"`
+		SelectionStrategy  string  `json:"selection_strategy"`
+		Timezone           string  `json:"timezone"`
+		MemoriesWindowDays int     `json:"memories_window_days"`
+		FrameFormat        string  `json:"frame_format"`
 	}
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
@@ -185,7 +195,7 @@ func (h *DeviceHandler) AddDevice(c echo.Context) error {
 		req.Layout = model.LayoutPhotoOverlay
 	}
 
-	device, err := h.deviceService.AddDevice(req.Host, req.UseDeviceParameter, req.EnableCollage, req.ShowDate, req.ShowWeather, req.WeatherLat, req.WeatherLon, req.Layout, req.DisplayMode, req.ShowCalendar, req.CalendarID, req.DateFormat)
+	device, err := h.deviceService.AddDevice(req.Host, req.UseDeviceParameter, req.EnableCollage, req.ShowDate, req.ShowWeather, req.WeatherLat, req.WeatherLon, req.Layout, req.DisplayMode, req.ShowCalendar, req.CalendarID, req.DateFormat, req.SelectionStrategy, req.Timezone, req.MemoriesWindowDays, req.FrameFormat)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -215,6 +225,10 @@ func (h *DeviceHandler) UpdateDevice(c echo.Context) error {
 		ShowCalendar       bool    `json:"show_calendar"`
 		CalendarID         string  `json:"calendar_id"`
 		DateFormat         string  `json:"date_format"`
+		SelectionStrategy  *string `json:"selection_strategy"`   // nil = unchanged
+		Timezone           *string `json:"timezone"`             // nil = unchanged, empty = server local time
+		MemoriesWindowDays *int    `json:"memories_window_days"` // nil = unchanged
+		FrameFormat        *string `json:"frame_format"`         // nil = unchanged
 	}
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
@@ -224,7 +238,7 @@ func (h *DeviceHandler) UpdateDevice(c echo.Context) error {
 		req.Layout = model.LayoutPhotoOverlay
 	}
 
-	device, err := h.deviceService.UpdateDevice(uint(id), req.Name, req.Host, req.Width, req.Height, req.Orientation, req.UseDeviceParameter, req.EnableCollage, req.ShowDate, req.ShowWeather, req.WeatherLat, req.WeatherLon, req.AIProvider, req.AIModel, req.AIPrompt, req.Layout, req.DisplayMode, req.ShowCalendar, req.CalendarID, req.DateFormat)
+	device, err := h.deviceService.UpdateDevice(uint(id), req.Name, req.Host, req.Width, req.Height, req.Orientation, req.UseDeviceParameter, req.EnableCollage, req.ShowDate, req.ShowWeather, req.WeatherLat, req.WeatherLon, req.AIProvider, req.AIModel, req.AIPrompt, req.Layout, req.DisplayMode, req.ShowCalendar, req.CalendarID, req.DateFormat, req.SelectionStrategy, req.Timezone, req.MemoriesWindowDays, req.FrameFormat)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestDeviceHandler_UpdateKeepsOmittedSettings(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Device{}))
+	device := &model.Device{
+		Name:               "Kitchen",
+		Host:               "kitchen.local",
+		Width:              800,
+		Height:             480,
+		SelectionStrategy:  model.SelectionRating,
+		MemoriesWindowDays: 30,
+		Timezone:           "Europe/Berlin",
+		FrameFormat:        "4bpp",
+	}
+	require.NoError(t, db.Create(device).Error)
+
+	devices := service.NewDeviceService(service.DeviceServiceDeps{DB: db, Widgets: service.NewWidgetRegistry()})
+	h := NewDeviceHandler(devices, nil, nil, nil, nil, db)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/devices/1", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues("1")
+		require.NoError(t, h.UpdateDevice(c))
+		return rec
+	}
+
+	// The settings page only sends the fields it has always known about
+	rec := put(`{"name":"Kitchen","host":"kitchen.local","width":800,"height":480,"orientation":"landscape","show_date":true}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var saved model.Device
+	require.NoError(t, db.First(&saved, device.ID).Error)
+	assert.True(t, saved.ShowDate)
+	assert.Equal(t, model.SelectionRating, saved.SelectionStrategy)
+	assert.Equal(t, 30, saved.MemoriesWindowDays)
+	assert.Equal(t, "Europe/Berlin", saved.Timezone)
+	assert.Equal(t, "4bpp", saved.FrameFormat)
+
+	rec = put(`{"name":"Kitchen","host":"kitchen.local","width":800,"height":480,"orientation":"landscape","timezone":"Mars/Olympus"}`)
+	assert.NotEqual(t, http.StatusOK, rec.Code)
+	require.NoError(t, db.First(&saved, device.ID).Error)
+	assert.Equal(t, "Europe/Berlin", saved.Timezone)
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	"image/draw"
@@ -9,10 +10,12 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
 	"github.com/labstack/echo/v4"
 	xdraw "golang.org/x/image/draw"
 	"gorm.io/gorm"
@@ -22,14 +25,16 @@ type GalleryHandler struct {
 	db       *gorm.DB
 	synology *service.SynologyService
 	immich   *service.ImmichService
+	analyzer *service.AnalyzerService
 	dataDir  string
 }
 
-func NewGalleryHandler(db *gorm.DB, synology *service.SynologyService, immich *service.ImmichService, dataDir string) *GalleryHandler {
+func NewGalleryHandler(db *gorm.DB, synology *service.SynologyService, immich *service.ImmichService, analyzer *service.AnalyzerService, dataDir string) *GalleryHandler {
 	return &GalleryHandler{
 		db:       db,
 		synology: synology,
 		immich:   immich,
+		analyzer: analyzer,
 		dataDir:  dataDir,
 	}
 }
@@ -56,6 +61,19 @@ func (h *GalleryHandler) ListPhotos(c echo.Context) error {
 	if source != "" {
 		query = query.Where("source = ?", source)
 	}
+	if c.QueryParam("favorite") == "true" {
+		query = query.Where("favorite = ?", true)
+	}
+	if minRating, err := strconv.Atoi(c.QueryParam("min_rating")); err == nil && minRating > 0 {
+		query = query.Where("rating >= ?", minRating)
+	}
+	minScore := h.analyzer.MinQualityScore()
+	switch c.QueryParam("excluded") {
+	case "true":
+		query = query.Where("quality_score < ?", minScore)
+	case "false":
+		query = query.Where("(quality_score IS NULL OR quality_score >= ?)", minScore)
+	}
 
 	var total int64
 	if err := query.Count(&total).Error; err != nil {
@@ -67,39 +85,71 @@ func (h *GalleryHandler) ListPhotos(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list photos"})
 	}
 
-	type PhotoResponse struct {
-		ID           uint      `json:"id"`
-		ThumbnailURL string    `json:"thumbnail_url"`
-		CreatedAt    time.Time `json:"created_at"`
-		Caption      string    `json:"caption"`
-		Width        int       `json:"width"`
-		Height       int       `json:"height"`
-		Orientation  string    `json:"orientation"`
-		Source       string    `json:"source"`
-	}
-
-	var photos []PhotoResponse
+	var photos []photoResponse
 	for _, item := range items {
-		photos = append(photos, PhotoResponse{
-			ID:           item.ID,
-			ThumbnailURL: fmt.Sprintf("api/gallery/thumbnail/%d", item.ID),
-			CreatedAt:    item.CreatedAt,
-			Caption:      item.Caption,
-			Width:        item.Width,
-			Height:       item.Height,
-			Orientation:  item.Orientation,
-			Source:       item.Source,
-		})
+		photos = append(photos, newPhotoResponse(item, minScore))
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"photos": photos,
-		"total":  total,
-		"limit":  limit,
-		"offset": offset,
+		"photos":            photos,
+		"total":             total,
+		"limit":             limit,
+		"offset":            offset,
+		"min_quality_score": minScore,
 	})
 }
 
+type photoResponse struct {
+	ID           uint       `json:"id"`
+	ThumbnailURL string     `json:"thumbnail_url"`
+	CreatedAt    time.Time  `json:"created_at"`
+	TakenAt      *time.Time `json:"taken_at"`
+	Caption      string     `json:"caption"`
+	Width        int        `json:"width"`
+	Height       int        `json:"height"`
+	Orientation  string     `json:"orientation"`
+	Source       string     `json:"source"`
+	Favorite     bool       `json:"favorite"`
+	Rating       int        `json:"rating"`
+	DuplicateOf  *uint      `json:"duplicate_of"`
+	QualityScore *float64   `json:"quality_score"` // nil until analyzed
+	Sharpness    float64    `json:"sharpness"`
+	Exposure     float64    `json:"exposure"`
+	Colorfulness float64    `json:"colorfulness"`
+	Screenshot   bool       `json:"screenshot"`
+	// QualityIssues lists what lowered the score; ExcludedFor is set when
+	// the score is below the cutoff and the photo is left out of rotation.
+	QualityIssues []string `json:"quality_issues"`
+	ExcludedFor   []string `json:"excluded_for"`
+}
+
+func newPhotoResponse(item model.Image, minScore float64) photoResponse {
+	resp := photoResponse{
+		ID:           item.ID,
+		ThumbnailURL: fmt.Sprintf("api/gallery/thumbnail/%d", item.ID),
+		CreatedAt:    item.CreatedAt,
+		TakenAt:      item.TakenAt,
+		Caption:      item.Caption,
+		Width:        item.Width,
+		Height:       item.Height,
+		Orientation:  item.Orientation,
+		Source:       item.Source,
+		Favorite:     item.Favorite,
+		Rating:       item.Rating,
+		DuplicateOf:  item.DuplicateOf,
+		QualityScore: item.QualityScore,
+		Sharpness:    item.Sharpness,
+		Exposure:     item.Exposure,
+		Colorfulness: item.Colorfulness,
+		Screenshot:   item.Screenshot,
+	}
+	if item.QualityIssues != "" {
+		resp.QualityIssues = strings.Split(item.QualityIssues, ",")
+	}
+	resp.ExcludedFor = service.ExclusionReasons(item.QualityScore, item.QualityIssues, minScore)
+	return resp
+}
+
 // GetThumbnail serves the thumbnail for a photo.
 // If it's a local/google photo, it serves/generates from disk.
 // If it's a Synology photo, it proxies from Synology API.
@@ -179,7 +229,7 @@ func (h *GalleryHandler) generateThumbnail(srcPath, destPath string) error {
 	}
 	defer f.Close()
 
-	img, _, err := image.Decode(f)
+	img, _, err := imageops.Decode(f)
 	if err != nil {
 		return err
 	}
@@ -228,6 +278,10 @@ func (h *GalleryHandler) DeletePhoto(c echo.Context) error {
 	if err := h.db.Unscoped().Delete(&item).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to delete from db"})
 	}
+	h.db.Where("image_id = ?", item.ID).Delete(&model.DeviceImageMapping{})
+	h.db.Where("image_id = ?", item.ID).Delete(&model.ShuffleEntry{})
+	// Copies hidden in favor of this one come back
+	h.db.Model(&model.Image{}).Where("duplicate_of = ?", item.ID).Update("duplicate_of", nil)
 
 	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
 }
@@ -247,7 +301,9 @@ func (h *GalleryHandler) DeletePhotos(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to find photos"})
 	}
 
+	var ids []uint
 	for _, item := range items {
+		ids = append(ids, item.ID)
 		if item.Source == model.SourceGooglePhotos {
 			if item.FilePath != "" {
 				os.Remove(item.FilePath)
@@ -267,6 +323,11 @@ func (h *GalleryHandler) DeletePhotos(c echo.Context) error {
 		fmt.Printf("DeletePhotos failed: %v\n", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to delete from db"})
 	}
+	if len(ids) > 0 {
+		h.db.Where("image_id IN ?", ids).Delete(&model.DeviceImageMapping{})
+		h.db.Where("image_id IN ?", ids).Delete(&model.ShuffleEntry{})
+		h.db.Model(&model.Image{}).Where("duplicate_of IN ?", ids).Update("duplicate_of", nil)
+	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"status":  "deleted",
@@ -275,6 +336,180 @@ func (h *GalleryHandler) DeletePhotos(c echo.Context) error {
 	})
 }
 
+type UpdatePreferencesRequest struct {
+	ImageIDs []uint `json:"image_ids"`
+	Favorite *bool  `json:"favorite"`
+	Rating   *int   `json:"rating"`
+}
+
+// UpdatePreferences sets the favorite flag and/or rating of several photos at
+// once. Fields left out of the request are not changed.
+// e.g. PUT /api/gallery/photos/preferences {"image_ids":[1,2],"favorite":true}
+func (h *GalleryHandler) UpdatePreferences(c echo.Context) error {
+	var req UpdatePreferencesRequest
+	if err := c.Bind(&req); err != nil || len(req.ImageIDs) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "image_ids required"})
+	}
+
+	updates := map[string]interface{}{}
+	if req.Favorite != nil {
+		updates["favorite"] = *req.Favorite
+	}
+	if req.Rating != nil {
+		if *req.Rating < 0 || *req.Rating > 5 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "rating must be between 0 and 5"})
+		}
+		updates["rating"] = *req.Rating
+	}
+	if len(updates) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "favorite or rating required"})
+	}
+
+	result := h.db.Model(&model.Image{}).Where("id IN ?", req.ImageIDs).Updates(updates)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update photos"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "updated",
+		"count":  result.RowsAffected,
+	})
+}
+
+// duplicateDistance reads the optional ?distance= override of how many
+// perceptual hash bits near-duplicates may differ in.
+func duplicateDistance(c echo.Context) (int, error) {
+	distanceStr := c.QueryParam("distance")
+	if distanceStr == "" {
+		return service.DuplicateDistance, nil
+	}
+	distance, err := strconv.Atoi(distanceStr)
+	if err != nil || distance < 0 || distance > service.MaxDuplicateDistance {
+		return 0, fmt.Errorf("distance must be between 0 and %d", service.MaxDuplicateDistance)
+	}
+	return distance, nil
+}
+
+// ListDuplicates returns groups of near-identical photos across all sources.
+// Photos hidden in favor of another copy have duplicate_of set.
+// e.g. GET /api/gallery/duplicates?distance=4
+func (h *GalleryHandler) ListDuplicates(c echo.Context) error {
+	distance, err := duplicateDistance(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	groups, err := h.analyzer.DuplicateGroups(distance)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to list duplicates"})
+	}
+	minScore := h.analyzer.MinQualityScore()
+
+	response := make([][]photoResponse, 0, len(groups))
+	for _, group := range groups {
+		photos := make([]photoResponse, 0, len(group))
+		for _, item := range group {
+			photos = append(photos, newPhotoResponse(item, minScore))
+		}
+		response = append(response, photos)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"groups": response,
+		"total":  len(response),
+	})
+}
+
+// KeepDuplicate keeps a photo and hides the other photos of its duplicate
+// group from rotation. They stay in the library, so a later sync doesn't
+// import them again.
+// e.g. POST /api/gallery/duplicates/12/keep
+func (h *GalleryHandler) KeepDuplicate(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid id"})
+	}
+	distance, err := duplicateDistance(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	hidden, err := h.analyzer.KeepDuplicate(uint(id), distance)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "photo has no duplicates"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update duplicates"})
+	}
+
+	hiddenIDs := make([]uint, 0, len(hidden))
+	for _, item := range hidden {
+		hiddenIDs = append(hiddenIDs, item.ID)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status": "kept",
+		"kept":   id,
+		"hidden": hiddenIDs,
+	})
+}
+
+// FramingRequest is how a photo is cropped. Focus is nil when found
+// automatically; crops are nil to use the whole photo.
+type FramingRequest struct {
+	Focus         *imageops.Focus `json:"focus"`
+	CropLandscape *model.Crop     `json:"crop_landscape"`
+	CropPortrait  *model.Crop     `json:"crop_portrait"`
+}
+
+// GetFraming returns the photo's focus point and manual crop windows.
+// e.g. GET /api/gallery/photos/12/framing
+func (h *GalleryHandler) GetFraming(c echo.Context) error {
+	var item model.Image
+	if err := h.db.First(&item, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "photo not found"})
+	}
+
+	resp := FramingRequest{CropLandscape: item.CropLandscape, CropPortrait: item.CropPortrait}
+	if item.FocusX != nil && item.FocusY != nil {
+		resp.Focus = &imageops.Focus{X: *item.FocusX, Y: *item.FocusY}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// UpdateFraming replaces the photo's focus point and manual crop windows, all
+// as fractions of the photo's width and height. A null focus goes back to
+// finding it automatically.
+// e.g. PUT /api/gallery/photos/12/framing
+// {"focus":{"x":0.3,"y":0.25},"crop_landscape":{"x":0,"y":0.1,"w":1,"h":0.6},"crop_portrait":null}
+func (h *GalleryHandler) UpdateFraming(c echo.Context) error {
+	var item model.Image
+	if err := h.db.First(&item, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "photo not found"})
+	}
+
+	var req FramingRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if req.Focus != nil && (req.Focus.X < 0 || req.Focus.X > 1 || req.Focus.Y < 0 || req.Focus.Y > 1) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "focus must be within 0-1"})
+	}
+	for _, crop := range []*model.Crop{req.CropLandscape, req.CropPortrait} {
+		if crop != nil && !imageops.Crop(*crop).Valid() {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "crop must be a non-empty window within 0-1"})
+		}
+	}
+
+	item.FocusX, item.FocusY, item.FocusSource = nil, nil, ""
+	if req.Focus != nil {
+		item.FocusX, item.FocusY, item.FocusSource = &req.Focus.X, &req.Focus.Y, imageops.FocusManual
+	}
+	item.CropLandscape = req.CropLandscape
+	item.CropPortrait = req.CropPortrait
+	if err := h.db.Model(&item).Select("FocusX", "FocusY", "FocusSource", "CropLandscape", "CropPortrait").Updates(&item).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update framing"})
+	}
+	return c.JSON(http.StatusOK, req)
+}
+
 // URL Proxy Handlers
 
 type CreateURLSourceRequest struct {
@@ -15,6 +15,7 @@ import (
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/googlephotos"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
 	"github.com/labstack/echo/v4"
 	xdraw "golang.org/x/image/draw"
 	"gorm.io/gorm"
@@ -230,7 +231,7 @@ func (h *GoogleHandler) GetGooglePhotoThumbnail(c echo.Context) error {
 	}
 	defer f.Close()
 
-	img, _, err := image.Decode(f)
+	img, _, err := imageops.Decode(f)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to decode image: " + err.Error()})
 	}
@@ -1,11 +1,14 @@
 package handler
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
 	"log"
 
 	_ "image/jpeg"
@@ -20,67 +23,280 @@ import (
 
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/epaper"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/gcalendar"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/googlephotos"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/photoframe"
-	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/weather"
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 )
 
 type ImageHandlerDeps struct {
-	Settings       *service.SettingsService
-	Renderer       *service.RendererService
-	Processor      *service.ProcessorService
-	Google         *googlephotos.Client
-	CalendarGoogle *googlephotos.Client
-	Synology       *service.SynologyService
-	Immich         *service.ImmichService
-	AIGen          *service.AIGenerationService
-	Weather        *weather.Client
-	Calendar       *gcalendar.Client
-	DB             *gorm.DB
-	DataDir        string
+	Settings    *service.SettingsService
+	Renderer    *service.RendererService
+	Processor   *service.ProcessorService
+	Google      *googlephotos.Client
+	Synology    *service.SynologyService
+	Immich      *service.ImmichService
+	AIGen       *service.AIGenerationService
+	Assignments *service.AssignmentService
+	Shuffle     *service.ShuffleService
+	Schedules   *service.ScheduleService
+	Mix         *service.MixService
+	Templates   *service.LayoutTemplateService
+	RenderCache *service.RenderCache
+	Refresh     *service.RefreshService
+	Widgets     *service.WidgetRegistry
+	DB          *gorm.DB
+	DataDir     string
 }
 
 type ImageHandler struct {
-	settings       *service.SettingsService
-	renderer       *service.RendererService
-	processor      *service.ProcessorService
-	google         *googlephotos.Client
-	calendarGoogle *googlephotos.Client
-	synology       *service.SynologyService
-	immich         *service.ImmichService
-	aiGen          *service.AIGenerationService
-	weather        *weather.Client
-	calendar       *gcalendar.Client
-	db             *gorm.DB
-	dataDir        string
+	settings    *service.SettingsService
+	renderer    *service.RendererService
+	processor   *service.ProcessorService
+	google      *googlephotos.Client
+	synology    *service.SynologyService
+	immich      *service.ImmichService
+	aiGen       *service.AIGenerationService
+	assignments *service.AssignmentService
+	shuffle     *service.ShuffleService
+	schedules   *service.ScheduleService
+	mix         *service.MixService
+	templates   *service.LayoutTemplateService
+	renderCache *service.RenderCache
+	refresh     *service.RefreshService
+	widgets     *service.WidgetRegistry
+	db          *gorm.DB
+	dataDir     string
+	prerender   *prerenderer
+	preview     bool   // Set on the copies previews pick with
+	shown       []uint // Set on the copies pickPhoto picks with, see drawPhoto
 }
 
 func NewImageHandler(deps ImageHandlerDeps) *ImageHandler {
-	return &ImageHandler{
-		settings:       deps.Settings,
-		renderer:       deps.Renderer,
-		processor:      deps.Processor,
-		google:         deps.Google,
-		calendarGoogle: deps.CalendarGoogle,
-		synology:       deps.Synology,
-		immich:         deps.Immich,
-		aiGen:          deps.AIGen,
-		weather:        deps.Weather,
-		calendar:       deps.Calendar,
-		db:             deps.DB,
-		dataDir:        deps.DataDir,
+	h := &ImageHandler{
+		settings:    deps.Settings,
+		renderer:    deps.Renderer,
+		processor:   deps.Processor,
+		google:      deps.Google,
+		synology:    deps.Synology,
+		immich:      deps.Immich,
+		aiGen:       deps.AIGen,
+		assignments: deps.Assignments,
+		shuffle:     deps.Shuffle,
+		schedules:   deps.Schedules,
+		mix:         deps.Mix,
+		templates:   deps.Templates,
+		renderCache: deps.RenderCache,
+		refresh:     deps.Refresh,
+		widgets:     deps.Widgets,
+		db:          deps.DB,
+		dataDir:     deps.DataDir,
 	}
+	h.prerender = newPrerenderer(h)
+	return h
+}
+
+// frameRequest is everything resolved from an /image request that decides
+// which photo is picked and how the frame is rendered.
+type frameRequest struct {
+	Device        *model.Device // nil when the requester is not a known device
+	Source        string
+	Filter        photoFilter
+	LogicalW      int // Logical resolution for image generation (respects orientation)
+	LogicalH      int
+	NativeW       int // Native resolution of the device panel
+	NativeH       int
+	EnableCollage bool
+	Collage       service.CollageSettings
+	Widgets       []model.WidgetPlacement
+	Layout        string
+	Template      *model.LayoutTemplate // User-defined layout replacing Layout, nil for the built-in ones
+	DisplayMode   string
+	ProcOptions   map[string]string
+}
+
+func (r *frameRequest) deviceID() *uint {
+	if r.Device == nil {
+		return nil
+	}
+	return &r.Device.ID
+}
+
+// pickedPhoto is the photo chosen for a frame.
+type pickedPhoto struct {
+	Image  image.Image
+	IDs    []uint // Library photos served (2 for a collage), empty otherwise
+	Source string // Source the photo came from; differs from the request for mix
+
+	draws []service.ShuffleDraw // Marked played once the frame is served
+}
+
+// preparedFrame is a picked photo plus the overlay state at serve time.
+type preparedFrame struct {
+	Key         string // Render cache key, also used as the ETag
+	Photo       *pickedPhoto
+	ProcOptions map[string]string
+	NeedOverlay bool
+	RenderOpts  service.RenderOptions
+	Fallback    bool // Rendered natively because Chrome was unavailable
 }
 
 func (h *ImageHandler) ServeImage(c echo.Context) error {
+	// 1. Identify Device and Determine Settings
+	req, status, err := h.resolveFrameRequest(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	format, err := negotiateFrameFormat(c, req.Device)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// 1.5. Pick the photo, preferring the one pre-rendered after the last serve
+	photo := h.prerender.Take(req)
+	if photo == nil {
+		photo, err = h.pickPhoto(req, nil)
+		if err != nil {
+			if strings.Contains(err.Error(), "invalid source filter") {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "invalid source"})
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) || strings.Contains(err.Error(), "record not found") {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "no photos found for this device"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch photo: " + err.Error()})
+		}
+	}
+
+	// 2. Gather overlay data and compute the render cache key. The key covers
+	// the photo, the overlay state and the processing options, so an unchanged
+	// frame is answered without running the renderer or the converter.
+	frame := h.prepareFrame(req, photo)
+	etag := `"` + frame.Key + `"`
+	if format != epaper.FormatPNG {
+		etag = `"` + frame.Key + "." + format + `"`
+	}
+	c.Response().Header().Set("ETag", etag)
+	c.Response().Header().Set("Vary", "Accept")
+	h.setRefreshHeader(c, req, frame)
+
+	// The device already shows this frame. Nothing was served, so the photo
+	// stays unplayed and is picked again next time.
+	if ifNoneMatch(c.Request().Header.Get("If-None-Match"), etag) {
+		h.prerender.Schedule(req, photo.IDs)
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	// 3. Render layout + tone mapping (or reuse the cached frame)
+	rendered, err := h.buildFrame(frame)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if frame.Fallback {
+		// A frame drawn natively because Chrome failed gets no ETag, so the
+		// device fetches again once Chrome renders the real frame
+		c.Response().Header().Del("ETag")
+	}
+	h.commitPhoto(req, photo)
+	h.prerender.Schedule(req, photo.IDs)
+
+	// 4. Cache Thumbnail & Set Headers
+	if rendered.Thumbnail != nil {
+		thumbID := fmt.Sprintf("%d", time.Now().UnixNano())
+		thumbPath := filepath.Join(h.dataDir, fmt.Sprintf("thumb_%s.jpg", thumbID))
+
+		if err := os.WriteFile(thumbPath, rendered.Thumbnail, 0644); err == nil {
+			thumbnailUrl := fmt.Sprintf("http://%s/served-image-thumbnail/%s", c.Request().Host, thumbID)
+			c.Response().Header().Set("X-Thumbnail-URL", thumbnailUrl)
+		} else {
+			fmt.Printf("Failed to save served thumbnail: %v\n", err)
+		}
+	}
+
+	// 5. Encode in the negotiated format
+	body, err := h.processor.EncodeFrame(rendered.Image, frame.ProcOptions, format)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if format != epaper.FormatPNG {
+		// Packed formats carry no header of their own
+		c.Response().Header().Set("X-Frame-Width", strconv.Itoa(req.NativeW))
+		c.Response().Header().Set("X-Frame-Height", strconv.Itoa(req.NativeH))
+	}
+
+	// Set Content-Length and checksum headers
+	c.Response().Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	c.Response().Header().Set("X-Checksum-CRC32", photoframe.Checksum(body))
+
+	return c.Blob(http.StatusOK, epaper.ContentType(format), body)
+}
+
+// negotiateFrameFormat picks the frame encoding from the format query
+// parameter, then the Accept header, then the device's configured format,
+// defaulting to PNG.
+func negotiateFrameFormat(c echo.Context, device *model.Device) (string, error) {
+	if format := c.QueryParam("format"); format != "" {
+		if err := epaper.ValidateFormat(format); err != nil {
+			return "", err
+		}
+		return format, nil
+	}
+	if format, ok := epaper.FormatFromAccept(c.Request().Header.Get("Accept")); ok {
+		return format, nil
+	}
+	if device != nil && device.FrameFormat != "" {
+		return device.FrameFormat, nil
+	}
+	return epaper.FormatPNG, nil
+}
+
+// setRefreshHeader tells the frame how many seconds to sleep before its next
+// wake-up, per the device's refresh policy. Frames without a policy keep
+// their own interval.
+func (h *ImageHandler) setRefreshHeader(c echo.Context, req *frameRequest, frame *preparedFrame) {
+	if req.Device == nil {
+		return
+	}
+	// Reuse the events fetched for the calendar widget when there is one
+	events, _ := frame.RenderOpts.WidgetData(service.WidgetCalendar).([]gcalendar.Event)
+	if events == nil {
+		// A calendar widget without data has nothing to wake for; nil would
+		// have NextRefresh fetch the calendar again
+		for _, w := range req.Widgets {
+			if w.Widget == service.WidgetCalendar {
+				events = []gcalendar.Event{}
+				break
+			}
+		}
+	}
+	if interval := h.refresh.NextRefresh(req.Device, events); interval > 0 {
+		c.Response().Header().Set("X-Refresh-Interval", strconv.Itoa(int(interval.Seconds())))
+	}
+}
+
+// frameOverrides are per-request settings that take precedence over the
+// device's stored configuration. Zero values leave the device's setting.
+type frameOverrides struct {
+	Width       int
+	Height      int
+	Orientation string
+	Layout      string
+	TemplateID  *uint
+	DisplayMode string
+	Settings    *photoframe.ProcessingSettings
+	Palette     *photoframe.Palette
+}
+
+// resolveFrameRequest identifies the device and resolves the source, layout,
+// dimensions and processing options for the request. On failure it returns
+// the HTTP status to answer with.
+func (h *ImageHandler) resolveFrameRequest(c echo.Context) (*frameRequest, int, error) {
 	// Get source from route parameter
 	source := c.Param("source")
 
-	// 1. Identify Device and Determine Settings
 	// Try to find device by Hostname (X-Hostname header) first, then IP
 	var device model.Device
 	var result *gorm.DB
@@ -99,33 +315,11 @@ func (h *ImageHandler) ServeImage(c echo.Context) error {
 		deviceFound = result.Error == nil
 	}
 
-	// Native resolution of the device panel
-	nativeW, nativeH := 800, 480
-	// Logical resolution for image generation (respects orientation)
-	logicalW, logicalH := 800, 480
-
-	enableCollage := false
-	showDate := false
-	showWeather := false
-	var lat, lon float64
-
-	if deviceFound {
-		nativeW = device.Width
-		nativeH = device.Height
-		logicalW, logicalH = nativeW, nativeH
-
-		enableCollage = device.EnableCollage
-		showDate = device.ShowDate
-		showWeather = device.ShowWeather
-		lat = device.WeatherLat
-		lon = device.WeatherLon
-	}
-
 	// ALWAYS overrides logical resolution/orientation from Headers if present
+	var overrides frameOverrides
 	if wStr := c.Request().Header.Get("X-Display-Width"); wStr != "" {
 		if w, err := strconv.Atoi(wStr); err == nil && w > 0 {
-			logicalW = w
-			nativeW = w
+			overrides.Width = w
 			if deviceFound && device.Width != w {
 				device.Width = w
 				h.db.Model(&device).Update("width", w)
@@ -134,8 +328,7 @@ func (h *ImageHandler) ServeImage(c echo.Context) error {
 	}
 	if hStr := c.Request().Header.Get("X-Display-Height"); hStr != "" {
 		if he, err := strconv.Atoi(hStr); err == nil && he > 0 {
-			logicalH = he
-			nativeH = he
+			overrides.Height = he
 			if deviceFound && device.Height != he {
 				device.Height = he
 				h.db.Model(&device).Update("height", he)
@@ -143,251 +336,340 @@ func (h *ImageHandler) ServeImage(c echo.Context) error {
 		}
 	}
 	if oStr := c.Request().Header.Get("X-Display-Orientation"); oStr != "" {
-		if oStr == "portrait" && logicalW > logicalH {
-			logicalW, logicalH = logicalH, logicalW
-		} else if oStr == "landscape" && logicalW < logicalH {
-			logicalW, logicalH = logicalH, logicalW
-		}
+		overrides.Orientation = oStr
 		// Persist orientation update to database if it changed
 		if deviceFound && device.Orientation != oStr {
 			device.Orientation = oStr
 			h.db.Model(&device).Update("orientation", oStr)
 		}
-	} else if deviceFound && device.Orientation != "" {
-		// Use device orientation preference if no header provided
-		if device.Orientation == "portrait" && logicalW > logicalH {
-			logicalW, logicalH = logicalH, logicalW
-		} else if device.Orientation == "landscape" && logicalW < logicalH {
-			logicalW, logicalH = logicalH, logicalW
+	}
+
+	// Parse X-Processing-Settings header if present
+	if settingsStr := c.Request().Header.Get("X-Processing-Settings"); settingsStr != "" {
+		overrides.Settings = &photoframe.ProcessingSettings{}
+		if err := json.Unmarshal([]byte(settingsStr), overrides.Settings); err != nil {
+			fmt.Printf("Failed to parse X-Processing-Settings header: %v\n", err)
+			overrides.Settings = nil
 		}
 	}
 
-	layout := model.LayoutPhotoOverlay
-	displayMode := "cover"
-	showCalendar := false
+	// Parse X-Color-Palette header if present
+	if paletteStr := c.Request().Header.Get("X-Color-Palette"); paletteStr != "" {
+		overrides.Palette = &photoframe.Palette{}
+		if err := json.Unmarshal([]byte(paletteStr), overrides.Palette); err != nil {
+			fmt.Printf("Failed to parse X-Color-Palette header: %v\n", err)
+			overrides.Palette = nil
+		}
+	}
+
+	if !deviceFound {
+		return h.newFrameRequest(source, nil, overrides)
+	}
+	return h.newFrameRequest(source, &device, overrides)
+}
+
+// newFrameRequest resolves the source, layout, dimensions and processing
+// options for a device (nil for anonymous requests) and the given overrides.
+func (h *ImageHandler) newFrameRequest(source string, device *model.Device, overrides frameOverrides) (*frameRequest, int, error) {
+	req := &frameRequest{
+		Source:      source,
+		Filter:      photoFilter{Source: source},
+		NativeW:     800,
+		NativeH:     480,
+		LogicalW:    800,
+		LogicalH:    480,
+		Layout:      model.LayoutPhotoOverlay,
+		DisplayMode: "cover",
+	}
+
+	if device != nil {
+		req.Device = device
+		req.NativeW = device.Width
+		req.NativeH = device.Height
+
+		req.EnableCollage = device.EnableCollage
+		req.Collage = service.DeviceCollage(device)
+	}
+	if overrides.Width > 0 {
+		req.NativeW = overrides.Width
+	}
+	if overrides.Height > 0 {
+		req.NativeH = overrides.Height
+	}
+	req.LogicalW, req.LogicalH = req.NativeW, req.NativeH
+
+	// Use device orientation preference if no override provided
+	orientation := overrides.Orientation
+	if orientation == "" && device != nil {
+		orientation = device.Orientation
+	}
+	if orientation == "portrait" && req.LogicalW > req.LogicalH {
+		req.LogicalW, req.LogicalH = req.LogicalH, req.LogicalW
+	} else if orientation == "landscape" && req.LogicalW < req.LogicalH {
+		req.LogicalW, req.LogicalH = req.LogicalH, req.LogicalW
+	}
 
-	if deviceFound {
+	if device != nil {
 		if device.Layout != "" {
-			layout = device.Layout
+			req.Layout = device.Layout
 		}
+		req.Template = h.templates.DeviceTemplate(device)
 		if device.DisplayMode != "" {
-			displayMode = device.DisplayMode
+			req.DisplayMode = device.DisplayMode
 		}
-		showCalendar = device.ShowCalendar
 	}
 
-	var img image.Image
-	var err error
+	// Devices on the schedule source get the source, album and layout of
+	// whichever playlist entry is active in their timezone.
+	if source == model.SourceSchedule {
+		if device == nil {
+			return nil, http.StatusBadRequest, errors.New("device not found - schedules require device config")
+		}
+		entry, err := h.schedules.ActiveSchedule(device, time.Now())
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("failed to resolve schedule: %w", err)
+		}
+		if entry == nil {
+			return nil, http.StatusNotFound, errors.New("no schedule entry is active for this device")
+		}
+		req.Source = entry.Source
+		req.Filter = photoFilter{Source: entry.Source, AlbumID: entry.AlbumID}
+		if entry.Layout != "" {
+			req.Layout = entry.Layout
+			req.Template = nil
+		}
+	}
 
-	// 1.5. Get Device History for Exclusion
-	var excludeIDs []uint
-	if deviceFound {
-		// History retention: ensure we don't repeat recent 50 images
-		// Get last 50 served images for this device
-		var history []model.DeviceHistory
-		if err := h.db.Where("device_id = ?", device.ID).
-			Order("served_at desc").
-			Limit(50).
-			Find(&history).Error; err == nil {
-			for _, h := range history {
-				excludeIDs = append(excludeIDs, h.ImageID)
-			}
+	if overrides.Layout != "" {
+		req.Layout = overrides.Layout
+		req.Template = nil
+	}
+	if overrides.TemplateID != nil {
+		tmpl, err := h.templates.GetTemplate(*overrides.TemplateID)
+		if err != nil {
+			return nil, http.StatusNotFound, errors.New("layout template not found")
 		}
+		req.Template = tmpl
+	}
+	if overrides.DisplayMode != "" {
+		req.DisplayMode = overrides.DisplayMode
+	}
+	// The dashboard source has no photo for the other layouts to show
+	if req.Source == model.SourceDashboard {
+		req.Layout = model.LayoutDashboard
+	}
+	req.Widgets = service.LayoutWidgets(device, req.Layout)
+
+	switch req.Source {
+	case model.SourceMix:
+		if device == nil {
+			return nil, http.StatusBadRequest, errors.New("device not found - mix requires device config")
+		}
+	case model.SourceAIGeneration:
+		if device == nil {
+			return nil, http.StatusBadRequest, errors.New("device not found - AI generation requires device config")
+		}
+	}
+
+	// Pass NATIVE dimensions to CLI.
+	// The CLI will detect Source (logicalW/H) vs Target (nativeW/H) orientation mismatch and rotate if needed.
+	req.ProcOptions = map[string]string{
+		"dimension": fmt.Sprintf("%dx%d", req.NativeW, req.NativeH),
+	}
+	palette := service.DevicePalette(device, overrides.Palette)
+	for k, v := range h.processor.MapProcessingSettings(overrides.Settings, palette) {
+		req.ProcOptions[k] = v
+	}
+
+	return req, http.StatusOK, nil
+}
+
+// pickPhoto selects the photo (or collage) for the request's source. Its
+// shuffle bag draws are only marked played by commitPhoto, once the frame is
+// actually served. shown are the library photos on the device's screen, which
+// the pick avoids near-duplicates of; nil looks them up in its history.
+func (h *ImageHandler) pickPhoto(req *frameRequest, shown []uint) (*pickedPhoto, error) {
+	picker := *h
+	picker.shuffle = h.shuffle.DryRun()
+	picker.shown = shown
+	photo, err := picker.fetchPhoto(req)
+	if err != nil {
+		return nil, err
+	}
+	photo.draws = picker.shuffle.Drawn()
+	return photo, nil
+}
+
+// commitPhoto marks the photo served to the device: its draws are marked
+// played in the shuffle bags and it is logged to the device's history.
+func (h *ImageHandler) commitPhoto(req *frameRequest, photo *pickedPhoto) {
+	if req.Device == nil {
+		return
+	}
+	if err := h.shuffle.Commit(photo.draws); err != nil {
+		log.Printf("Failed to mark photos %v played for device %d: %v", photo.IDs, req.Device.ID, err)
 	}
+	// Rotation order is driven by the device's shuffle bag; history is kept as
+	// a log of what was recently served.
+	if len(photo.IDs) > 0 {
+		go h.recordHistory(req.Device.ID, photo.IDs)
+	}
+}
 
-	var servedImageIDs []uint // Track which IDs were served (1 or 2 if collage)
+// fetchPhoto fetches the photo (or collage) for the request's source.
+func (h *ImageHandler) fetchPhoto(req *frameRequest) (*pickedPhoto, error) {
+	photo := &pickedPhoto{Source: req.Source}
+	var err error
 
-	if source == model.SourceTelegram {
+	switch {
+	case req.Source == model.SourceTelegram:
 		// Serve Telegram Photo (always single, no collage)
-		imgPath := filepath.Join(h.dataDir, "photos", "telegram_last.jpg")
-		f, fsErr := os.Open(imgPath)
-		if fsErr != nil {
-			img, err = h.fetchPlaceholder()
-		} else {
-			defer f.Close()
-			img, _, err = image.Decode(f)
+		photo.Image, err = h.fetchTelegramPhoto()
+		if os.IsNotExist(err) {
+			photo.Image, err = h.fetchPlaceholder()
 		}
-	} else if source == model.SourceAIGeneration {
-		// AI Generation: generate fresh image from device config
-		if !deviceFound {
-			return c.JSON(http.StatusBadRequest, map[string]string{"error": "device not found - AI generation requires device config"})
+	case req.Source == model.SourceMix:
+		// Mix: pick a source by the device's weights, skipping empty or failing ones
+		photo.Image, photo.IDs, photo.Source, err = h.fetchMix(req.Device.ID, req.LogicalW, req.LogicalH, req.EnableCollage, req.Collage)
+	case req.Source == model.SourceAIGeneration:
+		// AI Generation: generate fresh image from device config. Previews
+		// don't pay for a generation the device would never show.
+		if h.preview {
+			photo.Image, err = h.fetchPlaceholder()
+		} else {
+			photo.Image, err = h.aiGen.Generate(req.Device)
 		}
-		img, err = h.aiGen.Generate(&device)
-	} else if enableCollage {
-		var devID *uint
-		if deviceFound {
-			devID = &device.ID
+	case req.Source == model.SourceDashboard:
+		// Dashboard: the widgets alone, without a photo tile
+	case req.EnableCollage:
+		photo.Image, photo.IDs, err = h.fetchCollage(req.LogicalW, req.LogicalH, req.Collage, req.Filter, req.deviceID())
+		if errors.Is(err, errPhotoUnavailable) {
+			log.Printf("Warning: %v", err)
+			photo.IDs = nil
+			photo.Image, err = h.fetchPlaceholder()
 		}
-		img, servedImageIDs, err = h.fetchSmartCollage(logicalW, logicalH, source, excludeIDs, devID)
-	} else {
+	default:
 		var id uint
-		var devID *uint
-		if deviceFound {
-			devID = &device.ID
-		}
-		img, id, err = h.fetchRandomPhoto(source, excludeIDs, devID)
+		photo.Image, id, err = h.fetchRandomPhoto(req.Filter, req.deviceID())
 		if err == nil {
-			servedImageIDs = append(servedImageIDs, id)
+			photo.IDs = append(photo.IDs, id)
 		}
 	}
-
 	if err != nil {
-		if strings.Contains(err.Error(), "invalid source filter") {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "invalid source"})
-		}
-		if errors.Is(err, gorm.ErrRecordNotFound) || strings.Contains(err.Error(), "record not found") {
-			return c.JSON(http.StatusNotFound, map[string]string{"error": "no photos found for this device"})
-		}
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch photo: " + err.Error()})
-	}
-
-	// 1.6. Record History
-	if deviceFound && len(servedImageIDs) > 0 {
-		go func(devID uint, imgIDs []uint) {
-			for _, imgID := range imgIDs {
-				if imgID == 0 {
-					continue
-				}
-				h.db.Create(&model.DeviceHistory{
-					DeviceID: devID,
-					ImageID:  imgID,
-					ServedAt: time.Now(),
-				})
-			}
-			// Prune old history
-			// Keep last 100 entries for this device
-			// (Keep more in DB than we filter to have a buffer)
-			var count int64
-			h.db.Model(&model.DeviceHistory{}).Where("device_id = ?", devID).Count(&count)
-			if count > 100 {
-				// Delete oldest
-				// SQLite modification with LIMIT is compile-option dependent, subquery is safer
-				h.db.Where("device_id = ? AND id NOT IN (?)", devID,
-					h.db.Model(&model.DeviceHistory{}).Select("id").
-						Where("device_id = ?", devID).
-						Order("served_at desc").
-						Limit(100),
-				).Delete(&model.DeviceHistory{})
-			}
-		}(device.ID, servedImageIDs)
-	}
-
-	// 2. Render layout (photo + overlay + calendar)
-	needsOverlay := showDate || showWeather || showCalendar
-	var imgWithOverlay image.Image
-
-	if needsOverlay {
-		var weatherData *weather.CurrentWeather
-		var deviceTimezone string
-		if showWeather && lat != 0 && lon != 0 {
-			latStr := fmt.Sprintf("%f", lat)
-			lonStr := fmt.Sprintf("%f", lon)
-			var weatherErr error
-			weatherData, weatherErr = h.weather.GetWeather(latStr, lonStr)
-			if weatherErr != nil {
-				log.Printf("Failed to fetch weather data: %v", weatherErr)
-			}
-			if weatherData != nil {
-				deviceTimezone = weatherData.Timezone
-			}
-		}
+		return nil, err
+	}
+	return photo, nil
+}
 
-		var events []gcalendar.Event
-		if showCalendar && h.calendar != nil && h.calendarGoogle != nil {
-			httpClient, err := h.calendarGoogle.GetClient()
-			if err == nil {
-				calendarID := device.CalendarID
-				if calendarID == "" {
-					calendarID = "primary"
-				}
-				var calErr error
-				events, calErr = h.calendar.GetTodayEvents(httpClient, calendarID, deviceTimezone)
-				if calErr != nil {
-					log.Printf("Failed to fetch calendar events: %v", calErr)
-				}
-			}
+// recordHistory logs served photos and prunes the device's history.
+func (h *ImageHandler) recordHistory(devID uint, imgIDs []uint) {
+	for _, imgID := range imgIDs {
+		if imgID == 0 {
+			continue
 		}
-
-		var renderErr error
-		imgWithOverlay, renderErr = h.renderer.Render(service.RenderOptions{
-			Layout:       layout,
-			DisplayMode:  displayMode,
-			Width:        logicalW,
-			Height:       logicalH,
-			NativeWidth:  nativeW,
-			NativeHeight: nativeH,
-			Photo:        img,
-			ShowDate:     showDate,
-			ShowWeather:  showWeather,
-			Weather:      weatherData,
-			ShowCalendar: showCalendar,
-			Events:       events,
-			Timezone:     deviceTimezone,
-			DateFormat:   device.DateFormat,
+		h.db.Create(&model.DeviceHistory{
+			DeviceID: devID,
+			ImageID:  imgID,
+			ServedAt: time.Now(),
 		})
-		if renderErr != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "render failed: " + renderErr.Error()})
-		}
-	} else {
-		imgWithOverlay = img
 	}
-
-	// 3. Tone Mapping + Thumbnail (CLI)
-	// Pass NATIVE dimensions to CLI.
-	// The CLI will detect Source (logicalW/H) vs Target (nativeW/H) orientation mismatch and rotate if needed.
-	procOptions := map[string]string{
-		"dimension": fmt.Sprintf("%dx%d", nativeW, nativeH),
+	// Prune old history
+	// Keep last 100 entries for this device
+	// (Keep more in DB than we filter to have a buffer)
+	var count int64
+	h.db.Model(&model.DeviceHistory{}).Where("device_id = ?", devID).Count(&count)
+	if count > 100 {
+		// Delete oldest
+		// SQLite modification with LIMIT is compile-option dependent, subquery is safer
+		h.db.Where("device_id = ? AND id NOT IN (?)", devID,
+			h.db.Model(&model.DeviceHistory{}).Select("id").
+				Where("device_id = ?", devID).
+				Order("served_at desc").
+				Limit(100),
+		).Delete(&model.DeviceHistory{})
 	}
+}
 
-	// 3.5. Parse X-Processing-Settings header if present
-	var settings *photoframe.ProcessingSettings
-	if settingsStr := c.Request().Header.Get("X-Processing-Settings"); settingsStr != "" {
-		settings = &photoframe.ProcessingSettings{}
-		if err := json.Unmarshal([]byte(settingsStr), settings); err != nil {
-			fmt.Printf("Failed to parse X-Processing-Settings header: %v\n", err)
-			settings = nil
-		}
+// prepareFrame fetches the current data of the device's widgets for the
+// photo and computes the frame's render cache key.
+func (h *ImageHandler) prepareFrame(req *frameRequest, photo *pickedPhoto) *preparedFrame {
+	frame := &preparedFrame{
+		Photo:       photo,
+		ProcOptions: req.ProcOptions,
+		NeedOverlay: len(req.Widgets) > 0 || req.Template != nil || req.Layout == model.LayoutDashboard,
 	}
 
-	// 3.6. Parse X-Color-Palette header if present
-	var palette *photoframe.Palette
-	if paletteStr := c.Request().Header.Get("X-Color-Palette"); paletteStr != "" {
-		palette = &photoframe.Palette{}
-		if err := json.Unmarshal([]byte(paletteStr), palette); err != nil {
-			fmt.Printf("Failed to parse X-Color-Palette header: %v\n", err)
-			palette = nil
+	var overlayKey string
+	if frame.NeedOverlay {
+		var deviceName, timezone, dateFormat, engine string
+		if req.Device != nil {
+			deviceName = req.Device.Name
+			timezone = req.Device.Timezone
+			dateFormat = req.Device.DateFormat
+			engine = req.Device.Renderer
+		}
+		frame.RenderOpts = service.RenderOptions{
+			Layout:       req.Layout,
+			DisplayMode:  req.DisplayMode,
+			Width:        req.LogicalW,
+			Height:       req.LogicalH,
+			NativeWidth:  req.NativeW,
+			NativeHeight: req.NativeH,
+			Photo:        photo.Image,
+			Widgets:      h.widgets.Fetch(req.Device, req.Widgets),
+			DeviceName:   deviceName,
+			Timezone:     timezone,
+			DateFormat:   dateFormat,
+			Engine:       engine,
+		}
+		if req.Template != nil {
+			frame.RenderOpts.Template = req.Template.HTML
+			frame.RenderOpts.Fields = req.Template.Fields
 		}
+		overlayKey = h.renderer.Fingerprint(frame.RenderOpts)
 	}
 
-	headerOpts := h.processor.MapProcessingSettings(settings, palette)
-	for k, v := range headerOpts {
-		procOptions[k] = v
+	var collageKey interface{}
+	if len(photo.IDs) > 1 {
+		collageKey = req.Collage
 	}
+	frame.Key = service.CacheKey(photoFingerprint(photo.Image, photo.IDs), h.framingKey(photo.IDs), collageKey, req.LogicalW, req.LogicalH, overlayKey, h.processor.Engine(), req.ProcOptions)
+	return frame
+}
 
-	log.Println("Processing image with options: ", procOptions)
-	processedBytes, thumbBytes, err := h.processor.ProcessImage(imgWithOverlay, procOptions)
-	if err != nil {
-		fmt.Printf("Processor failed: %v\n", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "processor service failed: " + err.Error()})
+// buildFrame renders the overlay and runs tone mapping for the frame, or
+// returns the cached result when the same frame was produced before.
+func (h *ImageHandler) buildFrame(frame *preparedFrame) (*service.CachedRender, error) {
+	if cached, ok := h.renderCache.Get(frame.Key); ok {
+		return cached, nil
 	}
 
-	// 4. Cache Thumbnail & Set Headers
-	if thumbBytes != nil {
-		thumbID := fmt.Sprintf("%d", time.Now().UnixNano())
-		thumbPath := filepath.Join(h.dataDir, fmt.Sprintf("thumb_%s.jpg", thumbID))
-
-		if err := os.WriteFile(thumbPath, thumbBytes, 0644); err == nil {
-			thumbnailUrl := fmt.Sprintf("http://%s/served-image-thumbnail/%s", c.Request().Host, thumbID)
-			c.Response().Header().Set("X-Thumbnail-URL", thumbnailUrl)
-		} else {
-			fmt.Printf("Failed to save served thumbnail: %v\n", err)
+	imgWithOverlay := frame.Photo.Image
+	if frame.NeedOverlay {
+		var engine string
+		var err error
+		imgWithOverlay, engine, err = h.renderer.RenderFrame(frame.RenderOpts)
+		if err != nil {
+			return nil, fmt.Errorf("render failed: %w", err)
 		}
+		// The key is for the engine the device asked for; a frame drawn
+		// natively because Chrome fell over must not be served for it later
+		frame.Fallback = engine != h.renderer.Engine(frame.RenderOpts.Engine)
 	}
 
-	// Set Content-Length header
-	c.Response().Header().Set("Content-Length", fmt.Sprintf("%d", len(processedBytes)))
+	log.Println("Processing image with options: ", frame.ProcOptions)
+	processedBytes, thumbBytes, err := h.processor.ProcessImage(imgWithOverlay, frame.ProcOptions)
+	if err != nil {
+		fmt.Printf("Processor failed: %v\n", err)
+		return nil, fmt.Errorf("processor service failed: %w", err)
+	}
 
-	return c.Blob(http.StatusOK, "image/png", processedBytes)
+	rendered := &service.CachedRender{Image: processedBytes, Thumbnail: thumbBytes}
+	// Previews leave the render cache alone too
+	if !frame.Fallback && !h.preview {
+		h.renderCache.Put(frame.Key, rendered)
+	}
+	return rendered, nil
 }
 
 func (h *ImageHandler) GetServedImageThumbnail(c echo.Context) error {
@@ -427,15 +709,76 @@ func (h *ImageHandler) getOrientation() string {
 	return val
 }
 
+// fetchCollage fetches photos for the device's collage layout and composes
+// them. Each slot, largest first, is drawn from photos of the slot's
+// orientation where possible, then the photos are arranged across the slots
+// so the least is cropped away. When the source runs out of photos they are
+// repeated.
+func (h *ImageHandler) fetchCollage(screenW, screenH int, settings service.CollageSettings, filter photoFilter, deviceID *uint) (image.Image, []uint, error) {
+	slots := service.CollageSlots(settings.Layout, screenW, screenH, settings.Gutter)
+	if len(slots) == 0 {
+		return h.fetchSmartCollage(screenW, screenH, filter, deviceID)
+	}
+
+	var photos []image.Image
+	var ids []uint
+	for _, slot := range slots {
+		img, id, err := h.fetchRandomPhotoWithType(service.SlotOrientation(slot), filter, ids, deviceID)
+		if err != nil {
+			// Nothing else of the slot's orientation; any other photo will do
+			if len(ids) == 0 {
+				img, id, err = h.drawPhoto(filter, deviceID)
+			} else {
+				img, id, err = h.fetchRandomPhotoWithType("", filter, ids, deviceID)
+			}
+		}
+		if err != nil {
+			if len(ids) == 0 {
+				return nil, nil, err
+			}
+			log.Printf("Collage: only %d photos for %d slots, repeating", len(ids), len(slots))
+			break
+		}
+		// Sources without records (URL proxy) can't be combined
+		if id == 0 {
+			return img, nil, nil
+		}
+		photos = append(photos, img)
+		ids = append(ids, id)
+	}
+
+	aspects := make([]float64, len(photos))
+	for i, img := range photos {
+		b := img.Bounds()
+		aspects[i] = float64(b.Dx()) / float64(b.Dy())
+	}
+	assignment := service.AssignSlots(slots, aspects)
+
+	background, err := service.ParseHexColor(settings.Background)
+	if err != nil {
+		background = color.RGBA{255, 255, 255, 255}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, screenW, screenH))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{C: background}, image.Point{}, draw.Src)
+	for i, slot := range slots {
+		imageops.DrawCover(dst, slot, photos[assignment[i]])
+	}
+	return dst, ids, nil
+}
+
 // fetchSmartCollage fetches one or two photos and creates a collage if the
 // first photo's orientation doesn't match the device orientation.
-func (h *ImageHandler) fetchSmartCollage(screenW, screenH int, sourceFilter string, excludeIDs []uint, deviceID *uint) (image.Image, []uint, error) {
+func (h *ImageHandler) fetchSmartCollage(screenW, screenH int, filter photoFilter, deviceID *uint) (image.Image, []uint, error) {
 	devicePortrait := screenH > screenW
 
-	img1, id1, err := h.fetchRandomPhoto(sourceFilter, excludeIDs, deviceID)
+	img1, id1, err := h.drawPhoto(filter, deviceID)
 	if err != nil {
 		return nil, nil, err
 	}
+	// Sources without records (URL proxy) can't be paired into a collage
+	if id1 == 0 {
+		return img1, nil, nil
+	}
 	servedIDs := []uint{id1}
 
 	bounds := img1.Bounds()
@@ -454,16 +797,9 @@ func (h *ImageHandler) fetchSmartCollage(screenW, screenH int, sourceFilter stri
 		targetType = "portrait"
 	}
 
-	excludeWithHistory := append(append([]uint(nil), excludeIDs...), id1)
-
-	// 1. Try with full exclusions (history + id1)
-	img2, id2, err := h.fetchRandomPhotoWithType(targetType, sourceFilter, excludeWithHistory, deviceID)
-	if err != nil || id2 == id1 {
-		log.Printf("SmartCollage: query with history exclusion failed for %s: %v, retrying without history", targetType, err)
-		// 2. Try with only id1 excluded (ignore history)
-		img2, id2, err = h.fetchRandomPhotoWithType(targetType, sourceFilter, []uint{id1}, deviceID)
-	}
-
+	// The shuffle bag prefers unplayed photos and falls back to played ones,
+	// so only the first photo needs to be excluded here.
+	img2, id2, err := h.fetchRandomPhotoWithType(targetType, filter, []uint{id1}, deviceID)
 	if err == nil && id2 != id1 {
 		servedIDs = append(servedIDs, id2)
 	} else {
@@ -479,22 +815,53 @@ func (h *ImageHandler) fetchSmartCollage(screenW, screenH int, sourceFilter stri
 }
 
 // fetchRandomPhotoWithType fetches a random photo matching the given orientation.
-// orientations "auto" is always included as a match.
-func (h *ImageHandler) fetchRandomPhotoWithType(targetType string, sourceFilter string, excludeIDs []uint, deviceID *uint) (image.Image, uint, error) {
-	query := h.db.Order("RANDOM()").Where("orientation IN ?", []string{targetType, "auto"})
-
-	if len(excludeIDs) > 0 {
-		query = query.Where("id NOT IN ?", excludeIDs)
-	}
-
-	query, earlyResult, err := h.applySourceFilter(query, sourceFilter, deviceID)
+// orientations "auto" is always included as a match, and an empty
+// targetType matches any photo.
+func (h *ImageHandler) fetchRandomPhotoWithType(targetType string, filter photoFilter, excludeIDs []uint, deviceID *uint) (image.Image, uint, error) {
+	query, earlyResult, err := h.applySourceFilter(h.db.Model(&model.Image{}), filter, deviceID)
 	if earlyResult != nil || err != nil {
 		return earlyResult, 0, err
 	}
 
 	var item model.Image
-	if err := query.First(&item).Error; err != nil {
-		return nil, 0, err
+	if deviceID == nil {
+		query = query.Order("RANDOM()")
+		if targetType != "" {
+			query = query.Where("orientation IN ?", []string{targetType, "auto"})
+		}
+		if len(excludeIDs) > 0 {
+			query = query.Where("id NOT IN ?", excludeIDs)
+		}
+		if err := query.First(&item).Error; err != nil {
+			return nil, 0, err
+		}
+	} else {
+		var candidates []model.Image
+		if err := query.Select("id", "orientation", "favorite", "rating", "taken_at", "phash").Find(&candidates).Error; err != nil {
+			return nil, 0, err
+		}
+		// Neither the photos already in the collage nor copies of them
+		near := h.nearDuplicates(candidates, excludeIDs)
+		matching := make(map[uint]bool)
+		for _, c := range candidates {
+			if (targetType == "" || c.Orientation == targetType || c.Orientation == "auto") && !near[c.ID] {
+				matching[c.ID] = true
+			}
+		}
+		for _, id := range excludeIDs {
+			delete(matching, id)
+		}
+
+		pool, bag := h.devicePool(*deviceID, filter, candidates)
+		id, err := h.shuffle.Draw(*deviceID, bag, pool, func(id uint) bool {
+			return matching[id]
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := h.db.First(&item, id).Error; err != nil {
+			return nil, 0, err
+		}
 	}
 
 	img, err := h.loadImageFromRecord(item)
@@ -544,7 +911,7 @@ func (h *ImageHandler) fetchSynologyPhoto(item model.Image) (image.Image, uint,
 		return nil, 0, err
 	}
 
-	img, _, err := image.Decode(bytes.NewReader(data))
+	img, _, err := imageops.DecodeBytes(data)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -580,60 +947,264 @@ func (h *ImageHandler) resolvePath(path string) string {
 	return path
 }
 
-// fetchRandomPhoto fetches a random photo from the given source, excluding
-// the given IDs. Falls back to ignoring exclusions, then to a placeholder.
-func (h *ImageHandler) fetchRandomPhoto(sourceFilter string, excludeIDs []uint, deviceID *uint) (image.Image, uint, error) {
-	query := h.db.Order("RANDOM()")
+// errPhotoUnavailable is returned by drawPhoto when the source has no
+// eligible photo or the drawn photo fails to load.
+var errPhotoUnavailable = errors.New("photo unavailable")
 
-	if len(excludeIDs) > 0 {
-		query = query.Where("id NOT IN ?", excludeIDs)
+// fetchRandomPhoto fetches the next photo from the given source, falling back
+// to a placeholder when the source has no photos or the photo fails to load.
+func (h *ImageHandler) fetchRandomPhoto(filter photoFilter, deviceID *uint) (image.Image, uint, error) {
+	img, id, err := h.drawPhoto(filter, deviceID)
+	if errors.Is(err, errPhotoUnavailable) {
+		log.Printf("Warning: %v", err)
+		img, err := h.fetchPlaceholder()
+		return img, 0, err
 	}
+	return img, id, err
+}
 
-	query, earlyResult, err := h.applySourceFilter(query, sourceFilter, deviceID)
+// drawPhoto draws the next photo from the given source. Devices draw from
+// their persisted shuffle bag so every eligible photo is shown once per cycle
+// (or more, per the device's selection strategy); anonymous requests get a
+// plain random pick. The returned ID is 0 for sources without image records.
+func (h *ImageHandler) drawPhoto(filter photoFilter, deviceID *uint) (image.Image, uint, error) {
+	query, earlyResult, err := h.applySourceFilter(h.db.Model(&model.Image{}), filter, deviceID)
 	if earlyResult != nil || err != nil {
 		return earlyResult, 0, err
 	}
 
 	var item model.Image
-	if err := query.First(&item).Error; err != nil {
-		// Fallback: retry without exclusions
-		if len(excludeIDs) > 0 {
-			retryQuery := h.db.Order("RANDOM()")
-			retryQuery, earlyResult, retryErr := h.applySourceFilter(retryQuery, sourceFilter, deviceID)
-			if earlyResult != nil || retryErr != nil {
-				return earlyResult, 0, retryErr
+	if deviceID == nil {
+		err = query.Order("RANDOM()").First(&item).Error
+	} else {
+		var candidates []model.Image
+		if err = query.Select("id", "favorite", "rating", "taken_at", "phash").Find(&candidates).Error; err == nil {
+			pool, bag := h.devicePool(*deviceID, filter, candidates)
+			// Avoid a near-duplicate of the photos on screen right now,
+			// unless that's all the source has
+			shown := h.shown
+			if shown == nil {
+				shown = h.lastFrame(*deviceID)
 			}
-			if err := retryQuery.First(&item).Error; err != nil {
-				img, err := h.fetchPlaceholder()
-				return img, 0, err
+			near := h.nearDuplicates(candidates, shown)
+			var id uint
+			id, err = h.shuffle.Draw(*deviceID, bag, pool, func(id uint) bool { return !near[id] })
+			if errors.Is(err, gorm.ErrRecordNotFound) && len(near) > 0 {
+				id, err = h.shuffle.Draw(*deviceID, bag, pool, nil)
+			}
+			if err == nil {
+				err = h.db.First(&item, id).Error
 			}
-		} else {
-			img, err := h.fetchPlaceholder()
-			return img, 0, err
 		}
 	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: no photo from %s: %v", errPhotoUnavailable, filter.pool(), err)
+	}
 
 	img, err := h.loadImageFromRecord(item)
 	if err != nil {
-		log.Printf("Warning: Failed to load image id=%d: %v", item.ID, err)
-		img, err := h.fetchPlaceholder()
-		return img, 0, err
+		return nil, 0, fmt.Errorf("%w: failed to load image id=%d: %v", errPhotoUnavailable, item.ID, err)
 	}
 	return img, item.ID, nil
 }
 
-// applySourceFilter adds source-specific WHERE clauses to the query.
+// lastFrame returns the photos of the device's last frame, which is at most
+// four for collages.
+func (h *ImageHandler) lastFrame(deviceID uint) []uint {
+	var ids []uint
+	var last model.DeviceHistory
+	if err := h.db.Where("device_id = ?", deviceID).Order("served_at desc").First(&last).Error; err != nil {
+		return nil
+	}
+	// A frame's photos are recorded together
+	h.db.Model(&model.DeviceHistory{}).
+		Where("device_id = ? AND served_at > ?", deviceID, last.ServedAt.Add(-time.Second)).
+		Order("served_at desc").Limit(4).Pluck("image_id", &ids)
+	return ids
+}
+
+// nearDuplicates returns the candidates that look nearly identical to any of
+// the given photos.
+func (h *ImageHandler) nearDuplicates(candidates []model.Image, ids []uint) map[uint]bool {
+	if len(ids) == 0 {
+		return nil
+	}
+	var hashes []string
+	if err := h.db.Model(&model.Image{}).Where("id IN ? AND phash != ''", ids).Pluck("phash", &hashes).Error; err != nil || len(hashes) == 0 {
+		return nil
+	}
+	return service.NearDuplicateIDs(candidates, hashes, service.DuplicateDistance)
+}
+
+// fetchMix tries the device's mix sources in weighted random order and
+// returns the first one that yields a photo, along with that source. Smart collage pairs photos from
+// the chosen source.
+func (h *ImageHandler) fetchMix(deviceID uint, screenW, screenH int, enableCollage bool, collage service.CollageSettings) (image.Image, []uint, string, error) {
+	sources, err := h.mix.SourceOrder(deviceID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if len(sources) == 0 {
+		return nil, nil, "", errors.New("no sources configured for mix")
+	}
+
+	for _, source := range sources {
+		var img image.Image
+		var ids []uint
+		var err error
+
+		switch {
+		case source == model.SourceTelegram:
+			img, err = h.fetchTelegramPhoto()
+		case enableCollage:
+			img, ids, err = h.fetchCollage(screenW, screenH, collage, photoFilter{Source: source}, &deviceID)
+		default:
+			var id uint
+			img, id, err = h.drawPhoto(photoFilter{Source: source}, &deviceID)
+			if id != 0 {
+				ids = []uint{id}
+			}
+		}
+		if err == nil && img != nil {
+			return img, ids, source, nil
+		}
+		log.Printf("Mix: skipping source %s for device %d: %v", source, deviceID, err)
+	}
+	return nil, nil, "", gorm.ErrRecordNotFound
+}
+
+// fetchTelegramPhoto loads the last photo received by the Telegram bot.
+func (h *ImageHandler) fetchTelegramPhoto() (image.Image, error) {
+	f, err := os.Open(filepath.Join(h.dataDir, "photos", "telegram_last.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := imageops.Decode(f)
+	return img, err
+}
+
+// devicePool applies the device's selection strategy to the candidate photos,
+// returning the weighted pool and the name of the shuffle bag to draw from.
+// The memories strategy draws from its own bag and falls back to the full
+// pool when no photo was taken around today's date.
+func (h *ImageHandler) devicePool(deviceID uint, filter photoFilter, candidates []model.Image) ([]uint, string) {
+	var device model.Device
+	if err := h.db.First(&device, deviceID).Error; err != nil {
+		return service.WeightedPool(model.SelectionUniform, candidates), filter.pool()
+	}
+	if device.SelectionStrategy == model.SelectionMemories {
+		today := time.Now().In(service.DeviceLocation(&device))
+		if memories := service.MemoryCandidates(candidates, today, device.MemoriesWindowDays); len(memories) > 0 {
+			return service.WeightedPool(model.SelectionUniform, memories), filter.pool() + ":memories"
+		}
+	}
+	return service.WeightedPool(device.SelectionStrategy, candidates), filter.pool()
+}
+
+// photoFingerprint identifies the photo(s) being served for the render cache.
+// Library photos are identified by ID; photos without a record (Telegram, URL
+// proxy, AI generation) are hashed by content.
+func photoFingerprint(img image.Image, ids []uint) string {
+	if len(ids) > 0 && ids[0] != 0 {
+		return fmt.Sprintf("ids:%v", ids)
+	}
+	if img == nil {
+		return "none"
+	}
+
+	h := sha256.New()
+	switch src := img.(type) {
+	case *image.YCbCr:
+		h.Write(src.Y)
+		h.Write(src.Cb)
+		h.Write(src.Cr)
+	case *image.RGBA:
+		h.Write(src.Pix)
+	case *image.NRGBA:
+		h.Write(src.Pix)
+	default:
+		rgba := image.NewRGBA(src.Bounds())
+		draw.Draw(rgba, rgba.Bounds(), src, src.Bounds().Min, draw.Src)
+		h.Write(rgba.Pix)
+	}
+	fmt.Fprintf(h, "%v", img.Bounds())
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// framingKey identifies how the photos are cropped, so that editing a
+// photo's focus or crop windows invalidates its cached frames.
+func (h *ImageHandler) framingKey(ids []uint) []imageops.Framing {
+	if len(ids) == 0 {
+		return nil
+	}
+	var items []model.Image
+	if err := h.db.Select("id", "focus_x", "focus_y", "crop_landscape", "crop_portrait").
+		Where("id IN ?", ids).Order("id").Find(&items).Error; err != nil {
+		return nil
+	}
+	framings := make([]imageops.Framing, len(items))
+	for i, item := range items {
+		if item.FocusX != nil && item.FocusY != nil {
+			framings[i].Focus = imageops.Focus{X: *item.FocusX, Y: *item.FocusY}
+		}
+		framings[i].Landscape = (*imageops.Crop)(item.CropLandscape)
+		framings[i].Portrait = (*imageops.Crop)(item.CropPortrait)
+	}
+	return framings
+}
+
+// ifNoneMatch reports whether an If-None-Match header value matches etag.
+func ifNoneMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// photoFilter selects the photos a request draws from.
+type photoFilter struct {
+	Source  string
+	AlbumID string // Optional, restricts synced sources to a single album
+}
+
+// pool names the shuffle bag used for the filter, so that e.g. a scheduled
+// album rotates independently from the device's full source.
+func (f photoFilter) pool() string {
+	if f.AlbumID != "" {
+		return f.Source + ":" + f.AlbumID
+	}
+	return f.Source
+}
+
+// applySourceFilter adds source-specific WHERE clauses to the query and limits
+// it to the photos assigned to the device (or shared by all devices).
 // For URL proxy sources, it fetches the image directly and returns it as
 // earlyResult (the caller should return immediately).
-func (h *ImageHandler) applySourceFilter(query *gorm.DB, sourceFilter string, deviceID *uint) (*gorm.DB, image.Image, error) {
-	switch sourceFilter {
+func (h *ImageHandler) applySourceFilter(query *gorm.DB, filter photoFilter, deviceID *uint) (*gorm.DB, image.Image, error) {
+	switch filter.Source {
 	case model.SourceGooglePhotos, model.SourceSynologyPhotos, model.SourceTelegram, model.SourceImmich:
-		return query.Where("source = ?", sourceFilter), nil, nil
+		// Near-duplicates the user chose not to keep
+		query = query.Where("source = ? AND duplicate_of IS NULL", filter.Source)
+		// Photos scoring below the cutoff; unanalyzed ones are allowed
+		if minScore := service.MinQualityScore(h.settings); minScore > 0 {
+			query = query.Where("(quality_score IS NULL OR quality_score >= ?)", minScore)
+		}
+		if filter.AlbumID != "" {
+			query = query.Where("album_id = ?", filter.AlbumID)
+		}
+		return h.assignments.ScopeToDevice(query, deviceID), nil, nil
 	case model.SourceURLProxy:
 		img, _, err := h.fetchRandomURLProxy(deviceID)
 		return nil, img, err
 	default:
-		return nil, nil, fmt.Errorf("invalid source filter: %s", sourceFilter)
+		return nil, nil, fmt.Errorf("invalid source filter: %s", filter.Source)
 	}
 }
 
@@ -663,7 +1234,7 @@ func (h *ImageHandler) fetchImmichPhoto(item model.Image) (image.Image, uint, er
 	if err != nil {
 		return nil, 0, err
 	}
-	img, _, err := image.Decode(bytes.NewReader(data))
+	img, _, err := imageops.DecodeBytes(data)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -671,27 +1242,59 @@ func (h *ImageHandler) fetchImmichPhoto(item model.Image) (image.Image, uint, er
 }
 
 // loadImageFromRecord loads an image from a database record, handling both
-// local files and Synology/Immich photos.
+// local files and Synology/Immich photos. The image carries the photo's focus
+// point for cropping.
 func (h *ImageHandler) loadImageFromRecord(item model.Image) (image.Image, error) {
-	if item.Source == model.SourceSynologyPhotos {
-		img, _, err := h.fetchSynologyPhoto(item)
-		return img, err
-	}
-
-	if item.Source == model.SourceImmich {
-		img, _, err := h.fetchImmichPhoto(item)
-		return img, err
+	var img image.Image
+	var err error
+	switch item.Source {
+	case model.SourceSynologyPhotos:
+		img, _, err = h.fetchSynologyPhoto(item)
+	case model.SourceImmich:
+		img, _, err = h.fetchImmichPhoto(item)
+	default:
+		resolvedPath := h.resolvePath(item.FilePath)
+		f, openErr := os.Open(resolvedPath)
+		if openErr != nil {
+			return nil, fmt.Errorf("failed to open %s (resolved: %s): %w", item.FilePath, resolvedPath, openErr)
+		}
+		defer f.Close()
+		var format string
+		img, format, err = imageops.Decode(f)
+		// Photos imported before formats were recorded
+		if err == nil && item.Format == "" {
+			h.db.Model(&model.Image{}).Where("id = ?", item.ID).Update("format", format)
+		}
 	}
-
-	resolvedPath := h.resolvePath(item.FilePath)
-	f, err := os.Open(resolvedPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open %s (resolved: %s): %w", item.FilePath, resolvedPath, err)
+		return nil, err
 	}
-	defer f.Close()
+	return h.withFraming(item, img), nil
+}
 
-	img, _, err := image.Decode(f)
-	return img, err
+// withFraming attaches the photo's focus point and manual crop windows,
+// finding the focus and caching it on the image record the first time the
+// photo is cropped, and again once a better detector is available (e.g. a
+// face cascade was added after the focus was found from saliency).
+func (h *ImageHandler) withFraming(item model.Image, img image.Image) image.Image {
+	framing := imageops.Framing{
+		Landscape: (*imageops.Crop)(item.CropLandscape),
+		Portrait:  (*imageops.Crop)(item.CropPortrait),
+	}
+	if item.FocusX != nil && item.FocusY != nil && !imageops.FocusOutdated(item.FocusSource) {
+		framing.Focus = imageops.Focus{X: *item.FocusX, Y: *item.FocusY}
+		return imageops.WithFraming(img, framing)
+	}
+	source := imageops.FocusDetector()
+	framing.Focus = imageops.FindFocus(img)
+	if err := h.db.Model(&model.Image{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+		"focus_x":      framing.Focus.X,
+		"focus_y":      framing.Focus.Y,
+		"focus_source": source,
+	}).Error; err != nil {
+		log.Printf("Failed to cache focus of image %d: %v", item.ID, err)
+	}
+	return imageops.WithFraming(img, framing)
 }
 
 func (h *ImageHandler) fetchPlaceholder() (image.Image, error) {
@@ -701,7 +1304,7 @@ func (h *ImageHandler) fetchPlaceholder() (image.Image, error) {
 	}
 	defer resp.Body.Close()
 
-	img, _, err := image.Decode(resp.Body)
+	img, _, err := imageops.Decode(resp.Body)
 	return img, err
 }
 
@@ -714,7 +1317,7 @@ func (h *ImageHandler) fetchURLPhoto(url string) (image.Image, uint, error) {
 	}
 	defer resp.Body.Close()
 
-	img, _, err := image.Decode(resp.Body)
+	img, _, err := imageops.Decode(resp.Body)
 	if err != nil {
 		fmt.Printf("Failed to decode URL photo: %v\n", err)
 		return nil, 0, err
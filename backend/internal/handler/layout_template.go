@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"image/jpeg"
+	"net/http"
+	"strconv"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type LayoutTemplateHandler struct {
+	templates *service.LayoutTemplateService
+	renderer  *service.RendererService
+	widgets   *service.WidgetRegistry
+	db        *gorm.DB
+}
+
+func NewLayoutTemplateHandler(templates *service.LayoutTemplateService, renderer *service.RendererService, widgets *service.WidgetRegistry, db *gorm.DB) *LayoutTemplateHandler {
+	return &LayoutTemplateHandler{templates: templates, renderer: renderer, widgets: widgets, db: db}
+}
+
+type LayoutTemplateRequest struct {
+	Name   string            `json:"name"`
+	HTML   string            `json:"html"`
+	Fields map[string]string `json:"fields"`
+}
+
+func (r *LayoutTemplateRequest) apply(t *model.LayoutTemplate) {
+	t.Name = r.Name
+	t.HTML = r.HTML
+	t.Fields = r.Fields
+}
+
+func (h *LayoutTemplateHandler) findTemplate(c echo.Context) (*model.LayoutTemplate, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return h.templates.GetTemplate(uint(id))
+}
+
+// GET /api/layout-templates
+func (h *LayoutTemplateHandler) ListTemplates(c echo.Context) error {
+	templates, err := h.templates.ListTemplates()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, templates)
+}
+
+// GET /api/layout-templates/:id
+func (h *LayoutTemplateHandler) GetTemplate(c echo.Context) error {
+	t, err := h.findTemplate(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "template not found"})
+	}
+	return c.JSON(http.StatusOK, t)
+}
+
+// POST /api/layout-templates
+// e.g. {"name": "Quote", "html": "<html>...{{.Fields.quote}}...</html>", "fields": {"quote": "Carpe diem"}}
+// The HTML is executed with the same data as the built-in layouts, plus
+// DeviceName and the template's Fields. Widgets holds the drawn widgets by
+// placement, WidgetData what each fetched by name.
+func (h *LayoutTemplateHandler) CreateTemplate(c echo.Context) error {
+	var req LayoutTemplateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	var t model.LayoutTemplate
+	req.apply(&t)
+	if err := h.templates.CreateTemplate(&t); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, t)
+}
+
+// PUT /api/layout-templates/:id
+func (h *LayoutTemplateHandler) UpdateTemplate(c echo.Context) error {
+	t, err := h.findTemplate(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "template not found"})
+	}
+	var req LayoutTemplateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	req.apply(t)
+	if err := h.templates.UpdateTemplate(t); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, t)
+}
+
+// DELETE /api/layout-templates/:id
+// Devices using the template go back to their built-in layout.
+func (h *LayoutTemplateHandler) DeleteTemplate(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.templates.DeleteTemplate(uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "template not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+type LayoutPreviewRequest struct {
+	TemplateID *uint             `json:"template_id"` // Saved template, ignored when HTML is set
+	HTML       string            `json:"html"`
+	Fields     map[string]string `json:"fields"`
+	Width      int               `json:"width"` // Defaults to 800x480
+	Height     int               `json:"height"`
+}
+
+// POST /api/layout-templates/preview
+// Renders a saved template, or unsaved HTML while it is being edited, with
+// a placeholder photo and sample data for every widget, as a JPEG.
+// GET /api/devices/:id/preview?template_id= previews a saved template with
+// the device's real photos and data.
+func (h *LayoutTemplateHandler) PreviewTemplate(c echo.Context) error {
+	var req LayoutPreviewRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if req.HTML == "" && req.TemplateID != nil {
+		t, err := h.templates.GetTemplate(*req.TemplateID)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "template not found"})
+		}
+		req.HTML = t.HTML
+		if req.Fields == nil {
+			req.Fields = t.Fields
+		}
+	}
+	if req.HTML == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "html or template_id required"})
+	}
+	if req.Width <= 0 || req.Height <= 0 {
+		req.Width, req.Height = 800, 480
+	}
+	if req.Width > 4096 || req.Height > 4096 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid size"})
+	}
+	if err := service.ValidateLayoutTemplate(req.HTML, req.Fields, h.widgets); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if !h.renderer.ChromeAvailable() {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "layout templates need chromium/chrome, which is not installed"})
+	}
+
+	opts := h.widgets.SampleRenderOptions(req.Width, req.Height)
+	opts.Template = req.HTML
+	opts.Fields = req.Fields
+	img, err := h.renderer.Render(opts)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.Blob(http.StatusOK, "image/jpeg", buf.Bytes())
+}
+
+type DeviceLayoutTemplateRequest struct {
+	TemplateID *uint `json:"template_id"` // null for the built-in layouts
+}
+
+// GET /api/devices/:id/layout-template
+func (h *LayoutTemplateHandler) GetDeviceTemplate(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	return c.JSON(http.StatusOK, DeviceLayoutTemplateRequest{TemplateID: device.LayoutTemplateID})
+}
+
+// PUT /api/devices/:id/layout-template
+// e.g. {"template_id": 2}, or {"template_id": null} for the device's
+// built-in layout.
+func (h *LayoutTemplateHandler) SetDeviceTemplate(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	var req DeviceLayoutTemplateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := h.templates.SetDeviceTemplate(&device, req.TemplateID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "template not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, DeviceLayoutTemplateRequest{TemplateID: device.LayoutTemplateID})
+}
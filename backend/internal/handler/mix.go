@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type MixHandler struct {
+	mix *service.MixService
+	db  *gorm.DB
+}
+
+func NewMixHandler(mix *service.MixService, db *gorm.DB) *MixHandler {
+	return &MixHandler{mix: mix, db: db}
+}
+
+type SourceWeightsRequest struct {
+	Weights map[string]int `json:"weights"`
+}
+
+// GET /api/devices/:id/source-weights
+func (h *MixHandler) GetSourceWeights(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	weights, err := h.mix.GetWeights(device.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, weights)
+}
+
+// PUT /api/devices/:id/source-weights
+// e.g. {"weights": {"immich": 3, "synology_photos": 2, "url_proxy": 1}}
+func (h *MixHandler) SetSourceWeights(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	var req SourceWeightsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := h.mix.SetWeights(device.ID, req.Weights); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	weights, err := h.mix.GetWeights(device.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, weights)
+}
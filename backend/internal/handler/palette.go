@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/photoframe"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type PaletteHandler struct {
+	deviceService *service.DeviceService
+	db            *gorm.DB
+}
+
+func NewPaletteHandler(deviceService *service.DeviceService, db *gorm.DB) *PaletteHandler {
+	return &PaletteHandler{deviceService: deviceService, db: db}
+}
+
+// DevicePaletteRequest sets either a built-in preset or a custom set of inks.
+type DevicePaletteRequest struct {
+	Preset  string              `json:"preset"`
+	Palette *photoframe.Palette `json:"palette"`
+}
+
+// GET /api/palettes
+func (h *PaletteHandler) ListPresets(c echo.Context) error {
+	return c.JSON(http.StatusOK, service.PalettePresets())
+}
+
+// GET /api/devices/:id/palette
+// Returns the configured palette, or null when the device's own is used.
+func (h *PaletteHandler) GetDevicePalette(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	return c.JSON(http.StatusOK, service.DevicePalette(&device, nil))
+}
+
+// PUT /api/devices/:id/palette
+// e.g. {"preset": "gray4"} or {"palette": {"black": {"r": 10, "g": 10, "b": 10}, "white": {...}}}
+func (h *PaletteHandler) SetDevicePalette(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	var req DevicePaletteRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	palette := req.Palette
+	if req.Preset != "" {
+		preset, ok := service.PalettePresets()[req.Preset]
+		if !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "unknown palette preset: " + req.Preset})
+		}
+		palette = &preset
+	}
+	if palette == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "preset or palette required"})
+	}
+
+	if err := h.deviceService.SetPalette(&device, palette); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, service.DevicePalette(&device, nil))
+}
+
+// DELETE /api/devices/:id/palette
+// Goes back to the palette reported by the device.
+func (h *PaletteHandler) ClearDevicePalette(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	if err := h.deviceService.SetPalette(&device, nil); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
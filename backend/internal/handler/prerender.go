@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
+)
+
+// prerenderer prepares each device's next frame in the background right after
+// a serve, so the following wake-up is answered from the render cache instead
+// of waiting for the download, Chrome render and dithering (or a minute-long
+// AI generation).
+//
+// Only the picked photo is kept in memory; the rendered frame lives in the
+// render cache. At serve time the overlay is recomputed, so a stale date or
+// weather just re-renders the kept photo instead of serving outdated data. A
+// pre-rendered photo is dropped when the device's settings or request
+// parameters changed since it was prepared.
+//
+// The photo's shuffle bag draws are only marked played when it is served, so
+// a dropped photo, or one lost to a restart, stays in the current cycle.
+type prerenderer struct {
+	h *ImageHandler
+
+	mu       sync.Mutex
+	pending  map[uint]*prerenderedPhoto
+	inFlight map[uint]bool
+	requests map[uint]int // Frame requests per device, see Schedule
+}
+
+type prerenderedPhoto struct {
+	settingsKey  string
+	selectionKey string
+	photo        *pickedPhoto
+	preparedAt   time.Time
+}
+
+func newPrerenderer(h *ImageHandler) *prerenderer {
+	return &prerenderer{
+		h:        h,
+		pending:  make(map[uint]*prerenderedPhoto),
+		inFlight: make(map[uint]bool),
+		requests: make(map[uint]int),
+	}
+}
+
+// Take returns and consumes the device's pre-rendered photo if it was
+// prepared for the same settings as req.
+func (p *prerenderer) Take(req *frameRequest) *pickedPhoto {
+	if req.Device == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests[req.Device.ID]++
+	next, ok := p.pending[req.Device.ID]
+	if !ok {
+		return nil
+	}
+	delete(p.pending, req.Device.ID)
+	if next.settingsKey != prerenderSettingsKey(req) {
+		log.Printf("Prerender: discarding next frame for device %d, settings changed", req.Device.ID)
+		return nil
+	}
+	log.Printf("Prerender: serving next frame for device %d prepared %v ago", req.Device.ID, time.Since(next.preparedAt).Round(time.Second))
+	return next.photo
+}
+
+// Peek returns the device's pre-rendered photo without consuming it, if it
+// was picked for the same source and dimensions as req. Unlike Take, it
+// ignores overlay and processing settings, which don't affect the pick.
+func (p *prerenderer) Peek(req *frameRequest) *pickedPhoto {
+	if req.Device == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	next, ok := p.pending[req.Device.ID]
+	if !ok || next.selectionKey != prerenderSelectionKey(req) {
+		return nil
+	}
+	return next.photo
+}
+
+// Schedule starts preparing the device's next frame unless one is already
+// pending or being prepared. shown are the library photos of the frame just
+// sent, which the history may not have recorded yet. A frame requested while the next one is still
+// being prepared picks the same photo, so the prepared one is then dropped
+// rather than shown twice.
+func (p *prerenderer) Schedule(req *frameRequest, shown []uint) {
+	if req.Device == nil || !prerenderable(req.Source) {
+		return
+	}
+	deviceID := req.Device.ID
+
+	p.mu.Lock()
+	if p.inFlight[deviceID] || p.pending[deviceID] != nil {
+		p.mu.Unlock()
+		return
+	}
+	p.inFlight[deviceID] = true
+	requests := p.requests[deviceID]
+	p.mu.Unlock()
+	if shown == nil {
+		shown = []uint{}
+	}
+
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			delete(p.inFlight, deviceID)
+			p.mu.Unlock()
+		}()
+
+		start := time.Now()
+		photo, err := p.h.pickPhoto(req, shown)
+		if err != nil {
+			log.Printf("Prerender: failed to pick next photo for device %d: %v", deviceID, err)
+			return
+		}
+		// Mix may land on a live source; those must be fetched at serve time
+		if !prerenderable(photo.Source) {
+			return
+		}
+		if _, err := p.h.buildFrame(p.h.prepareFrame(req, photo)); err != nil {
+			log.Printf("Prerender: failed to render next frame for device %d: %v", deviceID, err)
+			return
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.requests[deviceID] != requests {
+			log.Printf("Prerender: discarding next frame for device %d, a frame was requested meanwhile", deviceID)
+			return
+		}
+		p.pending[deviceID] = &prerenderedPhoto{
+			settingsKey:  prerenderSettingsKey(req),
+			selectionKey: prerenderSelectionKey(req),
+			photo:        photo,
+			preparedAt:   time.Now(),
+		}
+		log.Printf("Prerender: next frame for device %d ready in %v", deviceID, time.Since(start))
+	}()
+}
+
+// prerenderable reports whether a source's photo can be prepared ahead of
+// time. Telegram and URL proxy always show the latest content, and the
+// dashboard has no photo to prepare.
+func prerenderable(source string) bool {
+	return source != model.SourceTelegram && source != model.SourceURLProxy && source != model.SourceDashboard
+}
+
+// prerenderSettingsKey covers the device's stored settings and everything
+// resolved from the request, so any change invalidates the prepared photo.
+func prerenderSettingsKey(req *frameRequest) string {
+	return service.CacheKey(req)
+}
+
+// prerenderSelectionKey covers only what decides which photo is picked.
+func prerenderSelectionKey(req *frameRequest) string {
+	return service.CacheKey(req.deviceID(), req.Source, req.Filter, req.LogicalW, req.LogicalH, req.EnableCollage, req.Collage.Layout)
+}
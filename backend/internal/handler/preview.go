@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image/jpeg"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/photoframe"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type FramePreviewResponse struct {
+	Source      string `json:"source"`
+	ImageIDs    []uint `json:"image_ids"`
+	Layout      string `json:"layout"`
+	TemplateID  *uint  `json:"template_id"` // User-defined layout used instead of Layout
+	DisplayMode string `json:"display_mode"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Image       string `json:"image"`   // Dithered PNG as sent to the device, data URL
+	Preview     string `json:"preview"` // Perceptual JPEG preview, data URL
+}
+
+// GET /api/devices/:id/preview?source=immich
+// Optional overrides: layout, template_id, display_mode, orientation,
+// processing_settings and color_palette (JSON, same format as the X-Processing-Settings and
+// X-Color-Palette headers).
+//
+// PreviewFrame runs the same selection, render and processing as ServeImage
+// for the device but records no history and leaves its shuffle bags, the
+// render cache and the pre-rendered frame untouched. AI generation shows a
+// placeholder unless a generated image is already pre-rendered.
+func (h *ImageHandler) PreviewFrame(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+
+	source := c.QueryParam("source")
+	if source == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "source required"})
+	}
+
+	overrides := frameOverrides{
+		Orientation: c.QueryParam("orientation"),
+		Layout:      c.QueryParam("layout"),
+		DisplayMode: c.QueryParam("display_mode"),
+	}
+	switch overrides.Layout {
+	case "", model.LayoutPhotoInfo, model.LayoutPhotoOverlay, model.LayoutSidePanel, model.LayoutDashboard:
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid layout"})
+	}
+	if s := c.QueryParam("template_id"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid template_id"})
+		}
+		templateID := uint(id)
+		overrides.TemplateID = &templateID
+	}
+	switch overrides.DisplayMode {
+	case "", "cover", "contain":
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid display_mode"})
+	}
+	if s := c.QueryParam("processing_settings"); s != "" {
+		overrides.Settings = &photoframe.ProcessingSettings{}
+		if err := json.Unmarshal([]byte(s), overrides.Settings); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid processing_settings"})
+		}
+	}
+	if s := c.QueryParam("color_palette"); s != "" {
+		overrides.Palette = &photoframe.Palette{}
+		if err := json.Unmarshal([]byte(s), overrides.Palette); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid color_palette"})
+		}
+	}
+
+	dry := h.dryRun()
+	req, status, err := dry.newFrameRequest(source, &device, overrides)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	// The pre-rendered photo is what the device shows next, when there is one
+	photo := h.prerender.Peek(req)
+	if photo == nil {
+		photo, err = dry.pickPhoto(req, nil)
+		if err != nil {
+			if strings.Contains(err.Error(), "invalid source filter") {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "invalid source"})
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) || strings.Contains(err.Error(), "record not found") {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "no photos found for this device"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to fetch photo: " + err.Error()})
+		}
+	}
+
+	rendered, err := dry.buildFrame(dry.prepareFrame(req, photo))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	resp := FramePreviewResponse{
+		Source:      photo.Source,
+		ImageIDs:    photo.IDs,
+		Layout:      req.Layout,
+		DisplayMode: req.DisplayMode,
+		Width:       req.LogicalW,
+		Height:      req.LogicalH,
+		Image:       "data:image/png;base64," + base64.StdEncoding.EncodeToString(rendered.Image),
+	}
+	if req.Template != nil {
+		resp.TemplateID = &req.Template.ID
+	}
+	if rendered.Thumbnail != nil {
+		resp.Preview = "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(rendered.Thumbnail)
+	}
+	if resp.ImageIDs == nil {
+		resp.ImageIDs = []uint{}
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// dryRun returns a copy of the handler whose photo draws don't advance any
+// shuffle bag and that shows a placeholder instead of generating AI images.
+func (h *ImageHandler) dryRun() *ImageHandler {
+	dry := *h
+	dry.shuffle = h.shuffle.DryRun()
+	dry.preview = true
+	return &dry
+}
+
+// GET /api/gallery/photos/:id/framing/preview?device_id=3
+// Optional: orientation, or width and height instead of a device.
+//
+// PreviewCrop shows how a photo is cropped to fill the device's screen, with
+// its focus point and manual crop windows applied, as a JPEG.
+func (h *ImageHandler) PreviewCrop(c echo.Context) error {
+	var item model.Image
+	if err := h.db.First(&item, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "photo not found"})
+	}
+
+	overrides := frameOverrides{Orientation: c.QueryParam("orientation")}
+	overrides.Width, _ = strconv.Atoi(c.QueryParam("width"))
+	overrides.Height, _ = strconv.Atoi(c.QueryParam("height"))
+	var device *model.Device
+	if deviceID := c.QueryParam("device_id"); deviceID != "" {
+		device = &model.Device{}
+		if err := h.db.First(device, deviceID).Error; err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+		}
+	}
+	req, status, err := h.newFrameRequest(item.Source, device, overrides)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	img, err := h.loadImageFromRecord(item)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to load photo: " + err.Error()})
+	}
+	dst := imageops.ResizeToFill(img, req.LogicalW, req.LogicalH)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to encode preview"})
+	}
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	return c.Blob(http.StatusOK, "image/jpeg", buf.Bytes())
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type RefreshHandler struct {
+	refresh *service.RefreshService
+	db      *gorm.DB
+}
+
+func NewRefreshHandler(refresh *service.RefreshService, db *gorm.DB) *RefreshHandler {
+	return &RefreshHandler{refresh: refresh, db: db}
+}
+
+type RefreshPolicyResponse struct {
+	service.RefreshPolicy
+	NextRefreshSeconds int `json:"next_refresh_seconds"`
+}
+
+// GET /api/devices/:id/refresh-policy
+func (h *RefreshHandler) GetRefreshPolicy(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	return c.JSON(http.StatusOK, h.policyResponse(&device))
+}
+
+// PUT /api/devices/:id/refresh-policy
+// e.g. {"refresh_interval_minutes": 60, "quiet_start_minute": 1380, "quiet_end_minute": 420, "wake_for_events": true, "event_wake_delay_minutes": 2}
+func (h *RefreshHandler) UpdateRefreshPolicy(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	var req service.RefreshPolicy
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := h.refresh.SetPolicy(&device, req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, h.policyResponse(&device))
+}
+
+// POST /api/devices/:id/refresh-policy/push
+func (h *RefreshHandler) PushRefreshPolicy(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	if device.RefreshIntervalMinutes == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "device has no refresh policy"})
+	}
+	interval, err := h.refresh.Push(&device)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to push config: " + err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]int{"rotate_interval": int(interval.Seconds())})
+}
+
+func (h *RefreshHandler) policyResponse(device *model.Device) RefreshPolicyResponse {
+	return RefreshPolicyResponse{
+		RefreshPolicy:      service.DevicePolicy(device),
+		NextRefreshSeconds: int(h.refresh.NextRefresh(device, nil).Seconds()),
+	}
+}
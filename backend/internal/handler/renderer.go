@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type RendererHandler struct {
+	deviceService *service.DeviceService
+	renderer      *service.RendererService
+	db            *gorm.DB
+}
+
+func NewRendererHandler(deviceService *service.DeviceService, renderer *service.RendererService, db *gorm.DB) *RendererHandler {
+	return &RendererHandler{deviceService: deviceService, renderer: renderer, db: db}
+}
+
+type DeviceRendererRequest struct {
+	Renderer string `json:"renderer"` // "chrome" or "native", empty = Chrome when installed
+}
+
+type DeviceRendererResponse struct {
+	Renderer        string `json:"renderer"`
+	Engine          string `json:"engine"` // What frames are rendered with
+	ChromeAvailable bool   `json:"chrome_available"`
+}
+
+// GET /api/renderer
+// Reports the Chrome render pool: queue depth, render latency, failures and
+// browser relaunches.
+func (h *RendererHandler) GetStatus(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.renderer.Stats())
+}
+
+// GET /api/devices/:id/renderer
+func (h *RendererHandler) GetDeviceRenderer(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	return c.JSON(http.StatusOK, h.response(&device))
+}
+
+// PUT /api/devices/:id/renderer
+// e.g. {"renderer": "native"} draws the built-in layouts without Chrome.
+// Devices on Chrome fall back to the native renderer when it is missing;
+// user-defined layout templates are only rendered by Chrome.
+func (h *RendererHandler) SetDeviceRenderer(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	var req DeviceRendererRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := h.deviceService.SetRenderer(&device, req.Renderer); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, h.response(&device))
+}
+
+func (h *RendererHandler) response(device *model.Device) DeviceRendererResponse {
+	return DeviceRendererResponse{
+		Renderer:        device.Renderer,
+		Engine:          h.renderer.Engine(device.Renderer),
+		ChromeAvailable: h.renderer.ChromeAvailable(),
+	}
+}
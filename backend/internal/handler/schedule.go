@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type ScheduleHandler struct {
+	schedules *service.ScheduleService
+	db        *gorm.DB
+}
+
+func NewScheduleHandler(schedules *service.ScheduleService, db *gorm.DB) *ScheduleHandler {
+	return &ScheduleHandler{schedules: schedules, db: db}
+}
+
+type ScheduleRequest struct {
+	Name        string `json:"name"`
+	Days        int    `json:"days"`
+	StartMinute int    `json:"start_minute"`
+	EndMinute   int    `json:"end_minute"`
+	Source      string `json:"source"`
+	AlbumID     string `json:"album_id"`
+	Layout      string `json:"layout"`
+	Priority    int    `json:"priority"`
+	Enabled     *bool  `json:"enabled"` // defaults to true
+}
+
+func (r *ScheduleRequest) apply(schedule *model.DeviceSchedule) {
+	schedule.Name = r.Name
+	schedule.Days = r.Days
+	schedule.StartMinute = r.StartMinute
+	schedule.EndMinute = r.EndMinute
+	schedule.Source = r.Source
+	schedule.AlbumID = r.AlbumID
+	schedule.Layout = r.Layout
+	schedule.Priority = r.Priority
+	schedule.Enabled = r.Enabled == nil || *r.Enabled
+}
+
+func (h *ScheduleHandler) findDevice(c echo.Context) (*model.Device, error) {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// GET /api/devices/:id/schedules
+func (h *ScheduleHandler) ListSchedules(c echo.Context) error {
+	device, err := h.findDevice(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	schedules, err := h.schedules.ListSchedules(device.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, schedules)
+}
+
+// POST /api/devices/:id/schedules
+func (h *ScheduleHandler) CreateSchedule(c echo.Context) error {
+	device, err := h.findDevice(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	var req ScheduleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	schedule := model.DeviceSchedule{DeviceID: device.ID}
+	req.apply(&schedule)
+	if err := h.schedules.CreateSchedule(&schedule); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, schedule)
+}
+
+// PUT /api/devices/:id/schedules/:scheduleId
+func (h *ScheduleHandler) UpdateSchedule(c echo.Context) error {
+	device, err := h.findDevice(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	var schedule model.DeviceSchedule
+	if err := h.db.Where("device_id = ?", device.ID).First(&schedule, c.Param("scheduleId")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "schedule not found"})
+	}
+	var req ScheduleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+
+	req.apply(&schedule)
+	if err := h.schedules.UpdateSchedule(&schedule); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, schedule)
+}
+
+// DELETE /api/devices/:id/schedules/:scheduleId
+func (h *ScheduleHandler) DeleteSchedule(c echo.Context) error {
+	device, err := h.findDevice(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	id, _ := strconv.Atoi(c.Param("scheduleId"))
+	if err := h.schedules.DeleteSchedule(device.ID, uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "schedule not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// GET /api/devices/:id/schedules/active
+// Reports the entry a device using the schedule source would display now.
+func (h *ScheduleHandler) GetActiveSchedule(c echo.Context) error {
+	device, err := h.findDevice(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	now := time.Now().In(service.DeviceLocation(device))
+	active, err := h.schedules.ActiveSchedule(device, now)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"active":     active,
+		"device_now": now.Format(time.RFC3339),
+		"timezone":   now.Location().String(),
+	})
+}
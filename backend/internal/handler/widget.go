@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type WidgetHandler struct {
+	deviceService *service.DeviceService
+	widgets       *service.WidgetRegistry
+	db            *gorm.DB
+}
+
+func NewWidgetHandler(deviceService *service.DeviceService, widgets *service.WidgetRegistry, db *gorm.DB) *WidgetHandler {
+	return &WidgetHandler{deviceService: deviceService, widgets: widgets, db: db}
+}
+
+type WidgetInfo struct {
+	Name             string `json:"name"`
+	DefaultPlacement string `json:"default_placement"`
+	TTLSeconds       int    `json:"ttl_seconds"`
+}
+
+type DeviceWidgetsRequest struct {
+	Widgets []model.WidgetPlacement `json:"widgets"`
+}
+
+// GET /api/widgets
+func (h *WidgetHandler) ListWidgets(c echo.Context) error {
+	widgets := []WidgetInfo{}
+	for _, w := range h.widgets.Widgets() {
+		widgets = append(widgets, WidgetInfo{
+			Name:             w.Name(),
+			DefaultPlacement: w.DefaultPlacement(),
+			TTLSeconds:       int(w.TTL().Seconds()),
+		})
+	}
+	return c.JSON(http.StatusOK, widgets)
+}
+
+// GET /api/devices/:id/widgets
+func (h *WidgetHandler) GetDeviceWidgets(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	return c.JSON(http.StatusOK, deviceWidgetsResponse(&device))
+}
+
+// PUT /api/devices/:id/widgets
+// e.g. {"widgets": [{"widget": "date", "placement": "primary"}, {"widget": "weather"}]}
+// Widgets are drawn in list order; an empty placement uses the widget's
+// default.
+func (h *WidgetHandler) SetDeviceWidgets(c echo.Context) error {
+	var device model.Device
+	if err := h.db.First(&device, c.Param("id")).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "device not found"})
+	}
+	var req DeviceWidgetsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+	}
+	if err := h.deviceService.SetWidgets(&device, req.Widgets); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, deviceWidgetsResponse(&device))
+}
+
+func deviceWidgetsResponse(device *model.Device) DeviceWidgetsRequest {
+	widgets := service.DeviceWidgets(device)
+	if widgets == nil {
+		widgets = []model.WidgetPlacement{}
+	}
+	return DeviceWidgetsRequest{Widgets: widgets}
+}
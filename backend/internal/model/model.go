@@ -18,23 +18,67 @@ const (
 	SourceURLProxy       = "url_proxy"
 	SourceAIGeneration   = "ai_generation"
 	SourceImmich         = "immich"
+	SourceSchedule       = "schedule"  // resolved per request from the device's schedule
+	SourceMix            = "mix"       // weighted rotation across several sources
+	SourceDashboard      = "dashboard" // the dashboard layout's widgets alone, no photo
 )
 
 type Image struct {
-	ID              uint           `gorm:"primaryKey" json:"id"`
-	FilePath        string         `json:"file_path"`
-	Caption         string         `json:"caption"`
-	Width           int            `json:"width"`
-	Height          int            `json:"height"`
-	Orientation     string         `json:"orientation"` // "landscape", "portrait"
-	UserID          int64          `json:"user_id"`
-	Status          string         `json:"status"` // pending, shown
-	Source          string         `json:"source"` // "local", "google_photos", "synology_photos"
-	SynologyPhotoID int            `json:"synology_id"`
-	ThumbnailKey    string         `json:"thumbnail_key"`   // Cache key for Synology
-	ImmichAssetID   string         `json:"immich_asset_id"` // UUID for Immich assets
-	CreatedAt       time.Time      `json:"created_at"`
-	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+	ID              uint   `gorm:"primaryKey" json:"id"`
+	FilePath        string `json:"file_path"`
+	Caption         string `json:"caption"`
+	Width           int    `json:"width"`
+	Height          int    `json:"height"`
+	Orientation     string `json:"orientation"` // "landscape", "portrait"
+	UserID          int64  `json:"user_id"`
+	Status          string `json:"status"` // pending, shown
+	Source          string `json:"source"` // "local", "google_photos", "synology_photos"
+	SynologyPhotoID int    `json:"synology_id"`
+	ThumbnailKey    string `json:"thumbnail_key"`   // Cache key for Synology
+	ImmichAssetID   string `json:"immich_asset_id"` // UUID for Immich assets
+	AlbumID         string `json:"album_id"`        // Source album the photo was synced from
+	Favorite        bool   `json:"favorite"`
+	Rating          int    `json:"rating"` // 0 = unrated, 1-5 stars
+	Format          string `json:"format"` // Original file format: "jpeg", "heic", "webp", "avif", ... empty = unknown
+	// FocusX/FocusY is the point crops keep in frame (faces or the most
+	// salient region, or set by hand) as fractions of the width and height,
+	// nil until the photo is first cropped.
+	FocusX *float64 `json:"focus_x"`
+	FocusY *float64 `json:"focus_y"`
+	// FocusSource is how the focus was found: "saliency", "faces" or
+	// "manual" (see imageops.FocusOutdated).
+	FocusSource string `json:"focus_source"`
+	// CropLandscape/CropPortrait are windows set by hand that crops for
+	// landscape and portrait frames stay within, nil to use the whole photo.
+	CropLandscape *Crop `gorm:"serializer:json" json:"crop_landscape"`
+	CropPortrait  *Crop `gorm:"serializer:json" json:"crop_portrait"`
+	// PHash is the 64-bit perceptual hash as 16 hex digits, empty until the
+	// analyzer gets to the photo. DuplicateOf is set on near-duplicates the
+	// user chose not to keep and hides them from rotation.
+	PHash       string `gorm:"column:phash" json:"phash"`
+	DuplicateOf *uint  `json:"duplicate_of"`
+	// Quality metrics from the analyzer (see imageops.Quality). QualityScore
+	// is 0-100, nil until analyzed; QualityIssues lists what lowered it,
+	// comma separated.
+	QualityScore  *float64 `json:"quality_score"`
+	Sharpness     float64  `json:"sharpness"`
+	Exposure      float64  `json:"exposure"`
+	Colorfulness  float64  `json:"colorfulness"`
+	Screenshot    bool     `json:"screenshot"`
+	QualityIssues string   `json:"quality_issues"`
+	// TakenAt is the capture wall-clock time stored as UTC (no timezone
+	// conversion), nil when unknown. CreatedAt is the import time.
+	TakenAt   *time.Time     `gorm:"index" json:"taken_at"`
+	CreatedAt time.Time      `json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Crop is a window of a photo as fractions of its width and height.
+type Crop struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	W float64 `json:"w"`
+	H float64 `json:"h"`
 }
 
 type GoogleAuth struct {
@@ -52,35 +96,106 @@ type GoogleCalendarAuth struct {
 }
 
 type Device struct {
-	ID                 uint      `gorm:"primaryKey" json:"id"`
-	Name               string    `json:"name"`
-	Host               string    `json:"host"` // IP or Hostname
-	Width              int       `json:"width"`
-	Height             int       `json:"height"`
-	UseDeviceParameter bool      `json:"use_device_parameter"`
-	Orientation        string    `json:"orientation"`
-	EnableCollage      bool      `json:"enable_collage"` // Per-device collage setting
-	ShowDate           bool      `json:"show_date"`
-	ShowWeather        bool      `json:"show_weather"`
-	WeatherLat         float64   `json:"weather_lat"`
-	WeatherLon         float64   `json:"weather_lon"`
-	AIProvider         string    `gorm:"column:ai_provider" json:"ai_provider"`
-	AIModel            string    `gorm:"column:ai_model" json:"ai_model"`
-	AIPrompt           string    `gorm:"column:ai_prompt" json:"ai_prompt"`
-	Layout             string    `json:"layout"`       // "photo_info", "photo_overlay", "side_panel"
-	DisplayMode        string    `json:"display_mode"` // "cover" or "contain"
-	ShowCalendar       bool      `json:"show_calendar"`
-	CalendarID         string    `json:"calendar_id"` // Google Calendar ID (per-device)
-	DateFormat         string    `json:"date_format"` // Go time format string, empty = default "Mon, Jan 02"
-	CreatedAt          time.Time `json:"created_at"`
+	ID                     uint      `gorm:"primaryKey" json:"id"`
+	Name                   string    `json:"name"`
+	Host                   string    `json:"host"` // IP or Hostname
+	Width                  int       `json:"width"`
+	Height                 int       `json:"height"`
+	UseDeviceParameter     bool      `json:"use_device_parameter"`
+	Orientation            string    `json:"orientation"`
+	EnableCollage          bool      `json:"enable_collage"` // Per-device collage setting
+	ShowDate               bool      `json:"show_date"`
+	ShowWeather            bool      `json:"show_weather"`
+	WeatherLat             float64   `json:"weather_lat"`
+	WeatherLon             float64   `json:"weather_lon"`
+	AIProvider             string    `gorm:"column:ai_provider" json:"ai_provider"`
+	AIModel                string    `gorm:"column:ai_model" json:"ai_model"`
+	AIPrompt               string    `gorm:"column:ai_prompt" json:"ai_prompt"`
+	Layout                 string    `json:"layout"`       // "photo_info", "photo_overlay", "side_panel"
+	DisplayMode            string    `json:"display_mode"` // "cover" or "contain"
+	ShowCalendar           bool      `json:"show_calendar"`
+	CalendarID             string    `json:"calendar_id"`              // Google Calendar ID (per-device)
+	DateFormat             string    `json:"date_format"`              // Go time format string, empty = default "Mon, Jan 02"
+	SelectionStrategy      string    `json:"selection_strategy"`       // "uniform", "favorites" or "rating"
+	Timezone               string    `json:"timezone"`                 // IANA zone for schedules, empty = server local time
+	MemoriesWindowDays     int       `json:"memories_window_days"`     // Max days around today the memories strategy may widen to
+	RefreshIntervalMinutes int       `json:"refresh_interval_minutes"` // Wake-up interval sent to the frame, 0 = frame keeps its own
+	QuietStartMinute       int       `json:"quiet_start_minute"`       // Quiet hours in minutes since midnight, equal start and end = none
+	QuietEndMinute         int       `json:"quiet_end_minute"`
+	WakeForEvents          bool      `json:"wake_for_events"` // Wake shortly after the next calendar event starts
+	EventWakeDelayMinutes  int       `json:"event_wake_delay_minutes"`
+	Palette                string    `json:"palette"`            // Panel inks as a JSON object of name to color, empty = reported by the device
+	FrameFormat            string    `json:"frame_format"`       // "png", "4bpp" or "bmp", empty = PNG; used for pushes and when the request doesn't ask
+	CollageLayout          string    `json:"collage_layout"`     // "smart", "three_up", "grid" or "mosaic", empty = smart
+	CollageGutter          int       `json:"collage_gutter"`     // Pixels between collage photos
+	CollageBackground      string    `json:"collage_background"` // Gutter color as #rrggbb, empty = white
+	LayoutTemplateID       *uint     `json:"layout_template_id"` // User-defined layout used instead of Layout, nil = built-in
+	Renderer               string    `json:"renderer"`           // "chrome" or "native", empty = Chrome when installed
+	CreatedAt              time.Time `json:"created_at"`
+	// Overlay widgets in drawing order, nil = the ones the Show* switches turn on
+	Widgets []WidgetPlacement `gorm:"serializer:json" json:"widgets"`
+}
+
+// WidgetPlacement puts an overlay widget in one of a layout's areas.
+type WidgetPlacement struct {
+	Widget    string `json:"widget"`    // Registered widget name, e.g. "weather"
+	Placement string `json:"placement"` // "primary", "secondary" or "detail"
+}
+
+// LayoutTemplate is a user-defined HTML layout, rendered like the built-in
+// ones with the same template data plus its own Fields.
+type LayoutTemplate struct {
+	ID        uint              `gorm:"primaryKey" json:"id"`
+	Name      string            `json:"name"`
+	HTML      string            `gorm:"column:html" json:"html"`
+	Fields    map[string]string `gorm:"serializer:json" json:"fields"` // Available to the template as .Fields
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
 }
 
 const (
 	LayoutPhotoInfo    = "photo_info"
 	LayoutPhotoOverlay = "photo_overlay"
 	LayoutSidePanel    = "side_panel"
+	LayoutDashboard    = "dashboard" // agenda, forecast and date, with the photo as a small tile
+)
+
+// Selection strategies control how photos are weighted in a device's rotation.
+const (
+	SelectionUniform   = "uniform"   // every photo is equally likely
+	SelectionFavorites = "favorites" // favorites show more often
+	SelectionRating    = "rating"    // photos show in proportion to their star rating
+	SelectionMemories  = "memories"  // prefer photos taken on this day in earlier years
 )
 
+// DeviceSourceWeight is how often a source is picked, relative to the other
+// sources, when the device uses the mix source.
+type DeviceSourceWeight struct {
+	DeviceID uint   `gorm:"primaryKey" json:"device_id"`
+	Source   string `gorm:"primaryKey" json:"source"`
+	Weight   int    `json:"weight"`
+}
+
+// DeviceSchedule is one entry of a device's playlist. It is active on the
+// selected weekdays between StartMinute and EndMinute (minutes since midnight
+// in the device's timezone). An end before the start spans midnight and equal
+// values cover the whole day. When entries overlap the highest priority wins;
+// overlapping entries with the same priority are rejected on save.
+type DeviceSchedule struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	DeviceID    uint      `gorm:"index" json:"device_id"`
+	Name        string    `json:"name"`
+	Days        int       `json:"days"` // Weekday bitmask, bit 0 = Sunday ... bit 6 = Saturday; 0 = every day
+	StartMinute int       `json:"start_minute"`
+	EndMinute   int       `json:"end_minute"`
+	Source      string    `json:"source"`
+	AlbumID     string    `json:"album_id"` // Optional, restricts synology_photos/immich to one album
+	Layout      string    `json:"layout"`   // Optional layout override, empty = device layout
+	Priority    int       `json:"priority"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
 type DeviceHistory struct {
 	ID       uint      `gorm:"primaryKey" json:"id"`
 	DeviceID uint      `gorm:"index" json:"device_id"` // Foreign key to Device
@@ -88,6 +203,19 @@ type DeviceHistory struct {
 	ServedAt time.Time `json:"served_at"`
 }
 
+// ShuffleEntry is one slot of a device's persisted shuffle bag. Each pool
+// (usually a source) holds every eligible photo once per cycle and is consumed
+// in SortKey order, so nothing repeats until the whole pool has been shown.
+type ShuffleEntry struct {
+	ID       uint       `gorm:"primaryKey" json:"id"`
+	DeviceID uint       `gorm:"index:idx_shuffle_entries_device_pool" json:"device_id"`
+	Pool     string     `gorm:"index:idx_shuffle_entries_device_pool" json:"pool"`
+	ImageID  uint       `json:"image_id"`
+	SortKey  float64    `json:"sort_key"`
+	Played   bool       `json:"played"`
+	PlayedAt *time.Time `json:"played_at"`
+}
+
 type UserSession struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	UserID    uint      `gorm:"index" json:"user_id"`
@@ -98,11 +226,20 @@ type UserSession struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// DeviceImageMapping assigns a single photo to a device. Photos without any
+// mapping (direct or through an album) are shared by all devices.
 type DeviceImageMapping struct {
 	DeviceID uint `gorm:"primaryKey" json:"device_id"`
 	ImageID  uint `gorm:"primaryKey" json:"image_id"`
 }
 
+// DeviceAlbumMapping assigns every photo synced from a source album to a device.
+type DeviceAlbumMapping struct {
+	DeviceID uint   `gorm:"primaryKey" json:"device_id"`
+	Source   string `gorm:"primaryKey" json:"source"`
+	AlbumID  string `gorm:"primaryKey" json:"album_id"`
+}
+
 type URLSource struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	URL       string    `json:"url"`
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
 )
 
 type AIGenerationService struct {
@@ -170,7 +171,7 @@ func (s *AIGenerationService) generateOpenAI(prompt, modelName string, isPortrai
 		return nil, fmt.Errorf("no image data in OpenAI response")
 	}
 
-	img, _, err := image.Decode(bytes.NewReader(imgData))
+	img, _, err := imageops.DecodeBytes(imgData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
@@ -280,7 +281,7 @@ func (s *AIGenerationService) generateGemini(prompt, modelName string, isPortrai
 		return nil, fmt.Errorf("failed to decode base64 image: %w", err)
 	}
 
-	img, _, err := image.Decode(bytes.NewReader(imgData))
+	img, _, err := imageops.DecodeBytes(imgData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %w", err)
 	}
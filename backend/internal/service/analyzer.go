@@ -0,0 +1,175 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
+	"gorm.io/gorm"
+)
+
+const (
+	analyzeInterval   = 5 * time.Minute
+	analyzeBatchSize  = 50
+	analyzeRetryAfter = time.Hour
+)
+
+type AnalyzerServiceDeps struct {
+	DB       *gorm.DB
+	Synology *SynologyService
+	Immich   *ImmichService
+	Settings *SettingsService
+	DataDir  string
+}
+
+// AnalyzerService works through the library in the background computing
+// per-photo metrics that need the pixels: perceptual hashes for duplicate
+// detection and quality scores for skipping bad photos.
+type AnalyzerService struct {
+	db       *gorm.DB
+	synology *SynologyService
+	immich   *ImmichService
+	settings *SettingsService
+	dataDir  string
+
+	mu     sync.Mutex
+	failed map[uint]time.Time // photos that failed to load, retried after analyzeRetryAfter
+}
+
+func NewAnalyzerService(deps AnalyzerServiceDeps) *AnalyzerService {
+	return &AnalyzerService{
+		db:       deps.DB,
+		synology: deps.Synology,
+		immich:   deps.Immich,
+		settings: deps.Settings,
+		dataDir:  deps.DataDir,
+		failed:   make(map[uint]time.Time),
+	}
+}
+
+// Run analyzes new photos as they are imported. It never returns.
+func (s *AnalyzerService) Run() {
+	ticker := time.NewTicker(analyzeInterval)
+	defer ticker.Stop()
+	for {
+		if n := s.AnalyzePending(); n > 0 {
+			log.Printf("Analyzed %d photos", n)
+		}
+		<-ticker.C
+	}
+}
+
+// AnalyzePending analyzes every photo that hasn't been yet and returns how
+// many were.
+func (s *AnalyzerService) AnalyzePending() int {
+	count := 0
+	for {
+		var items []model.Image
+		query := s.db.Where("phash = '' OR quality_score IS NULL")
+		if skip := s.skipped(); len(skip) > 0 {
+			query = query.Where("id NOT IN ?", skip)
+		}
+		if err := query.Order("id").Limit(analyzeBatchSize).Find(&items).Error; err != nil {
+			log.Printf("Failed to list photos to analyze: %v", err)
+			return count
+		}
+		if len(items) == 0 {
+			return count
+		}
+		for _, item := range items {
+			if err := s.Analyze(item); err != nil {
+				log.Printf("Failed to analyze image %d: %v", item.ID, err)
+				s.mu.Lock()
+				s.failed[item.ID] = time.Now()
+				s.mu.Unlock()
+				continue
+			}
+			count++
+		}
+	}
+}
+
+// skipped returns the photos that recently failed to load.
+func (s *AnalyzerService) skipped() []uint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []uint
+	for id, at := range s.failed {
+		if time.Since(at) > analyzeRetryAfter {
+			delete(s.failed, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Analyze computes and stores the metrics of one photo.
+func (s *AnalyzerService) Analyze(item model.Image) error {
+	img, err := s.loadThumbnail(item)
+	if err != nil {
+		return err
+	}
+	quality := imageops.MeasureQuality(img)
+	score, issues := ScoreQuality(quality)
+	return s.db.Model(&model.Image{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+		"phash":          imageops.FormatHash(imageops.PHash(img)),
+		"quality_score":  score,
+		"sharpness":      quality.Sharpness,
+		"exposure":       quality.Exposure,
+		"colorfulness":   quality.Colorfulness,
+		"screenshot":     quality.Screenshot,
+		"quality_issues": strings.Join(issues, ","),
+	}).Error
+}
+
+// MinQualityScore returns the score below which photos are left out of
+// rotation, 0 when disabled.
+func (s *AnalyzerService) MinQualityScore() float64 {
+	return MinQualityScore(s.settings)
+}
+
+// loadThumbnail loads a small version of the photo, which is all the
+// metrics need.
+func (s *AnalyzerService) loadThumbnail(item model.Image) (image.Image, error) {
+	var data []byte
+	var err error
+	switch item.Source {
+	case model.SourceSynologyPhotos:
+		data, err = s.synology.GetPhoto(item.SynologyPhotoID, item.ThumbnailKey, "small")
+	case model.SourceImmich:
+		data, err = s.immich.GetPhoto(item.ImmichAssetID, "thumbnail")
+	default:
+		if item.FilePath == "" {
+			return nil, fmt.Errorf("no file")
+		}
+		img, _, err := imageops.DecodeFile(s.resolvePath(item.FilePath))
+		return img, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := imageops.DecodeBytes(data)
+	return img, err
+}
+
+// resolvePath maps paths recorded under the Docker data directory onto the
+// configured one.
+func (s *AnalyzerService) resolvePath(path string) string {
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	for _, prefix := range []string{"/data/", "/app/data/"} {
+		if strings.HasPrefix(path, prefix) {
+			return filepath.Join(s.dataDir, strings.TrimPrefix(path, prefix))
+		}
+	}
+	return path
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeviceAssignments lists the photos and albums explicitly assigned to a device.
+type DeviceAssignments struct {
+	ImageIDs []uint                     `json:"image_ids"`
+	Albums   []model.DeviceAlbumMapping `json:"albums"`
+}
+
+// AssignmentService manages which photos and albums are bound to which devices.
+// A photo that is not assigned to any device (directly or through its album)
+// stays in the shared pool, mirroring how unbound URL sources behave.
+type AssignmentService struct {
+	db *gorm.DB
+}
+
+func NewAssignmentService(db *gorm.DB) *AssignmentService {
+	return &AssignmentService{db: db}
+}
+
+func (s *AssignmentService) GetAssignments(deviceID uint) (*DeviceAssignments, error) {
+	result := &DeviceAssignments{
+		ImageIDs: []uint{},
+		Albums:   []model.DeviceAlbumMapping{},
+	}
+	if err := s.db.Model(&model.DeviceImageMapping{}).
+		Where("device_id = ?", deviceID).
+		Order("image_id").
+		Pluck("image_id", &result.ImageIDs).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("device_id = ?", deviceID).
+		Order("source, album_id").
+		Find(&result.Albums).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AssignPhotos binds the given photos to a device. Already assigned photos are
+// left untouched.
+func (s *AssignmentService) AssignPhotos(deviceID uint, imageIDs []uint) error {
+	if len(imageIDs) == 0 {
+		return nil
+	}
+	mappings := make([]model.DeviceImageMapping, 0, len(imageIDs))
+	for _, id := range imageIDs {
+		mappings = append(mappings, model.DeviceImageMapping{DeviceID: deviceID, ImageID: id})
+	}
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&mappings).Error
+}
+
+func (s *AssignmentService) UnassignPhotos(deviceID uint, imageIDs []uint) error {
+	if len(imageIDs) == 0 {
+		return nil
+	}
+	return s.db.Where("device_id = ? AND image_id IN ?", deviceID, imageIDs).
+		Delete(&model.DeviceImageMapping{}).Error
+}
+
+// AssignAlbum binds every photo synced from the given album to a device.
+func (s *AssignmentService) AssignAlbum(deviceID uint, source, albumID string) error {
+	if err := validateAlbumSource(source); err != nil {
+		return err
+	}
+	if albumID == "" {
+		return errors.New("album_id required")
+	}
+	mapping := model.DeviceAlbumMapping{DeviceID: deviceID, Source: source, AlbumID: albumID}
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&mapping).Error
+}
+
+func (s *AssignmentService) UnassignAlbum(deviceID uint, source, albumID string) error {
+	return s.db.Where("device_id = ? AND source = ? AND album_id = ?", deviceID, source, albumID).
+		Delete(&model.DeviceAlbumMapping{}).Error
+}
+
+// ScopeToDevice restricts an images query to the photos a device may show:
+// photos assigned to it directly or through an album, plus every photo that
+// is not assigned to any device. A nil deviceID only sees the shared pool.
+func (s *AssignmentService) ScopeToDevice(query *gorm.DB, deviceID *uint) *gorm.DB {
+	shared := s.db.
+		Where("NOT EXISTS (SELECT 1 FROM device_image_mappings dim WHERE dim.image_id = images.id)").
+		Where("NOT EXISTS (SELECT 1 FROM device_album_mappings dam WHERE dam.source = images.source AND dam.album_id = images.album_id AND images.album_id != '')")
+	if deviceID == nil {
+		return query.Where(shared)
+	}
+
+	return query.Where(
+		s.db.Where("images.id IN (SELECT image_id FROM device_image_mappings WHERE device_id = ?)", *deviceID).
+			Or("images.album_id != '' AND EXISTS (SELECT 1 FROM device_album_mappings dam WHERE dam.device_id = ? AND dam.source = images.source AND dam.album_id = images.album_id)", *deviceID).
+			Or(shared),
+	)
+}
+
+func validateAlbumSource(source string) error {
+	switch source {
+	case model.SourceSynologyPhotos, model.SourceImmich:
+		return nil
+	default:
+		return errors.New("albums can only be assigned for synology_photos or immich")
+	}
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+)
+
+// Collage layouts, used when the device has collages enabled.
+const (
+	CollageSmart   = "smart"    // two photos split in halves, only when the photo's orientation doesn't fit the panel
+	CollageThreeUp = "three_up" // three photos in a row (landscape panels) or a column (portrait panels)
+	CollageGrid    = "grid"     // 2x2 grid
+	CollageMosaic  = "mosaic"   // one large photo plus two small ones
+
+	DefaultCollageBackground = "#ffffff"
+	maxCollageGutter         = 64
+)
+
+// CollageSettings is how a device arranges photos when collages are enabled.
+type CollageSettings struct {
+	Layout     string `json:"layout"`     // empty = smart
+	Gutter     int    `json:"gutter"`     // pixels between photos
+	Background string `json:"background"` // gutter color as #rrggbb, empty = white
+}
+
+// DeviceCollage returns the device's collage settings with defaults applied.
+func DeviceCollage(device *model.Device) CollageSettings {
+	settings := CollageSettings{Layout: CollageSmart, Background: DefaultCollageBackground}
+	if device == nil {
+		return settings
+	}
+	if device.CollageLayout != "" {
+		settings.Layout = device.CollageLayout
+	}
+	if device.CollageBackground != "" {
+		settings.Background = device.CollageBackground
+	}
+	settings.Gutter = device.CollageGutter
+	return settings
+}
+
+// SetCollage stores the device's collage settings.
+func (s *DeviceService) SetCollage(device *model.Device, settings CollageSettings) error {
+	switch settings.Layout {
+	case "", CollageSmart, CollageThreeUp, CollageGrid, CollageMosaic:
+	default:
+		return fmt.Errorf("unknown collage layout: %s", settings.Layout)
+	}
+	if settings.Gutter < 0 || settings.Gutter > maxCollageGutter {
+		return fmt.Errorf("gutter must be between 0 and %d", maxCollageGutter)
+	}
+	if settings.Background != "" {
+		if _, err := ParseHexColor(settings.Background); err != nil {
+			return err
+		}
+	}
+
+	device.CollageLayout = settings.Layout
+	device.CollageGutter = settings.Gutter
+	device.CollageBackground = settings.Background
+	return s.db.Model(device).Select("CollageLayout", "CollageGutter", "CollageBackground").Updates(device).Error
+}
+
+// ParseHexColor parses a #rrggbb color.
+func ParseHexColor(s string) (color.RGBA, error) {
+	var r, g, b uint8
+	if len(s) != 7 || !strings.HasPrefix(s, "#") {
+		return color.RGBA{}, errors.New("background must be a #rrggbb color")
+	}
+	if _, err := fmt.Sscanf(s, "#%02x%02x%02x", &r, &g, &b); err != nil {
+		return color.RGBA{}, errors.New("background must be a #rrggbb color")
+	}
+	return color.RGBA{R: r, G: g, B: b, A: 255}, nil
+}
+
+// CollageSlots returns the photo rectangles of a layout on a w x h canvas,
+// largest first, with gutter pixels between neighbouring slots. The smart
+// layout has no fixed slots and returns nil.
+func CollageSlots(layout string, w, h, gutter int) []image.Rectangle {
+	landscape := w >= h
+	// split divides [0, n) into parts of the given relative sizes with
+	// gutters in between, returning the boundaries.
+	split := func(n int, sizes ...int) [][2]int {
+		total := 0
+		for _, s := range sizes {
+			total += s
+		}
+		avail := n - gutter*(len(sizes)-1)
+		var out [][2]int
+		pos := 0
+		for i, s := range sizes {
+			end := pos + avail*s/total
+			if i == len(sizes)-1 {
+				end = n
+			}
+			out = append(out, [2]int{pos, end})
+			pos = end + gutter
+		}
+		return out
+	}
+
+	var slots []image.Rectangle
+	switch layout {
+	case CollageThreeUp:
+		length := h
+		if landscape {
+			length = w
+		}
+		for _, p := range split(length, 1, 1, 1) {
+			if landscape {
+				slots = append(slots, image.Rect(p[0], 0, p[1], h))
+			} else {
+				slots = append(slots, image.Rect(0, p[0], w, p[1]))
+			}
+		}
+	case CollageGrid:
+		for _, row := range split(h, 1, 1) {
+			for _, col := range split(w, 1, 1) {
+				slots = append(slots, image.Rect(col[0], row[0], col[1], row[1]))
+			}
+		}
+	case CollageMosaic:
+		if landscape {
+			cols := split(w, 2, 1)
+			slots = append(slots, image.Rect(cols[0][0], 0, cols[0][1], h))
+			for _, row := range split(h, 1, 1) {
+				slots = append(slots, image.Rect(cols[1][0], row[0], cols[1][1], row[1]))
+			}
+		} else {
+			rows := split(h, 2, 1)
+			slots = append(slots, image.Rect(0, rows[0][0], w, rows[0][1]))
+			for _, col := range split(w, 1, 1) {
+				slots = append(slots, image.Rect(col[0], rows[1][0], col[1], rows[1][1]))
+			}
+		}
+	}
+	return slots
+}
+
+// SlotOrientation is the photo orientation that fills a slot with the least
+// cropping: "portrait", "landscape", or "" for roughly square slots that
+// suit either.
+func SlotOrientation(slot image.Rectangle) string {
+	aspect := float64(slot.Dx()) / float64(slot.Dy())
+	switch {
+	case aspect < 0.8:
+		return "portrait"
+	case aspect > 1.25:
+		return "landscape"
+	}
+	return ""
+}
+
+// AssignSlots matches photos (by aspect ratio, width / height) to slots so
+// the least photo area is cropped away overall, larger slots weighing more.
+// It returns, for each slot, the index of the photo to place there.
+func AssignSlots(slots []image.Rectangle, aspects []float64) []int {
+	n := len(slots)
+	best := make([]int, n)
+	for i := range best {
+		best[i] = i % max(len(aspects), 1)
+	}
+	if len(aspects) < n {
+		return best
+	}
+
+	// Layouts have at most four slots, so trying every permutation is cheap
+	perm := make([]int, len(aspects))
+	for i := range perm {
+		perm[i] = i
+	}
+	bestLoss := math.Inf(1)
+	var permute func(k int)
+	permute = func(k int) {
+		if k == n {
+			var loss float64
+			for i, slot := range slots {
+				loss += cropLoss(slot, aspects[perm[i]])
+			}
+			if loss < bestLoss {
+				bestLoss = loss
+				copy(best, perm[:n])
+			}
+			return
+		}
+		for i := k; i < len(perm); i++ {
+			perm[k], perm[i] = perm[i], perm[k]
+			permute(k + 1)
+			perm[k], perm[i] = perm[i], perm[k]
+		}
+	}
+	permute(0)
+	return best
+}
+
+// cropLoss is the slot area lost to cropping a photo of the given aspect
+// ratio to cover the slot.
+func cropLoss(slot image.Rectangle, aspect float64) float64 {
+	slotAspect := float64(slot.Dx()) / float64(slot.Dy())
+	kept := math.Min(slotAspect/aspect, aspect/slotAspect)
+	return float64(slot.Dx()*slot.Dy()) * (1 - kept)
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollageSlots_Gutters(t *testing.T) {
+	slots := CollageSlots(CollageGrid, 1200, 1600, 10)
+	assert.Equal(t, []image.Rectangle{
+		image.Rect(0, 0, 595, 795), image.Rect(605, 0, 1200, 795),
+		image.Rect(0, 805, 595, 1600), image.Rect(605, 805, 1200, 1600),
+	}, slots)
+
+	// Portrait mosaic: large photo on top, two below
+	slots = CollageSlots(CollageMosaic, 1200, 1600, 0)
+	assert.Equal(t, image.Rect(0, 0, 1200, 1066), slots[0])
+	assert.Equal(t, image.Rect(0, 1066, 600, 1600), slots[1])
+	assert.Equal(t, image.Rect(600, 1066, 1200, 1600), slots[2])
+
+	// Three-up runs along the panel's long side
+	slots = CollageSlots(CollageThreeUp, 800, 480, 8)
+	assert.Len(t, slots, 3)
+	assert.Equal(t, "portrait", SlotOrientation(slots[0]))
+	assert.Equal(t, 800, slots[2].Max.X)
+
+	assert.Nil(t, CollageSlots(CollageSmart, 800, 480, 0))
+}
+
+func TestAssignSlots_MatchesAspectRatios(t *testing.T) {
+	// Landscape mosaic: a tall slot on the left, two wide ones on the right
+	slots := CollageSlots(CollageMosaic, 1600, 1200, 0)
+	aspects := []float64{1.5, 0.75, 1.5}
+	assert.Equal(t, 1, AssignSlots(slots, aspects)[0])
+
+	// Too few photos: repeated in order
+	assert.Equal(t, []int{0, 1, 0}, AssignSlots(slots, []float64{1.5, 0.75}))
+}
+
+func TestSetCollage_Validates(t *testing.T) {
+	svc := &DeviceService{db: setupTestDB()}
+	assert.Error(t, svc.SetCollage(nil, CollageSettings{Layout: "hexagon"}))
+	assert.Error(t, svc.SetCollage(nil, CollageSettings{Layout: CollageGrid, Gutter: -1}))
+	assert.Error(t, svc.SetCollage(nil, CollageSettings{Layout: CollageGrid, Background: "white"}))
+
+	c, err := ParseHexColor("#1a2B3c")
+	assert.NoError(t, err)
+	assert.Equal(t, [3]uint8{0x1a, 0x2b, 0x3c}, [3]uint8{c.R, c.G, c.B})
+}
@@ -8,45 +8,41 @@ import (
 	"os"
 
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
-	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/gcalendar"
-	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/googlephotos"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/epaper"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/photoframe"
-	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/weather"
 	"gorm.io/gorm"
 )
 
 type DeviceServiceDeps struct {
-	DB             *gorm.DB
-	Settings       *SettingsService
-	Processor      *ProcessorService
-	Renderer       *RendererService
-	Weather        *weather.Client
-	Calendar       *gcalendar.Client
-	CalendarGoogle *googlephotos.Client
-	PFClient       *photoframe.Client
+	DB        *gorm.DB
+	Settings  *SettingsService
+	Processor *ProcessorService
+	Renderer  *RendererService
+	Templates *LayoutTemplateService
+	Widgets   *WidgetRegistry
+	PFClient  *photoframe.Client
 }
 
 type DeviceService struct {
-	db             *gorm.DB
-	settings       *SettingsService
-	processor      *ProcessorService
-	renderer       *RendererService
-	weather        *weather.Client
-	calendar       *gcalendar.Client
-	calendarGoogle *googlephotos.Client
-	pfClient       *photoframe.Client
+	db        *gorm.DB
+	settings  *SettingsService
+	processor *ProcessorService
+	renderer  *RendererService
+	templates *LayoutTemplateService
+	widgets   *WidgetRegistry
+	pfClient  *photoframe.Client
 }
 
 func NewDeviceService(deps DeviceServiceDeps) *DeviceService {
 	return &DeviceService{
-		db:             deps.DB,
-		settings:       deps.Settings,
-		processor:      deps.Processor,
-		renderer:       deps.Renderer,
-		weather:        deps.Weather,
-		calendar:       deps.Calendar,
-		calendarGoogle: deps.CalendarGoogle,
-		pfClient:       deps.PFClient,
+		db:        deps.DB,
+		settings:  deps.Settings,
+		processor: deps.Processor,
+		renderer:  deps.Renderer,
+		templates: deps.Templates,
+		widgets:   deps.Widgets,
+		pfClient:  deps.PFClient,
 	}
 }
 
@@ -60,7 +56,23 @@ func (s *DeviceService) ListDevices() ([]model.Device, error) {
 	return devices, nil
 }
 
-func (s *DeviceService) AddDevice(host string, useDeviceParameter, enableCollage, showDate, showWeather bool, weatherLat, weatherLon float64, layout string, displayMode string, showCalendar bool, calendarID string, dateFormat string) (*model.Device, error) {
+func (s *DeviceService) AddDevice(host string, useDeviceParameter, enableCollage, showDate, showWeather bool, weatherLat, weatherLon float64, layout string, displayMode string, showCalendar bool, calendarID string, dateFormat string, selectionStrategy string, timezone string, memoriesWindowDays int, frameFormat string) (*model.Device, error) {
+	if err := ValidateSelectionStrategy(selectionStrategy); err != nil {
+		return nil, err
+	}
+	if err := ValidateTimezone(timezone); err != nil {
+		return nil, err
+	}
+	if err := epaper.ValidateFormat(frameFormat); err != nil {
+		return nil, err
+	}
+	if selectionStrategy == "" {
+		selectionStrategy = model.SelectionUniform
+	}
+	if memoriesWindowDays <= 0 {
+		memoriesWindowDays = DefaultMemoriesWindowDays
+	}
+
 	sysInfo, err := s.pfClient.FetchSystemInfo(host)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch system info: %w", err)
@@ -96,22 +108,27 @@ func (s *DeviceService) AddDevice(host string, useDeviceParameter, enableCollage
 	}
 
 	device := &model.Device{
-		Name:               name,
-		Host:               host,
-		Width:              width,
-		Height:             height,
-		Orientation:        orientation,
-		UseDeviceParameter: useDeviceParameter,
-		EnableCollage:      enableCollage,
-		ShowDate:           showDate,
-		ShowWeather:        showWeather,
-		WeatherLat:         weatherLat,
-		WeatherLon:         weatherLon,
-		Layout:             layout,
-		DisplayMode:        displayMode,
-		ShowCalendar:       showCalendar,
-		CalendarID:         calendarID,
-		DateFormat:         dateFormat,
+		Name:                  name,
+		Host:                  host,
+		Width:                 width,
+		Height:                height,
+		Orientation:           orientation,
+		UseDeviceParameter:    useDeviceParameter,
+		EnableCollage:         enableCollage,
+		ShowDate:              showDate,
+		ShowWeather:           showWeather,
+		WeatherLat:            weatherLat,
+		WeatherLon:            weatherLon,
+		Layout:                layout,
+		DisplayMode:           displayMode,
+		ShowCalendar:          showCalendar,
+		CalendarID:            calendarID,
+		DateFormat:            dateFormat,
+		SelectionStrategy:     selectionStrategy,
+		Timezone:              timezone,
+		MemoriesWindowDays:    memoriesWindowDays,
+		EventWakeDelayMinutes: DefaultEventWakeDelayMinutes,
+		FrameFormat:           frameFormat,
 	}
 	if err := s.db.Create(device).Error; err != nil {
 		return nil, err
@@ -119,7 +136,25 @@ func (s *DeviceService) AddDevice(host string, useDeviceParameter, enableCollage
 	return device, nil
 }
 
-func (s *DeviceService) UpdateDevice(id uint, name, host string, width, height int, orientation string, useDeviceParameter, enableCollage, showDate, showWeather bool, weatherLat, weatherLon float64, aiProvider, aiModel, aiPrompt string, layout string, displayMode string, showCalendar bool, calendarID string, dateFormat string) (*model.Device, error) {
+// UpdateDevice saves the device's settings. Settings passed as nil pointers
+// were left out of the request and keep their stored value.
+func (s *DeviceService) UpdateDevice(id uint, name, host string, width, height int, orientation string, useDeviceParameter, enableCollage, showDate, showWeather bool, weatherLat, weatherLon float64, aiProvider, aiModel, aiPrompt string, layout string, displayMode string, showCalendar bool, calendarID string, dateFormat string, selectionStrategy *string, timezone *string, memoriesWindowDays *int, frameFormat *string) (*model.Device, error) {
+	if selectionStrategy != nil {
+		if err := ValidateSelectionStrategy(*selectionStrategy); err != nil {
+			return nil, err
+		}
+	}
+	if timezone != nil {
+		if err := ValidateTimezone(*timezone); err != nil {
+			return nil, err
+		}
+	}
+	if frameFormat != nil {
+		if err := epaper.ValidateFormat(*frameFormat); err != nil {
+			return nil, err
+		}
+	}
+
 	var device model.Device
 	if err := s.db.First(&device, id).Error; err != nil {
 		return nil, errors.New("device not found")
@@ -184,16 +219,59 @@ func (s *DeviceService) UpdateDevice(id uint, name, host string, width, height i
 	device.ShowCalendar = showCalendar
 	device.CalendarID = calendarID
 	device.DateFormat = dateFormat
+	if selectionStrategy != nil {
+		device.SelectionStrategy = *selectionStrategy
+		if device.SelectionStrategy == "" {
+			device.SelectionStrategy = model.SelectionUniform
+		}
+	}
+	if timezone != nil {
+		device.Timezone = *timezone
+	}
+	if memoriesWindowDays != nil {
+		device.MemoriesWindowDays = *memoriesWindowDays
+		if device.MemoriesWindowDays <= 0 {
+			device.MemoriesWindowDays = DefaultMemoriesWindowDays
+		}
+	}
+	if frameFormat != nil {
+		device.FrameFormat = *frameFormat
+	}
+	syncWidgetSwitches(&device)
 
 	if err := s.db.Save(&device).Error; err != nil {
 		return nil, err
 	}
+	// The location or calendar may have changed
+	s.widgets.Invalidate(device.ID)
 	return &device, nil
 }
 
+// SetRenderer stores the engine the device's frames are rendered with,
+// empty = Chrome when it is installed.
+func (s *DeviceService) SetRenderer(device *model.Device, engine string) error {
+	switch engine {
+	case "", RendererChrome, RendererNative:
+	default:
+		return fmt.Errorf("unknown renderer: %s", engine)
+	}
+	device.Renderer = engine
+	return s.db.Model(device).Select("Renderer").Updates(device).Error
+}
+
 func (s *DeviceService) DeleteDevice(id uint) error {
 	result := s.db.Delete(&model.Device{}, id)
-	return result.Error
+	if result.Error != nil {
+		return result.Error
+	}
+
+	// Release assigned photos and albums back into the shared pool
+	s.db.Where("device_id = ?", id).Delete(&model.DeviceImageMapping{})
+	s.db.Where("device_id = ?", id).Delete(&model.DeviceAlbumMapping{})
+	s.db.Where("device_id = ?", id).Delete(&model.ShuffleEntry{})
+	s.db.Where("device_id = ?", id).Delete(&model.DeviceSchedule{})
+	s.db.Where("device_id = ?", id).Delete(&model.DeviceSourceWeight{})
+	return nil
 }
 
 // --- Push Logic ---
@@ -238,6 +316,8 @@ func (s *DeviceService) PushToHost(device *model.Device, imagePath string, extra
 		processingOpts[k] = v
 	}
 
+	var procSettings *photoframe.ProcessingSettings
+	var palette *photoframe.Palette
 	if device.UseDeviceParameter {
 		// 1. Fetch Dimensions
 		sysInfo, err := s.pfClient.FetchSystemInfo(device.Host)
@@ -248,9 +328,6 @@ func (s *DeviceService) PushToHost(device *model.Device, imagePath string, extra
 			log.Printf("Failed to fetch dimensions for %s: %v", device.Name, err)
 		}
 
-		var procSettings *photoframe.ProcessingSettings
-		var palette *photoframe.Palette
-
 		// 2. Fetch Processing Settings and Palette
 		procSettings, err = s.pfClient.FetchProcessingSettings(device.Host)
 		if err != nil {
@@ -262,12 +339,12 @@ func (s *DeviceService) PushToHost(device *model.Device, imagePath string, extra
 			log.Printf("Failed to fetch palette from %s: %v", device.Host, err)
 		}
 
-		fetchedOpts := s.processor.MapProcessingSettings(procSettings, palette)
-		for k, v := range fetchedOpts {
-			processingOpts[k] = v
-		}
 		log.Printf("Fetched processing parameters for %s", device.Name)
 	}
+	fetchedOpts := s.processor.MapProcessingSettings(procSettings, DevicePalette(device, palette))
+	for k, v := range fetchedOpts {
+		processingOpts[k] = v
+	}
 
 	// 1. Validate dimensions
 	nativeW, nativeH := device.Width, device.Height
@@ -284,7 +361,7 @@ func (s *DeviceService) PushToHost(device *model.Device, imagePath string, extra
 	defer f.Close()
 
 	// 3. Decode
-	srcImg, _, err := image.Decode(f)
+	srcImg, _, err := imageops.Decode(f)
 	if err != nil {
 		return fmt.Errorf("failed to decode image: %w", err)
 	}
@@ -303,53 +380,26 @@ func (s *DeviceService) PushToHost(device *model.Device, imagePath string, extra
 		logicalW, logicalH = logicalH, logicalW
 	}
 
-	// 5. Render layout (photo + overlay + calendar)
-	needsOverlay := device.ShowDate || device.ShowWeather || device.ShowCalendar
+	// 5. Render layout (photo + widgets)
+	var tmpl *model.LayoutTemplate
+	if s.templates != nil {
+		tmpl = s.templates.DeviceTemplate(device)
+	}
+	layout := device.Layout
+	if layout == "" {
+		layout = model.LayoutPhotoOverlay
+	}
+	placements := LayoutWidgets(device, layout)
+	needsOverlay := len(placements) > 0 || tmpl != nil || layout == model.LayoutDashboard
 	var finalImg image.Image
 
 	if needsOverlay {
-		var weatherData *weather.CurrentWeather
-		var deviceTimezone string
-		if device.ShowWeather && device.WeatherLat != 0 && device.WeatherLon != 0 {
-			latStr := fmt.Sprintf("%f", device.WeatherLat)
-			lonStr := fmt.Sprintf("%f", device.WeatherLon)
-			var weatherErr error
-			weatherData, weatherErr = s.weather.GetWeather(latStr, lonStr)
-			if weatherErr != nil {
-				log.Printf("Failed to fetch weather data for device %d: %v", device.ID, weatherErr)
-			}
-			if weatherData != nil {
-				deviceTimezone = weatherData.Timezone
-			}
-		}
-
-		var events []gcalendar.Event
-		if device.ShowCalendar && s.calendar != nil && s.calendarGoogle != nil {
-			httpClient, err := s.calendarGoogle.GetClient()
-			if err == nil {
-				calendarID := device.CalendarID
-				if calendarID == "" {
-					calendarID = "primary"
-				}
-				var calErr error
-				events, calErr = s.calendar.GetTodayEvents(httpClient, calendarID, deviceTimezone)
-				if calErr != nil {
-					log.Printf("Failed to fetch calendar events for device %d: %v", device.ID, calErr)
-				}
-			}
-		}
-
-		layout := device.Layout
-		if layout == "" {
-			layout = model.LayoutPhotoOverlay
-		}
 		displayMode := device.DisplayMode
 		if displayMode == "" {
 			displayMode = "cover"
 		}
 
-		var renderErr error
-		finalImg, renderErr = s.renderer.Render(RenderOptions{
+		renderOpts := RenderOptions{
 			Layout:       layout,
 			DisplayMode:  displayMode,
 			Width:        logicalW,
@@ -357,14 +407,19 @@ func (s *DeviceService) PushToHost(device *model.Device, imagePath string, extra
 			NativeWidth:  nativeW,
 			NativeHeight: nativeH,
 			Photo:        srcImg,
-			ShowDate:     device.ShowDate,
-			ShowWeather:  device.ShowWeather,
-			Weather:      weatherData,
-			ShowCalendar: device.ShowCalendar,
-			Events:       events,
-			Timezone:     deviceTimezone,
+			Widgets:      s.widgets.Fetch(device, placements),
+			DeviceName:   device.Name,
+			Timezone:     device.Timezone,
 			DateFormat:   device.DateFormat,
-		})
+			Engine:       device.Renderer,
+		}
+		if tmpl != nil {
+			renderOpts.Template = tmpl.HTML
+			renderOpts.Fields = tmpl.Fields
+		}
+
+		var renderErr error
+		finalImg, renderErr = s.renderer.Render(renderOpts)
 		if renderErr != nil {
 			return fmt.Errorf("render failed: %w", renderErr)
 		}
@@ -389,7 +444,16 @@ func (s *DeviceService) PushToHost(device *model.Device, imagePath string, extra
 		return fmt.Errorf("processing failed: %w", err)
 	}
 
-	if err := s.pfClient.PushImage(device.Host, processedData, thumbData); err != nil {
+	format := device.FrameFormat
+	if format == "" {
+		format = epaper.FormatPNG
+	}
+	frameData, err := s.processor.EncodeFrame(processedData, opts, format)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s frame: %w", format, err)
+	}
+	frame := photoframe.Frame{Data: frameData, ContentType: epaper.ContentType(format), Filename: "image." + format}
+	if err := s.pfClient.PushFrame(device.Host, frame, thumbData); err != nil {
 		return fmt.Errorf("failed to push to device: %w", err)
 	}
 
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
+	"gorm.io/gorm"
+)
+
+// DuplicateDistance is the largest number of differing perceptual hash bits
+// for two photos to count as near-duplicates.
+const DuplicateDistance = 6
+
+// MaxDuplicateDistance bounds the distance callers may ask for; beyond it
+// unrelated photos of a 64-bit hash start to match.
+const MaxDuplicateDistance = 12
+
+// NearDuplicate reports whether two stored perceptual hashes are within
+// maxDistance bits. Photos not analyzed yet are never duplicates.
+func NearDuplicate(a, b string, maxDistance int) bool {
+	ha, okA := imageops.ParseHash(a)
+	hb, okB := imageops.ParseHash(b)
+	return okA && okB && imageops.HammingDistance(ha, hb) <= maxDistance
+}
+
+// NearDuplicateIDs returns the candidates that are near-duplicates of any of
+// the given hashes.
+func NearDuplicateIDs(candidates []model.Image, hashes []string, maxDistance int) map[uint]bool {
+	near := make(map[uint]bool)
+	for _, c := range candidates {
+		for _, h := range hashes {
+			if NearDuplicate(c.PHash, h, maxDistance) {
+				near[c.ID] = true
+				break
+			}
+		}
+	}
+	return near
+}
+
+// GroupDuplicates partitions images into groups of near-duplicates, each
+// photo being within maxDistance of at least one other in its group, so the
+// ends of a chain of similar photos may be further apart. Photos
+// without duplicates are left out. Groups keep the input order of their
+// photos and are ordered by their first photo.
+func GroupDuplicates(images []model.Image, maxDistance int) [][]model.Image {
+	hashes := make([]uint64, len(images))
+	valid := make([]bool, len(images))
+	for i, img := range images {
+		hashes[i], valid[i] = imageops.ParseHash(img.PHash)
+	}
+
+	parent := make([]int, len(images))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	// Hashes within maxDistance bits of each other are equal on at least one
+	// of maxDistance+1 bands of their bits, so only photos sharing a band
+	// value are compared instead of every pair.
+	bands := maxDistance + 1
+	everyPair := bands > 64
+	if everyPair {
+		bands = 1
+	}
+	buckets := make(map[[2]uint64][]int)
+	for i := range images {
+		if !valid[i] {
+			continue
+		}
+		for band := 0; band < bands; band++ {
+			var value uint64
+			if !everyPair {
+				lo, hi := band*64/bands, (band+1)*64/bands
+				value = hashes[i] >> lo & (uint64(1)<<(hi-lo) - 1)
+			}
+			key := [2]uint64{uint64(band), value}
+			for _, j := range buckets[key] {
+				ri, rj := find(i), find(j)
+				if ri != rj && imageops.HammingDistance(hashes[i], hashes[j]) <= maxDistance {
+					parent[max(ri, rj)] = min(ri, rj)
+				}
+			}
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	members := make(map[int][]model.Image)
+	for i, img := range images {
+		root := find(i)
+		members[root] = append(members[root], img)
+	}
+	roots := make([]int, 0, len(members))
+	for root, group := range members {
+		if len(group) > 1 {
+			roots = append(roots, root)
+		}
+	}
+	sort.Ints(roots)
+	groups := make([][]model.Image, len(roots))
+	for i, root := range roots {
+		groups[i] = members[root]
+	}
+	return groups
+}
+
+// DuplicateGroups returns the library's groups of near-duplicate photos,
+// including the ones already hidden in favor of another copy.
+func (s *AnalyzerService) DuplicateGroups(maxDistance int) ([][]model.Image, error) {
+	var images []model.Image
+	if err := s.db.Where("phash != ''").Order("id").Find(&images).Error; err != nil {
+		return nil, err
+	}
+	return GroupDuplicates(images, maxDistance), nil
+}
+
+// KeepDuplicate keeps the photo out of its group of near-duplicates and hides
+// the others within maxDistance of it from rotation; members of the group
+// that are only similar to those others stay. It returns the hidden photos.
+func (s *AnalyzerService) KeepDuplicate(id uint, maxDistance int) ([]model.Image, error) {
+	groups, err := s.DuplicateGroups(maxDistance)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		var keep *model.Image
+		for i := range group {
+			if group[i].ID == id {
+				keep = &group[i]
+			}
+		}
+		if keep == nil {
+			continue
+		}
+		var others []uint
+		var hidden []model.Image
+		for _, img := range group {
+			if img.ID == id || !NearDuplicate(img.PHash, keep.PHash, maxDistance) {
+				continue
+			}
+			others = append(others, img.ID)
+			img.DuplicateOf = &id
+			hidden = append(hidden, img)
+		}
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&model.Image{}).Where("id = ?", id).Update("duplicate_of", nil).Error; err != nil {
+				return err
+			}
+			return tx.Model(&model.Image{}).Where("id IN ?", others).Update("duplicate_of", id).Error
+		})
+		return hidden, err
+	}
+	return nil, gorm.ErrRecordNotFound
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func hashed(id uint, phash string) model.Image {
+	return model.Image{ID: id, PHash: phash}
+}
+
+func groupIDs(groups [][]model.Image) [][]uint {
+	var out [][]uint
+	for _, g := range groups {
+		out = append(out, memoryIDs(g))
+	}
+	return out
+}
+
+func TestGroupDuplicates(t *testing.T) {
+	images := []model.Image{
+		hashed(1, "f0f0f0f0f0f0f0f0"),
+		hashed(2, "0f0f0f0f0f0f0f0f"),
+		hashed(3, "f0f0f0f0f0f0f0f3"), // 2 bits from 1
+		hashed(4, "0f0f0f0f0f0f0f0f"), // same as 2
+		hashed(5, "f0f0f0f0f0f0f03f"), // 4 bits from 3, 6 from 1: chained into 1's group
+		hashed(6, "aaaaaaaaaaaaaaaa"),
+		hashed(7, ""), // not analyzed yet
+		hashed(8, ""),
+	}
+
+	assert.Equal(t, [][]uint{{1, 3, 5}, {2, 4}}, groupIDs(GroupDuplicates(images, 4)))
+	assert.Equal(t, [][]uint{{2, 4}}, groupIDs(GroupDuplicates(images, 0)))
+}
+
+func TestGroupDuplicates_MatchesPairwise(t *testing.T) {
+	// Clusters of copies a few bits apart from random originals
+	rng := rand.New(rand.NewSource(1))
+	var images []model.Image
+	for len(images) < 400 {
+		original := rng.Uint64()
+		for copies := rng.Intn(3); copies >= 0; copies-- {
+			hash := original
+			for flips := rng.Intn(8); flips > 0; flips-- {
+				hash ^= 1 << rng.Intn(64)
+			}
+			images = append(images, hashed(uint(len(images)+1), fmt.Sprintf("%016x", hash)))
+		}
+	}
+
+	for _, distance := range []int{0, 3, DuplicateDistance, 64} {
+		group := make(map[uint]int)
+		for i, g := range GroupDuplicates(images, distance) {
+			for _, img := range g {
+				group[img.ID] = i + 1
+			}
+		}
+		for i, a := range images {
+			for _, b := range images[i+1:] {
+				if NearDuplicate(a.PHash, b.PHash, distance) {
+					require.NotZero(t, group[a.ID])
+					require.Equal(t, group[a.ID], group[b.ID], "%s %s within %d", a.PHash, b.PHash, distance)
+				}
+			}
+		}
+	}
+}
+
+func TestNearDuplicateIDs(t *testing.T) {
+	candidates := []model.Image{
+		hashed(1, "f0f0f0f0f0f0f0f0"),
+		hashed(2, "0f0f0f0f0f0f0f0f"),
+		hashed(3, ""),
+	}
+	near := NearDuplicateIDs(candidates, []string{"f0f0f0f0f0f0f0f1", ""}, DuplicateDistance)
+	assert.Equal(t, map[uint]bool{1: true}, near)
+}
+
+func TestAnalyzerService_KeepDuplicate(t *testing.T) {
+	db := setupModelTestDB(t, &model.Image{})
+	for _, img := range []model.Image{
+		hashed(1, "f0f0f0f0f0f0f0f0"),
+		hashed(2, "f0f0f0f0f0f0f0f1"),
+		hashed(3, "f0f0f0f0f0f0f0f3"),
+		hashed(4, "0f0f0f0f0f0f0f0f"),
+	} {
+		require.NoError(t, db.Create(&img).Error)
+	}
+	svc := NewAnalyzerService(AnalyzerServiceDeps{DB: db})
+
+	hidden, err := svc.KeepDuplicate(1, DuplicateDistance)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{2, 3}, memoryIDs(hidden))
+
+	// Changing our mind keeps another copy instead
+	_, err = svc.KeepDuplicate(3, DuplicateDistance)
+	require.NoError(t, err)
+	var images []model.Image
+	require.NoError(t, db.Order("id").Find(&images).Error)
+	assert.Equal(t, uint(3), *images[0].DuplicateOf)
+	assert.Equal(t, uint(3), *images[1].DuplicateOf)
+	assert.Nil(t, images[2].DuplicateOf)
+	assert.Nil(t, images[3].DuplicateOf)
+
+	// Photos without duplicates have no group
+	_, err = svc.KeepDuplicate(4, DuplicateDistance)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestAnalyzerService_KeepDuplicateChain(t *testing.T) {
+	db := setupModelTestDB(t, &model.Image{})
+	// Each photo is 4 bits from the next, the ends 8 bits apart
+	for _, img := range []model.Image{
+		hashed(1, "0000000000000000"),
+		hashed(2, "000000000000000f"),
+		hashed(3, "00000000000000ff"),
+	} {
+		require.NoError(t, db.Create(&img).Error)
+	}
+	svc := NewAnalyzerService(AnalyzerServiceDeps{DB: db})
+
+	groups, err := svc.DuplicateGroups(DuplicateDistance)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	hidden, err := svc.KeepDuplicate(1, DuplicateDistance)
+	require.NoError(t, err)
+	assert.Equal(t, []uint{2}, memoryIDs(hidden))
+
+	var far model.Image
+	require.NoError(t, db.First(&far, 3).Error)
+	assert.Nil(t, far.DuplicateOf)
+}
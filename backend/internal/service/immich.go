@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/immich"
 	"gorm.io/gorm"
 )
@@ -102,6 +103,23 @@ func (s *ImmichService) ImportPhotos() error {
 		var existing model.Image
 		result := s.db.Where("immich_asset_id = ? AND source = ?", asset.ID, model.SourceImmich).First(&existing)
 		if result.Error == nil {
+			updates := map[string]interface{}{}
+			if existing.AlbumID != albumID {
+				updates["album_id"] = albumID
+			}
+			// Only pick up preferences set in Immich; local edits are kept.
+			if asset.IsFavorite && !existing.Favorite {
+				updates["favorite"] = true
+			}
+			if existing.Rating == 0 && asset.ExifInfo.Rating > 0 {
+				updates["rating"] = asset.ExifInfo.Rating
+			}
+			if existing.TakenAt == nil && asset.TakenAt() != nil {
+				updates["taken_at"] = asset.TakenAt()
+			}
+			if len(updates) > 0 {
+				s.db.Model(&existing).Updates(updates)
+			}
 			continue
 		}
 
@@ -116,9 +134,14 @@ func (s *ImmichService) ImportPhotos() error {
 			ImmichAssetID: asset.ID,
 			Source:        model.SourceImmich,
 			FilePath:      asset.OriginalFileName,
+			AlbumID:       albumID,
 			Width:         w,
 			Height:        h,
 			Orientation:   orientation,
+			Favorite:      asset.IsFavorite,
+			Rating:        asset.ExifInfo.Rating,
+			TakenAt:       asset.TakenAt(),
+			Format:        assetFormat(asset),
 			CreatedAt:     time.Now(),
 			Status:        "pending",
 		}
@@ -179,8 +202,9 @@ func (s *ImmichService) DownloadOriginal(assetID string) ([]byte, error) {
 	return client.DownloadOriginal(assetID)
 }
 
-// DownloadPhoto downloads the original full-resolution image and converts it
-// to JPEG using ImageMagick (handles HEIC, RAW formats and EXIF auto-orient).
+// DownloadPhoto downloads the original full-resolution image. Formats decoded
+// in process (JPEG, PNG, WebP, HEIC, ...) are returned as is; anything else
+// (RAW) is converted to JPEG using ImageMagick with EXIF auto-orient.
 // Falls back to Immich's preview API if original download or conversion fails.
 func (s *ImmichService) DownloadPhoto(assetID string) ([]byte, error) {
 	data, err := s.DownloadOriginal(assetID)
@@ -188,6 +212,9 @@ func (s *ImmichService) DownloadPhoto(assetID string) ([]byte, error) {
 		log.Printf("Immich original download failed for asset %s: %v, falling back to preview", assetID, err)
 		return s.downloadPreviewFallback(assetID, err)
 	}
+	if imageops.NativeFormat(imageops.SniffFormat(data)) {
+		return data, nil
+	}
 
 	tmpDir, err := os.MkdirTemp("", "immich-convert-*")
 	if err != nil {
@@ -221,3 +248,11 @@ func (s *ImmichService) downloadPreviewFallback(assetID string, originalErr erro
 	}
 	return previewData, nil
 }
+
+// assetFormat is the format of an asset's original file.
+func assetFormat(asset immich.Asset) string {
+	if format := imageops.FormatFromName(asset.OriginalMimeType); format != "" {
+		return format
+	}
+	return imageops.FormatFromName(asset.OriginalFileName)
+}
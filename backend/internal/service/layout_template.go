@@ -0,0 +1,101 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// LayoutTemplateService manages user-defined HTML layouts and which devices
+// use them.
+type LayoutTemplateService struct {
+	db      *gorm.DB
+	widgets *WidgetRegistry
+}
+
+func NewLayoutTemplateService(db *gorm.DB, widgets *WidgetRegistry) *LayoutTemplateService {
+	return &LayoutTemplateService{db: db, widgets: widgets}
+}
+
+func (s *LayoutTemplateService) ListTemplates() ([]model.LayoutTemplate, error) {
+	var templates []model.LayoutTemplate
+	if err := s.db.Order("name, id").Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (s *LayoutTemplateService) GetTemplate(id uint) (*model.LayoutTemplate, error) {
+	var t model.LayoutTemplate
+	if err := s.db.First(&t, id).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *LayoutTemplateService) CreateTemplate(t *model.LayoutTemplate) error {
+	if err := s.validate(t); err != nil {
+		return err
+	}
+	return s.db.Create(t).Error
+}
+
+func (s *LayoutTemplateService) UpdateTemplate(t *model.LayoutTemplate) error {
+	if err := s.validate(t); err != nil {
+		return err
+	}
+	return s.db.Model(t).Select("Name", "HTML", "Fields").Updates(t).Error
+}
+
+// DeleteTemplate deletes a template; devices using it go back to their
+// built-in layout.
+func (s *LayoutTemplateService) DeleteTemplate(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&model.LayoutTemplate{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&model.Device{}).Where("layout_template_id = ?", id).Update("layout_template_id", nil).Error
+	})
+}
+
+// DeviceTemplate returns the template the device uses, nil for the
+// built-in layouts.
+func (s *LayoutTemplateService) DeviceTemplate(device *model.Device) *model.LayoutTemplate {
+	if device == nil || device.LayoutTemplateID == nil {
+		return nil
+	}
+	t, err := s.GetTemplate(*device.LayoutTemplateID)
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
+// SetDeviceTemplate makes the device use a template, or its built-in layout
+// again when id is nil.
+func (s *LayoutTemplateService) SetDeviceTemplate(device *model.Device, id *uint) error {
+	if id != nil {
+		if _, err := s.GetTemplate(*id); err != nil {
+			return err
+		}
+	}
+	device.LayoutTemplateID = id
+	return s.db.Model(device).Select("LayoutTemplateID").Updates(device).Error
+}
+
+func (s *LayoutTemplateService) validate(t *model.LayoutTemplate) error {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return errors.New("name is required")
+	}
+	if strings.TrimSpace(t.HTML) == "" {
+		return errors.New("html is required")
+	}
+	return ValidateLayoutTemplate(t.HTML, t.Fields, s.widgets)
+}
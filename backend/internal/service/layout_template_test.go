@@ -0,0 +1,71 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTemplateTestService(t *testing.T) (*LayoutTemplateService, *gorm.DB) {
+	db := setupModelTestDB(t, &model.LayoutTemplate{}, &model.Device{})
+	return NewLayoutTemplateService(db, newBuiltinWidgets(t)), db
+}
+
+func TestLayoutTemplate_Validation(t *testing.T) {
+	svc, _ := newTemplateTestService(t)
+
+	ok := &model.LayoutTemplate{
+		Name:   "Quote",
+		HTML:   `<html><body><img src="data:image/jpeg;base64,{{.PhotoBase64}}"><p>{{.Fields.quote}}</p><p>{{.DeviceName}}</p>{{range .Widgets.primary}}{{.}}{{end}}{{range .WidgetData.calendar}}{{.Summary}}{{end}}</body></html>`,
+		Fields: map[string]string{"quote": "Carpe diem"},
+	}
+	require.NoError(t, svc.CreateTemplate(ok))
+	assert.NotZero(t, ok.ID)
+
+	// Doesn't parse
+	assert.Error(t, svc.CreateTemplate(&model.LayoutTemplate{Name: "broken", HTML: "{{if .ShowDate}}"}))
+	// Parses but refers to data layouts don't get
+	assert.Error(t, svc.CreateTemplate(&model.LayoutTemplate{Name: "unknown", HTML: "{{.Nope}}"}))
+	assert.Error(t, svc.CreateTemplate(&model.LayoutTemplate{Name: " ", HTML: "<p></p>"}))
+
+	ok.HTML = "{{.Missing}}"
+	assert.Error(t, svc.UpdateTemplate(ok))
+}
+
+func TestLayoutTemplate_DeleteResetsDevices(t *testing.T) {
+	svc, db := newTemplateTestService(t)
+
+	tmpl := &model.LayoutTemplate{Name: "Plain", HTML: "<p>{{.Fields.title}}</p>"}
+	require.NoError(t, svc.CreateTemplate(tmpl))
+	device := &model.Device{Name: "Kitchen", Host: "kitchen.local"}
+	require.NoError(t, db.Create(device).Error)
+
+	require.NoError(t, svc.SetDeviceTemplate(device, &tmpl.ID))
+	assert.Equal(t, tmpl.ID, svc.DeviceTemplate(device).ID)
+
+	missing := uint(999)
+	assert.Error(t, svc.SetDeviceTemplate(device, &missing))
+
+	require.NoError(t, svc.DeleteTemplate(tmpl.ID))
+	var reloaded model.Device
+	require.NoError(t, db.First(&reloaded, device.ID).Error)
+	assert.Nil(t, reloaded.LayoutTemplateID)
+	assert.Nil(t, svc.DeviceTemplate(&reloaded))
+}
+
+func TestRendererService_FingerprintTemplateTime(t *testing.T) {
+	s := &RendererService{chrome: true}
+	opts := newBuiltinWidgets(t).SampleRenderOptions(400, 240)
+	opts.Widgets = nil
+
+	// Kathmandu is never a whole number of hours off UTC, so the time differs
+	opts.Template = "<p>{{.TimeStr}}</p>"
+	opts.Timezone = "UTC"
+	utc := s.Fingerprint(opts)
+	assert.Equal(t, utc, s.Fingerprint(opts))
+	opts.Timezone = "Asia/Kathmandu"
+	assert.NotEqual(t, utc, s.Fingerprint(opts))
+}
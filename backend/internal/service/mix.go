@@ -0,0 +1,102 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// MixService stores the per-device source weights used by the mix source.
+type MixService struct {
+	db *gorm.DB
+}
+
+func NewMixService(db *gorm.DB) *MixService {
+	return &MixService{db: db}
+}
+
+func (s *MixService) GetWeights(deviceID uint) ([]model.DeviceSourceWeight, error) {
+	weights := []model.DeviceSourceWeight{}
+	if err := s.db.Where("device_id = ?", deviceID).Order("source").Find(&weights).Error; err != nil {
+		return nil, err
+	}
+	return weights, nil
+}
+
+// SetWeights replaces the device's weights. Sources with a zero weight are
+// left out of the mix.
+func (s *MixService) SetWeights(deviceID uint, weights map[string]int) error {
+	rows := make([]model.DeviceSourceWeight, 0, len(weights))
+	for source, weight := range weights {
+		if err := validateMixSource(source); err != nil {
+			return err
+		}
+		if weight < 0 {
+			return fmt.Errorf("weight for %s must not be negative", source)
+		}
+		if weight == 0 {
+			continue
+		}
+		rows = append(rows, model.DeviceSourceWeight{DeviceID: deviceID, Source: source, Weight: weight})
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("device_id = ?", deviceID).Delete(&model.DeviceSourceWeight{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+// SourceOrder returns the device's sources in the order they should be tried
+// for one pick: a weighted random draw without replacement, so the first
+// source is chosen in proportion to its weight and the rest are fallbacks
+// for when it turns out to be empty or failing.
+func (s *MixService) SourceOrder(deviceID uint) ([]string, error) {
+	weights, err := s.GetWeights(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return weightedOrder(weights, rand.Intn), nil
+}
+
+func weightedOrder(weights []model.DeviceSourceWeight, intn func(n int) int) []string {
+	remaining := make([]model.DeviceSourceWeight, 0, len(weights))
+	total := 0
+	for _, w := range weights {
+		if w.Weight > 0 {
+			remaining = append(remaining, w)
+			total += w.Weight
+		}
+	}
+
+	order := make([]string, 0, len(remaining))
+	for len(remaining) > 0 {
+		r := intn(total)
+		for i, w := range remaining {
+			if r < w.Weight {
+				order = append(order, w.Source)
+				total -= w.Weight
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+			r -= w.Weight
+		}
+	}
+	return order
+}
+
+func validateMixSource(source string) error {
+	switch source {
+	case model.SourceGooglePhotos, model.SourceSynologyPhotos, model.SourceImmich,
+		model.SourceTelegram, model.SourceURLProxy:
+		return nil
+	default:
+		return fmt.Errorf("source %s cannot be mixed", source)
+	}
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeightedOrder(t *testing.T) {
+	weights := []model.DeviceSourceWeight{
+		{Source: model.SourceImmich, Weight: 3},
+		{Source: model.SourceTelegram, Weight: 0},
+		{Source: model.SourceURLProxy, Weight: 1},
+	}
+
+	// Always taking the first slot picks sources in declaration order
+	first := func(n int) int { return 0 }
+	assert.Equal(t, []string{model.SourceImmich, model.SourceURLProxy}, weightedOrder(weights, first))
+
+	// The last slot of the total weight belongs to the URL proxy
+	last := func(n int) int { return n - 1 }
+	assert.Equal(t, []string{model.SourceURLProxy, model.SourceImmich}, weightedOrder(weights, last))
+
+	assert.Empty(t, weightedOrder(nil, first))
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/photoframe"
+)
+
+func namedColors(colors ...photoframe.NamedColor) photoframe.Palette {
+	return photoframe.Palette{Colors: colors}
+}
+
+func ink(name string, r, g, b int) photoframe.NamedColor {
+	return photoframe.NamedColor{Name: name, PaletteColor: photoframe.PaletteColor{R: r, G: g, B: b}}
+}
+
+// palettePresets are the inks of common panels with typical perceived colors,
+// in the panel's index order.
+var palettePresets = map[string]photoframe.Palette{
+	"spectra6": namedColors(
+		ink("black", 2, 2, 2), ink("white", 190, 190, 190), ink("yellow", 205, 202, 0),
+		ink("red", 135, 19, 0), ink("blue", 5, 64, 158), ink("green", 39, 102, 60),
+	),
+	"acep7": namedColors(
+		ink("black", 12, 12, 14), ink("white", 180, 180, 170), ink("green", 40, 90, 55),
+		ink("blue", 40, 50, 120), ink("red", 150, 40, 35), ink("yellow", 200, 180, 40),
+		ink("orange", 190, 100, 40),
+	),
+	"bwr": namedColors(
+		ink("black", 10, 10, 10), ink("white", 200, 200, 195), ink("red", 160, 30, 30),
+	),
+	"bw": namedColors(
+		ink("black", 10, 10, 10), ink("white", 210, 210, 205),
+	),
+	"gray4": namedColors(
+		ink("black", 10, 10, 10), ink("dark_gray", 80, 80, 80),
+		ink("light_gray", 150, 150, 150), ink("white", 210, 210, 205),
+	),
+}
+
+// PalettePresets returns the built-in panel palettes by name.
+func PalettePresets() map[string]photoframe.Palette {
+	return palettePresets
+}
+
+// PalettePresetNames returns the names of the built-in panel palettes.
+func PalettePresetNames() []string {
+	names := make([]string, 0, len(palettePresets))
+	for name := range palettePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DevicePalette resolves the palette a device's frames are converted with.
+// The device's configured palette decides the set of inks; perceived colors
+// the device reports itself (X-Color-Palette or its palette API) take
+// precedence for inks present in both, as they come from its calibration.
+// Without a configured palette the reported one is used as is, and nil means
+// the converter's Spectra 6 default.
+func DevicePalette(device *model.Device, reported *photoframe.Palette) *photoframe.Palette {
+	if device == nil || device.Palette == "" {
+		return reported
+	}
+	var configured photoframe.Palette
+	if err := json.Unmarshal([]byte(device.Palette), &configured); err != nil {
+		log.Printf("Ignoring invalid palette of device %d: %v", device.ID, err)
+		return reported
+	}
+	if reported != nil {
+		for i, c := range configured.Colors {
+			if measured, ok := reported.Get(c.Name); ok {
+				configured.Colors[i].PaletteColor = measured
+			}
+		}
+	}
+	return &configured
+}
+
+// SetPalette stores the device's panel palette; nil clears it so the palette
+// the device reports is used.
+func (s *DeviceService) SetPalette(device *model.Device, palette *photoframe.Palette) error {
+	value := ""
+	if palette != nil {
+		if err := palette.Validate(); err != nil {
+			return err
+		}
+		data, err := json.Marshal(palette)
+		if err != nil {
+			return errors.New("invalid palette")
+		}
+		value = string(data)
+	}
+	device.Palette = value
+	return s.db.Model(device).Update("palette", value).Error
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/epaper"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/photoframe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaletteJSON_KeepsInkOrder(t *testing.T) {
+	var p photoframe.Palette
+	require.NoError(t, json.Unmarshal([]byte(`{"white": {"r": 200, "g": 200, "b": 200}, "red": {"r": 160, "g": 30, "b": 30}, "black": {"r": 10, "g": 10, "b": 10}}`), &p))
+	assert.Equal(t, []string{"white", "red", "black"}, p.Names())
+
+	data, err := json.Marshal(p)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"white": {"r": 200, "g": 200, "b": 200}, "red": {"r": 160, "g": 30, "b": 30}, "black": {"r": 10, "g": 10, "b": 10}}`, string(data))
+	assert.Regexp(t, `^\{"white".*"red".*"black"`, string(data))
+
+	var list photoframe.Palette
+	require.NoError(t, json.Unmarshal([]byte(`[{"name": "black", "r": 0, "g": 0, "b": 0}, {"name": "white", "r": 255, "g": 255, "b": 255}]`), &list))
+	assert.Equal(t, []string{"black", "white"}, list.Names())
+}
+
+func TestDevicePalette_ReportedCalibrationWins(t *testing.T) {
+	gray4 := PalettePresets()["gray4"]
+	data, err := json.Marshal(gray4)
+	require.NoError(t, err)
+	device := &model.Device{Palette: string(data)}
+
+	reported := &photoframe.Palette{Colors: []photoframe.NamedColor{
+		{Name: "black", PaletteColor: photoframe.PaletteColor{R: 20, G: 20, B: 20}},
+		{Name: "yellow", PaletteColor: photoframe.PaletteColor{R: 200, G: 200, B: 0}},
+	}}
+	resolved := DevicePalette(device, reported)
+	assert.Equal(t, []string{"black", "dark_gray", "light_gray", "white"}, resolved.Names())
+	black, _ := resolved.Get("black")
+	assert.Equal(t, photoframe.PaletteColor{R: 20, G: 20, B: 20}, black)
+
+	// Without a configured palette the device's own is used
+	assert.Same(t, reported, DevicePalette(&model.Device{}, reported))
+	assert.Nil(t, DevicePalette(nil, nil))
+}
+
+func TestMapProcessingSettings_Palette(t *testing.T) {
+	bwr := PalettePresets()["bwr"]
+	opts := NewProcessorService(ProcessorNative).MapProcessingSettings(nil, &bwr)
+
+	palette, err := epaper.ParsePalette(opts["palette"])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"black", "white", "red"}, palette.Names)
+	assert.Equal(t, epaper.Color{R: 255, G: 0, B: 0}, palette.Theoretical[2])
+	assert.Equal(t, epaper.Color{R: 160, G: 30, B: 30}, palette.Perceived[2])
+	assert.False(t, palette.IsSpectra6())
+
+	for name, preset := range PalettePresets() {
+		assert.NoError(t, preset.Validate(), name)
+	}
+}
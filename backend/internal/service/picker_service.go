@@ -4,15 +4,18 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"image"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/exif"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/googlephotos"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
 	"gorm.io/gorm"
 )
 
@@ -23,8 +26,9 @@ type PickerSessionResponse struct {
 }
 
 type PickedMediaItem struct {
-	ID        string    `json:"id"`
-	MediaFile MediaFile `json:"mediaFile"`
+	ID         string    `json:"id"`
+	CreateTime string    `json:"createTime"` // RFC 3339 capture time
+	MediaFile  MediaFile `json:"mediaFile"`
 }
 
 type MediaFile struct {
@@ -232,10 +236,13 @@ func (s *PickerService) ProcessSessionItems(sessionID string) (int, error) {
 			continue
 		}
 
-		// Save to file
-		// Use ID to avoid collisions?
-		ext := ".jpg"
-		localFilename := fmt.Sprintf("%s%s", item.ID, ext)
+		// Save to file, named by ID with the extension of the reported
+		// format (corrected below once the content is sniffed)
+		format := imageops.FormatFromName(item.MediaFile.MimeType)
+		if format == "" {
+			format = imageops.FormatFromName(item.MediaFile.Filename)
+		}
+		localFilename := fmt.Sprintf("%s%s", item.ID, imageops.Extension(format))
 		localPath := filepath.Join(photosDir, localFilename)
 
 		// Check for duplicate in DB
@@ -267,13 +274,23 @@ func (s *PickerService) ProcessSessionItems(sessionID string) (int, error) {
 			continue
 		}
 
-		// Decode image config to get dimensions
+		// Record the real format, fixing the extension if the reported
+		// MIME type was wrong
+		if sniffed := sniffFileFormat(localPath); sniffed != "" && sniffed != format {
+			fixedPath := strings.TrimSuffix(localPath, filepath.Ext(localPath)) + imageops.Extension(sniffed)
+			if err := os.Rename(localPath, fixedPath); err == nil {
+				localPath = fixedPath
+			}
+			format = sniffed
+		}
+
+		// Decode image config to get dimensions (as displayed, after EXIF rotation)
 		f, err := os.Open(localPath)
 		if err != nil {
 			s.progress[sessionID].Processed++
 			continue
 		}
-		imgConfig, _, err := image.DecodeConfig(f)
+		imgConfig, _, err := imageops.DecodeConfig(f)
 		f.Close()
 
 		width := 0
@@ -288,6 +305,16 @@ func (s *PickerService) ProcessSessionItems(sessionID string) (int, error) {
 			}
 		}
 
+		// Capture time: prefer the file's EXIF (wall clock), then the
+		// picker's createTime
+		var takenAt *time.Time
+		if info, err := exif.DecodeFile(localPath); err == nil && !info.DateTimeOriginal.IsZero() {
+			takenAt = &info.DateTimeOriginal
+		} else if t, err := time.Parse(time.RFC3339, item.CreateTime); err == nil {
+			t = t.UTC()
+			takenAt = &t
+		}
+
 		// Add to DB queue
 		image := model.Image{
 			FilePath:    localPath,
@@ -299,6 +326,8 @@ func (s *PickerService) ProcessSessionItems(sessionID string) (int, error) {
 			Width:       width,
 			Height:      height,
 			Orientation: orientation,
+			TakenAt:     takenAt,
+			Format:      format,
 		}
 		s.db.Create(&image)
 		count++
@@ -310,3 +339,39 @@ func (s *PickerService) ProcessSessionItems(sessionID string) (int, error) {
 	s.progress[sessionID].Status = "done"
 	return count, nil
 }
+
+// BackfillCaptureTimes reads the EXIF capture time of downloaded photos that
+// were imported before capture times were recorded.
+func (s *PickerService) BackfillCaptureTimes() {
+	var items []model.Image
+	if err := s.db.Where("source = ? AND taken_at IS NULL", model.SourceGooglePhotos).Find(&items).Error; err != nil {
+		log.Printf("Failed to list photos for capture time backfill: %v", err)
+		return
+	}
+
+	count := 0
+	for _, item := range items {
+		info, err := exif.DecodeFile(item.FilePath)
+		if err != nil || info.DateTimeOriginal.IsZero() {
+			continue
+		}
+		if err := s.db.Model(&item).Update("taken_at", info.DateTimeOriginal).Error; err == nil {
+			count++
+		}
+	}
+	if count > 0 {
+		log.Printf("Backfilled capture time for %d Google Photos", count)
+	}
+}
+
+// sniffFileFormat identifies the format of an image file from its header.
+func sniffFileFormat(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	header := make([]byte, 32)
+	n, _ := io.ReadFull(f, header)
+	return imageops.SniffFormat(header[:n])
+}
@@ -1,65 +1,84 @@
 package service
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"image"
 	"image/jpeg"
+	"image/png"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/epaper"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/photoframe"
 	_ "golang.org/x/image/bmp" // Register BMP decoder
 )
 
+const (
+	// ProcessorNative converts images in-process with pkg/epaper.
+	ProcessorNative = "native"
+	// ProcessorCLI shells out to the epaper-image-convert CLI.
+	ProcessorCLI = "cli"
+)
+
 type ProcessorService struct {
+	engine string
 }
 
-func NewProcessorService() *ProcessorService {
-	return &ProcessorService{}
+// NewProcessorService creates a processor using the given engine, defaulting
+// to the native pipeline.
+func NewProcessorService(engine string) *ProcessorService {
+	if engine != ProcessorCLI {
+		engine = ProcessorNative
+	}
+	return &ProcessorService{engine: engine}
 }
 
+// MapProcessingSettings converts the device's processing settings and palette
+// into conversion options. Either may be nil.
 func (s *ProcessorService) MapProcessingSettings(settings *photoframe.ProcessingSettings, palette *photoframe.Palette) map[string]string {
 	opts := make(map[string]string)
-	if settings == nil {
-		return opts
-	}
-
-	opts["exposure"] = fmt.Sprintf("%v", settings.Exposure)
-	opts["saturation"] = fmt.Sprintf("%v", settings.Saturation)
-	if settings.ToneMode != "" {
-		opts["tone-mode"] = settings.ToneMode
-	}
-	opts["contrast"] = fmt.Sprintf("%v", settings.Contrast)
-	if settings.ToneMode == "scurve" {
-		opts["scurve-strength"] = fmt.Sprintf("%v", settings.Strength)
-		opts["scurve-shadow"] = fmt.Sprintf("%v", settings.ShadowBoost)
-		opts["scurve-highlight"] = fmt.Sprintf("%v", settings.HighlightCompress)
-		opts["scurve-midpoint"] = fmt.Sprintf("%v", settings.Midpoint)
-	}
-	if settings.ColorMethod != "" {
-		opts["color-method"] = settings.ColorMethod
-	}
-	if settings.DitherAlgorithm != "" {
-		opts["dither-algorithm"] = settings.DitherAlgorithm
-	}
-	if settings.CompressDynamicRange {
-		opts["compress-dynamic-range"] = "" // Boolean flag
+	if settings != nil {
+		opts["exposure"] = fmt.Sprintf("%v", settings.Exposure)
+		opts["saturation"] = fmt.Sprintf("%v", settings.Saturation)
+		if settings.ToneMode != "" {
+			opts["tone-mode"] = settings.ToneMode
+		}
+		opts["contrast"] = fmt.Sprintf("%v", settings.Contrast)
+		if settings.ToneMode == "scurve" {
+			opts["scurve-strength"] = fmt.Sprintf("%v", settings.Strength)
+			opts["scurve-shadow"] = fmt.Sprintf("%v", settings.ShadowBoost)
+			opts["scurve-highlight"] = fmt.Sprintf("%v", settings.HighlightCompress)
+			opts["scurve-midpoint"] = fmt.Sprintf("%v", settings.Midpoint)
+		}
+		if settings.ColorMethod != "" {
+			opts["color-method"] = settings.ColorMethod
+		}
+		if settings.DitherAlgorithm != "" {
+			opts["dither-algorithm"] = settings.DitherAlgorithm
+		}
+		if settings.CompressDynamicRange {
+			opts["compress-dynamic-range"] = "" // Boolean flag
+		}
 	}
 
-	if palette != nil {
+	if palette != nil && len(palette.Colors) > 0 {
+		// The palette is the panel's perceived colors; the theoretical colors
+		// written to the output are the well-known values of each ink
+		theoretical := photoframe.Palette{}
+		for _, c := range palette.Colors {
+			tc := c
+			if known, ok := epaper.TheoreticalColor(c.Name); ok {
+				tc.PaletteColor = photoframe.PaletteColor{R: known.R, G: known.G, B: known.B}
+			}
+			theoretical.Colors = append(theoretical.Colors, tc)
+		}
 		paletteWrapper := map[string]interface{}{
-			"theoretical": map[string]interface{}{
-				"black":  map[string]int{"r": 0, "g": 0, "b": 0},
-				"white":  map[string]int{"r": 255, "g": 255, "b": 255},
-				"yellow": map[string]int{"r": 255, "g": 255, "b": 0},
-				"red":    map[string]int{"r": 255, "g": 0, "b": 0},
-				"blue":   map[string]int{"r": 0, "g": 0, "b": 255},
-				"green":  map[string]int{"r": 0, "g": 255, "b": 0},
-			},
-			"perceived": palette,
+			"theoretical": theoretical,
+			"perceived":   palette,
 		}
 		paletteJSON, err := json.Marshal(paletteWrapper)
 		if err == nil {
@@ -70,7 +89,65 @@ func (s *ProcessorService) MapProcessingSettings(settings *photoframe.Processing
 	return opts
 }
 
+// Engine reports which conversion engine is in use.
+func (s *ProcessorService) Engine() string {
+	return s.engine
+}
+
+// ProcessImage converts img for the panel, returning the PNG sent to the
+// device and a JPEG thumbnail of how it will look. options are CLI flags as
+// produced by MapProcessingSettings, plus "dimension" (WxH).
 func (s *ProcessorService) ProcessImage(img image.Image, options map[string]string) ([]byte, []byte, error) {
+	if s.engine == ProcessorCLI {
+		return s.processWithCLI(img, options)
+	}
+	return s.processNative(img, options)
+}
+
+// EncodeFrame re-encodes a processed PNG in another frame format (see
+// epaper.FormatPacked4 and epaper.FormatBMP). options are the ones the frame
+// was processed with, which determine the panel's palette.
+func (s *ProcessorService) EncodeFrame(pngBytes []byte, options map[string]string, format string) ([]byte, error) {
+	if format == "" || format == epaper.FormatPNG {
+		return pngBytes, nil
+	}
+	opts, err := epaper.ParseOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	img, err := png.Decode(bytes.NewReader(pngBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode processed image: %w", err)
+	}
+	return epaper.EncodeFrame(epaper.Quantize(img, opts.Palette), opts.Palette, format)
+}
+
+func (s *ProcessorService) processNative(img image.Image, options map[string]string) ([]byte, []byte, error) {
+	opts, err := epaper.ParseOptions(options)
+	if err != nil {
+		return nil, nil, err
+	}
+	result := epaper.Process(img, opts)
+
+	var out bytes.Buffer
+	if err := png.Encode(&out, result.Image); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode processed image: %w", err)
+	}
+	var thumb bytes.Buffer
+	if err := jpeg.Encode(&thumb, result.Preview, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return out.Bytes(), thumb.Bytes(), nil
+}
+
+func (s *ProcessorService) processWithCLI(img image.Image, options map[string]string) ([]byte, []byte, error) {
+	// epaper-image-convert only knows the Spectra 6 inks
+	if paletteOpt, ok := options["palette"]; ok {
+		if palette, err := epaper.ParsePalette(paletteOpt); err == nil && !palette.IsSpectra6() {
+			return nil, nil, fmt.Errorf("palette with inks %v requires the native processor", palette.Names)
+		}
+	}
+
 	// 1. Create temp directory for this operation
 	tmpDir, err := os.MkdirTemp("", "process-*")
 	if err != nil {
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
+)
+
+// Quality issues that lower a photo's score.
+const (
+	QualityBlurry      = "blurry"
+	QualityDark        = "underexposed"
+	QualityBright      = "overexposed"
+	QualityColorless   = "colorless"
+	QualityScreenshot  = "screenshot"
+	QualityBelowCutoff = "low_score"
+)
+
+// DefaultMinQualityScore leaves the cutoff off, so no photo drops out of
+// rotation until the min_quality_score setting turns it on. A cutoff of 20
+// excludes photos that are clearly blurry, nearly black or white, or
+// screenshots, but not photos with a single mild flaw.
+const DefaultMinQualityScore = 0
+
+// ScoreQuality rates photo metrics from 0 to 100 and lists the issues found.
+// Sharpness and exposure multiply, as either alone ruins a dithered photo;
+// lack of color only costs up to half the score since black and white
+// photos are fine.
+func ScoreQuality(q imageops.Quality) (float64, []string) {
+	var issues []string
+	if q.Screenshot {
+		return 0, []string{QualityScreenshot}
+	}
+
+	sharp := math.Min(q.Sharpness/150, 1)
+	if q.Sharpness < 50 {
+		issues = append(issues, QualityBlurry)
+	}
+
+	exposure := 1.0
+	switch {
+	case q.Exposure < 0.2:
+		exposure = q.Exposure / 0.2
+	case q.Exposure > 0.8:
+		exposure = (1 - q.Exposure) / 0.2
+	}
+	switch {
+	case q.Exposure < 0.1:
+		issues = append(issues, QualityDark)
+	case q.Exposure > 0.9:
+		issues = append(issues, QualityBright)
+	}
+
+	color := math.Min(q.Colorfulness/25, 1)
+	if q.Colorfulness < 3 {
+		issues = append(issues, QualityColorless)
+	}
+
+	score := 100 * sharp * exposure * (0.5 + 0.5*color)
+	return math.Round(score*10) / 10, issues
+}
+
+// MinQualityScore returns the score below which photos are left out of
+// rotation, 0 when disabled.
+func MinQualityScore(settings *SettingsService) float64 {
+	val, err := settings.Get("min_quality_score")
+	if err != nil || strings.TrimSpace(val) == "" {
+		return DefaultMinQualityScore
+	}
+	score, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+	if err != nil || score < 0 {
+		return DefaultMinQualityScore
+	}
+	return score
+}
+
+// ExclusionReasons returns why a photo with the given score and issues is
+// left out of rotation, nil when it isn't.
+func ExclusionReasons(score *float64, issues string, minScore float64) []string {
+	if score == nil || minScore <= 0 || *score >= minScore {
+		return nil
+	}
+	if issues == "" {
+		return []string{QualityBelowCutoff}
+	}
+	return strings.Split(issues, ",")
+}
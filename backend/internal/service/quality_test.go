@@ -0,0 +1,52 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoreQuality(t *testing.T) {
+	good := imageops.Quality{Sharpness: 400, Exposure: 0.45, Colorfulness: 40}
+	score, issues := ScoreQuality(good)
+	assert.Equal(t, 100.0, score)
+	assert.Empty(t, issues)
+
+	// Black and white photos only lose part of the score
+	score, issues = ScoreQuality(imageops.Quality{Sharpness: 400, Exposure: 0.45, Colorfulness: 1})
+	assert.InDelta(t, 52, score, 1)
+	assert.Equal(t, []string{QualityColorless}, issues)
+
+	// A dark, blurry pocket shot
+	score, issues = ScoreQuality(imageops.Quality{Sharpness: 20, Exposure: 0.05, Colorfulness: 8})
+	assert.Less(t, score, 20.0)
+	assert.Equal(t, []string{QualityBlurry, QualityDark}, issues)
+
+	score, issues = ScoreQuality(imageops.Quality{Sharpness: 900, Exposure: 0.8, Colorfulness: 30, Screenshot: true})
+	assert.Zero(t, score)
+	assert.Equal(t, []string{QualityScreenshot}, issues)
+}
+
+func TestExclusionReasons(t *testing.T) {
+	low, high := 10.0, 80.0
+	assert.Equal(t, []string{QualityBlurry, QualityDark}, ExclusionReasons(&low, "blurry,underexposed", 20))
+	assert.Equal(t, []string{QualityBelowCutoff}, ExclusionReasons(&low, "", 20))
+	assert.Nil(t, ExclusionReasons(&high, "colorless", 20))
+	assert.Nil(t, ExclusionReasons(&low, "blurry", 0))
+	assert.Nil(t, ExclusionReasons(nil, "", 20))
+}
+
+func TestMinQualityScore(t *testing.T) {
+	settings := NewSettingsService(setupTestDB())
+	require.NoError(t, settings.Set("min_quality_score", ""))
+	assert.Zero(t, MinQualityScore(settings))
+
+	require.NoError(t, settings.Set("min_quality_score", "35"))
+	assert.Equal(t, 35.0, MinQualityScore(settings))
+
+	require.NoError(t, settings.Set("min_quality_score", "0"))
+	assert.Zero(t, MinQualityScore(settings))
+	require.NoError(t, settings.Set("min_quality_score", ""))
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/gcalendar"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/photoframe"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultEventWakeDelayMinutes = 2
+
+	maxRefreshIntervalMinutes = minutesPerDay
+	maxEventWakeDelayMinutes  = 60
+	minRefreshInterval        = time.Minute
+)
+
+// RefreshPolicy decides how long a frame sleeps before its next wake-up.
+type RefreshPolicy struct {
+	IntervalMinutes       int  `json:"refresh_interval_minutes"` // 0 = frame keeps its own interval
+	QuietStartMinute      int  `json:"quiet_start_minute"`       // equal start and end = no quiet hours
+	QuietEndMinute        int  `json:"quiet_end_minute"`
+	WakeForEvents         bool `json:"wake_for_events"`
+	EventWakeDelayMinutes int  `json:"event_wake_delay_minutes"`
+}
+
+type RefreshServiceDeps struct {
+	DB       *gorm.DB
+	Widgets  *WidgetRegistry
+	PFClient *photoframe.Client
+}
+
+// RefreshService stores the per-device refresh policy and computes the
+// interval the frame should sleep for after a serve.
+type RefreshService struct {
+	db       *gorm.DB
+	widgets  *WidgetRegistry // Today's events come from the calendar widget's cache
+	pfClient *photoframe.Client
+}
+
+func NewRefreshService(deps RefreshServiceDeps) *RefreshService {
+	return &RefreshService{
+		db:       deps.DB,
+		widgets:  deps.Widgets,
+		pfClient: deps.PFClient,
+	}
+}
+
+func DevicePolicy(device *model.Device) RefreshPolicy {
+	return RefreshPolicy{
+		IntervalMinutes:       device.RefreshIntervalMinutes,
+		QuietStartMinute:      device.QuietStartMinute,
+		QuietEndMinute:        device.QuietEndMinute,
+		WakeForEvents:         device.WakeForEvents,
+		EventWakeDelayMinutes: device.EventWakeDelayMinutes,
+	}
+}
+
+func (s *RefreshService) SetPolicy(device *model.Device, policy RefreshPolicy) error {
+	if policy.IntervalMinutes < 0 || policy.IntervalMinutes > maxRefreshIntervalMinutes {
+		return errors.New("refresh_interval_minutes must be between 0 and 1440")
+	}
+	if policy.QuietStartMinute < 0 || policy.QuietStartMinute >= minutesPerDay ||
+		policy.QuietEndMinute < 0 || policy.QuietEndMinute >= minutesPerDay {
+		return errors.New("quiet_start_minute and quiet_end_minute must be between 0 and 1439")
+	}
+	if policy.EventWakeDelayMinutes < 0 || policy.EventWakeDelayMinutes > maxEventWakeDelayMinutes {
+		return errors.New("event_wake_delay_minutes must be between 0 and 60")
+	}
+
+	device.RefreshIntervalMinutes = policy.IntervalMinutes
+	device.QuietStartMinute = policy.QuietStartMinute
+	device.QuietEndMinute = policy.QuietEndMinute
+	device.WakeForEvents = policy.WakeForEvents
+	device.EventWakeDelayMinutes = policy.EventWakeDelayMinutes
+	return s.db.Model(device).Select(
+		"RefreshIntervalMinutes", "QuietStartMinute", "QuietEndMinute", "WakeForEvents", "EventWakeDelayMinutes",
+	).Updates(device).Error
+}
+
+// NextRefresh returns how long the device should sleep from now, or 0 when
+// the device has no refresh policy. events are today's calendar events; when
+// nil and the policy wakes for events they are fetched here.
+func (s *RefreshService) NextRefresh(device *model.Device, events []gcalendar.Event) time.Duration {
+	policy := DevicePolicy(device)
+	if policy.IntervalMinutes <= 0 {
+		return 0
+	}
+	if policy.WakeForEvents && events == nil {
+		events = s.todayEvents(device)
+	}
+	return nextRefresh(policy, time.Now().In(DeviceLocation(device)), events)
+}
+
+// Push sends the device's base refresh interval to the frame, for frames that
+// sleep on their configured interval instead of reading the response header.
+// A pushed interval stays until pushed again, so quiet hours and event
+// wake-ups only apply through the header. The frame's config is read back to
+// confirm its firmware took the interval.
+func (s *RefreshService) Push(device *model.Device) (time.Duration, error) {
+	interval := time.Duration(device.RefreshIntervalMinutes) * time.Minute
+	if interval == 0 {
+		return 0, errors.New("device has no refresh policy")
+	}
+	seconds := int(interval.Seconds())
+	config := map[string]interface{}{
+		"rotate_interval": seconds,
+	}
+	if err := s.pfClient.PushConfig(device.Host, config); err != nil {
+		return 0, err
+	}
+	pushed, err := s.pfClient.FetchDeviceConfig(device.Host)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read back device config: %w", err)
+	}
+	if pushed.RotateInterval == nil || *pushed.RotateInterval != seconds {
+		return 0, errors.New("device firmware did not accept rotate_interval")
+	}
+	return interval, nil
+}
+
+// todayEvents returns the device's events of today, fetched through the
+// calendar widget so they are shared with its frames and not fetched again
+// within the widget's TTL.
+func (s *RefreshService) todayEvents(device *model.Device) []gcalendar.Event {
+	if s.widgets == nil {
+		return nil
+	}
+	events, _ := s.widgets.Data(device, WidgetCalendar).([]gcalendar.Event)
+	return events
+}
+
+// nextRefresh sleeps through quiet hours until they end, otherwise uses the
+// fixed interval, cut short to wake shortly after the next timed event starts.
+// now is expected to already be in the device's timezone.
+func nextRefresh(policy RefreshPolicy, now time.Time, events []gcalendar.Event) time.Duration {
+	if remaining, quiet := quietRemaining(policy, now); quiet {
+		return remaining
+	}
+
+	next := now.Add(time.Duration(policy.IntervalMinutes) * time.Minute)
+	if policy.WakeForEvents {
+		delay := time.Duration(policy.EventWakeDelayMinutes) * time.Minute
+		for _, event := range events {
+			if event.AllDay {
+				continue
+			}
+			wake := event.Start.Add(delay)
+			if !wake.After(now) || !wake.Before(next) {
+				continue
+			}
+			if _, quiet := quietRemaining(policy, wake.In(now.Location())); quiet {
+				continue
+			}
+			next = wake
+		}
+	}
+
+	interval := next.Sub(now)
+	if interval < minRefreshInterval {
+		interval = minRefreshInterval
+	}
+	return interval
+}
+
+// quietRemaining reports whether t falls inside the policy's quiet hours and
+// how long until they end. Quiet hours with end before start span midnight.
+func quietRemaining(policy RefreshPolicy, t time.Time) (time.Duration, bool) {
+	start, end := policy.QuietStartMinute, policy.QuietEndMinute
+	if start == end {
+		return 0, false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	var quiet bool
+	if start < end {
+		quiet = minute >= start && minute < end
+	} else {
+		quiet = minute >= start || minute < end
+	}
+	if !quiet {
+		return 0, false
+	}
+
+	wake := time.Date(t.Year(), t.Month(), t.Day(), end/60, end%60, 0, 0, t.Location())
+	if !wake.After(t) {
+		wake = time.Date(t.Year(), t.Month(), t.Day()+1, end/60, end%60, 0, 0, t.Location())
+	}
+	return wake.Sub(t), true
+}
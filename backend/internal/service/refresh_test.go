@@ -0,0 +1,79 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/gcalendar"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func clock(day, hour, minute int) time.Time {
+	return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestNextRefresh_QuietHours(t *testing.T) {
+	policy := RefreshPolicy{IntervalMinutes: 30, QuietStartMinute: 23 * 60, QuietEndMinute: 7 * 60}
+
+	assert.Equal(t, 30*time.Minute, nextRefresh(policy, clock(10, 12, 0), nil))
+	// Inside quiet hours the frame sleeps until they end, across midnight
+	assert.Equal(t, 8*time.Hour, nextRefresh(policy, clock(10, 23, 0), nil))
+	assert.Equal(t, 90*time.Minute, nextRefresh(policy, clock(11, 5, 30), nil))
+	assert.Equal(t, 30*time.Minute, nextRefresh(policy, clock(11, 7, 0), nil))
+
+	daytime := RefreshPolicy{IntervalMinutes: 30, QuietStartMinute: 9 * 60, QuietEndMinute: 17 * 60}
+	assert.Equal(t, 7*time.Hour, nextRefresh(daytime, clock(10, 10, 0), nil))
+	assert.Equal(t, 30*time.Minute, nextRefresh(daytime, clock(10, 8, 0), nil))
+}
+
+func TestNextRefresh_WakesForEvents(t *testing.T) {
+	policy := RefreshPolicy{IntervalMinutes: 60, WakeForEvents: true, EventWakeDelayMinutes: 2}
+	events := []gcalendar.Event{
+		{Summary: "Holiday", Start: clock(10, 0, 0), End: clock(11, 0, 0), AllDay: true},
+		{Summary: "Standup", Start: clock(10, 9, 30), End: clock(10, 9, 45)},
+		{Summary: "Lunch", Start: clock(10, 12, 0), End: clock(10, 13, 0)},
+	}
+
+	assert.Equal(t, 32*time.Minute, nextRefresh(policy, clock(10, 9, 0), events))
+	// An event that just started still gets its wake-up
+	assert.Equal(t, time.Minute, nextRefresh(policy, clock(10, 9, 31), events))
+	// Events past the interval leave it unchanged
+	assert.Equal(t, 60*time.Minute, nextRefresh(policy, clock(10, 10, 0), events))
+
+	policy.WakeForEvents = false
+	assert.Equal(t, 60*time.Minute, nextRefresh(policy, clock(10, 9, 0), events))
+}
+
+func TestNextRefresh_EventsDuringQuietHours(t *testing.T) {
+	policy := RefreshPolicy{IntervalMinutes: 60, QuietStartMinute: 22 * 60, QuietEndMinute: 6 * 60, WakeForEvents: true}
+	events := []gcalendar.Event{
+		{Summary: "Late call", Start: clock(10, 22, 15), End: clock(10, 23, 0)},
+	}
+
+	assert.Equal(t, 60*time.Minute, nextRefresh(policy, clock(10, 21, 30), events))
+}
+
+// stubCalendar stands in for the calendar widget, counting its fetches.
+type stubCalendar struct {
+	CalendarWidget
+	fetches int
+}
+
+func (w *stubCalendar) Fetch(env *WidgetEnv) (interface{}, error) {
+	w.fetches++
+	return []gcalendar.Event{}, nil
+}
+
+func TestRefreshService_NextRefreshCachesEvents(t *testing.T) {
+	widgets := NewWidgetRegistry()
+	calendar := &stubCalendar{}
+	require.NoError(t, widgets.Register(calendar))
+	s := NewRefreshService(RefreshServiceDeps{Widgets: widgets})
+
+	device := &model.Device{ID: 1, RefreshIntervalMinutes: 30, WakeForEvents: true}
+	assert.Equal(t, 30*time.Minute, s.NextRefresh(device, nil))
+	assert.Equal(t, 30*time.Minute, s.NextRefresh(device, nil))
+	assert.Equal(t, 1, calendar.fetches)
+}
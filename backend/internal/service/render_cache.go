@@ -0,0 +1,191 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RenderCache is a content-addressed disk cache of processed frames. Entries
+// are keyed by a hash of every input that affects the output, so a key hit
+// means the bytes are identical to what the pipeline would produce. Disk usage
+// is bounded by evicting the least recently used entries.
+type RenderCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*renderCacheEntry
+	size    int64
+}
+
+type renderCacheEntry struct {
+	size       int64
+	lastAccess time.Time
+}
+
+// CachedRender is a processed frame and its thumbnail.
+type CachedRender struct {
+	Image     []byte // PNG sent to the device
+	Thumbnail []byte // JPEG preview, may be nil
+}
+
+func NewRenderCache(dir string, maxBytes int64) *RenderCache {
+	c := &RenderCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*renderCacheEntry),
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Failed to create render cache directory: %v", err)
+	}
+	c.load()
+	return c
+}
+
+// CacheKey hashes the given inputs into a cache key. Inputs are JSON encoded,
+// so map keys are ordered and the key is stable across requests.
+func CacheKey(inputs ...interface{}) string {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, in := range inputs {
+		if err := enc.Encode(in); err != nil {
+			log.Printf("Failed to encode cache key input: %v", err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the cached frame for key and marks it as recently used.
+func (c *RenderCache) Get(key string) (*CachedRender, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		entry.lastAccess = time.Now()
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	img, err := os.ReadFile(c.imagePath(key))
+	if err != nil {
+		c.remove(key)
+		return nil, false
+	}
+	thumb, _ := os.ReadFile(c.thumbPath(key))
+
+	now := time.Now()
+	os.Chtimes(c.imagePath(key), now, now)
+	return &CachedRender{Image: img, Thumbnail: thumb}, true
+}
+
+// Put stores a frame and evicts old entries if the cache grew past its limit.
+func (c *RenderCache) Put(key string, render *CachedRender) {
+	if err := writeFileAtomic(c.imagePath(key), render.Image); err != nil {
+		log.Printf("Failed to write render cache entry: %v", err)
+		return
+	}
+	size := int64(len(render.Image))
+	if render.Thumbnail != nil {
+		if err := writeFileAtomic(c.thumbPath(key), render.Thumbnail); err == nil {
+			size += int64(len(render.Thumbnail))
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.entries[key]; ok {
+		c.size -= old.size
+	}
+	c.entries[key] = &renderCacheEntry{size: size, lastAccess: time.Now()}
+	c.size += size
+	c.evictLocked()
+}
+
+func (c *RenderCache) evictLocked() {
+	if c.size <= c.maxBytes {
+		return
+	}
+
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].lastAccess.Before(c.entries[keys[j]].lastAccess)
+	})
+
+	for _, key := range keys {
+		if c.size <= c.maxBytes {
+			break
+		}
+		c.size -= c.entries[key].size
+		delete(c.entries, key)
+		os.Remove(c.imagePath(key))
+		os.Remove(c.thumbPath(key))
+	}
+}
+
+func (c *RenderCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[key]; ok {
+		c.size -= entry.size
+		delete(c.entries, key)
+	}
+	os.Remove(c.imagePath(key))
+	os.Remove(c.thumbPath(key))
+}
+
+// load rebuilds the index from the files left by a previous run.
+func (c *RenderCache) load() {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, ".png") {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		key := strings.TrimSuffix(name, ".png")
+		size := info.Size()
+		if thumb, err := os.Stat(c.thumbPath(key)); err == nil {
+			size += thumb.Size()
+		}
+		c.entries[key] = &renderCacheEntry{size: size, lastAccess: info.ModTime()}
+		c.size += size
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictLocked()
+}
+
+func (c *RenderCache) imagePath(key string) string {
+	return filepath.Join(c.dir, key+".png")
+}
+
+func (c *RenderCache) thumbPath(key string) string {
+	return filepath.Join(c.dir, key+".jpg")
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewRenderCache(dir, 250)
+	blob := bytes.Repeat([]byte{1}, 100)
+
+	cache.Put("a", &CachedRender{Image: blob})
+	time.Sleep(time.Millisecond)
+	cache.Put("b", &CachedRender{Image: blob})
+	time.Sleep(time.Millisecond)
+	_, ok := cache.Get("a") // a is now more recent than b
+	require.True(t, ok)
+	time.Sleep(time.Millisecond)
+	cache.Put("c", &CachedRender{Image: blob})
+
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	got, ok := cache.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, blob, got.Image)
+
+	// Entries survive a restart
+	reopened := NewRenderCache(dir, 250)
+	_, ok = reopened.Get("c")
+	assert.True(t, ok)
+}
+
+func TestCacheKey_Stable(t *testing.T) {
+	a := CacheKey("photo", map[string]string{"x": "1", "y": "2"})
+	b := CacheKey("photo", map[string]string{"y": "2", "x": "1"})
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, CacheKey("photo", map[string]string{"x": "1"}))
+}
@@ -3,20 +3,23 @@ package service
 import (
 	"bytes"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"html/template"
 	"image"
 	"image/jpeg"
 	"image/png"
+	"io"
 	"log"
 	"math"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/gcalendar"
-	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/weather"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/launcher"
 	"github.com/go-rod/rod/lib/proto"
@@ -45,44 +48,107 @@ type RenderOptions struct {
 	NativeWidth  int    // Physical panel width (for DPI calc)
 	NativeHeight int    // Physical panel height (for DPI calc)
 	Photo        image.Image
-	ShowDate     bool
-	ShowWeather  bool
-	Weather      *weather.CurrentWeather
-	ShowCalendar bool
-	Events       []gcalendar.Event
-	Timezone     string // IANA timezone e.g. "Asia/Taipei" for date formatting
-	DateFormat   string // Go time format string, empty = default "Mon, Jan 02"
+	Widgets      []WidgetData // Fetched through the WidgetRegistry, in drawing order
+	// Template is the HTML of a user-defined layout (see model.LayoutTemplate)
+	// used instead of the built-in ones, with its Fields; empty = built-in.
+	Template   string
+	Fields     map[string]string
+	DeviceName string
+	// Timezone (IANA, empty = server local time) and DateFormat of the
+	// device, for the date and time user-defined layouts show.
+	Timezone   string
+	DateFormat string
+	// Engine picks RendererChrome or RendererNative; empty = Chrome when
+	// it is installed.
+	Engine string
 }
 
-const browserIdleTimeout = 1 * time.Minute
+// Engines RendererService renders with.
+const (
+	RendererChrome = "chrome" // The HTML layouts in headless Chrome
+	RendererNative = "native" // The built-in layouts drawn in Go, see nativeRenderer
+)
+
+// WidgetData returns the data of the named widget, nil when it isn't shown.
+func (o RenderOptions) WidgetData(name string) interface{} {
+	for _, w := range o.Widgets {
+		if w.Name == name {
+			return w.Data
+		}
+	}
+	return nil
+}
+
+const (
+	browserIdleTimeout = 1 * time.Minute
+	// browserCloseTimeout bounds waiting on Chrome to close before it is
+	// killed
+	browserCloseTimeout = 2 * time.Second
+	// renderQueueTimeout bounds how long a render waits for one of the
+	// pool's pages
+	renderQueueTimeout = 30 * time.Second
+
+	DefaultRendererPoolSize = 2
+)
+
+// renderTimeout bounds one render in Chrome. A variable for the tests.
+var renderTimeout = 20 * time.Second
 
 // RendererService renders HTML layout templates to images using headless Chrome.
 // Chrome is launched lazily on first render and shut down after 1 minute of
-// inactivity to save memory.
+// inactivity to save memory. Without Chrome, or when a device asks for it,
+// the built-in layouts are drawn natively instead.
+//
+// Up to poolSize renders run at once, each on a pre-warmed page; the rest
+// queue for one. A browser that crashed is relaunched and the render
+// retried.
 type RendererService struct {
-	browser    *rod.Browser
+	chrome     bool // Chrome was found at startup
+	native     *nativeRenderer
 	tmpl       *template.Template
 	fontBase64 string
-	mu         sync.Mutex
+
+	mu         sync.Mutex // guards the browser, its pages and the idle timer
+	browser    *rod.Browser
+	launcher   *launcher.Launcher
+	generation int         // bumped whenever the browser is closed, retiring its pages
+	pages      []*rod.Page // idle pre-warmed pages of the current browser
+	active     int         // renders holding a page
 	idleTimer  *time.Timer
+
+	poolSize int
+	slots    chan struct{}
+	stats    rendererStats
+
+	customMu sync.Mutex
+	custom   map[string]*template.Template // parsed user-defined layouts by hash
 }
 
-func NewRendererService() (*RendererService, error) {
-	funcMap := template.FuncMap{
-		"formatEventTime": gcalendar.FormatEventTime,
-		"nextEvent":       gcalendar.GetNextEvent,
-		"limitEvents":     limitEvents,
-		"mul":             mul,
-		"isPortrait": func(w, h int) bool {
-			return h > w
-		},
-		"isSmallScreen": func(w, h int) bool {
-			total := w * h
-			return total < 500000
-		},
-	}
+// templateFuncs are the functions available to layout templates.
+var templateFuncs = template.FuncMap{
+	"formatEventTime": gcalendar.FormatEventTime,
+	"nextEvent":       gcalendar.GetNextEvent,
+	"limitEvents":     limitEvents,
+	"layoutEvents":    layoutEvents,
+	"limitAgenda":     limitAgenda,
+	"limitForecast":   limitForecast,
+	"mul":             mul,
+	"isPortrait": func(w, h int) bool {
+		return h > w
+	},
+	"isSmallScreen": func(w, h int) bool {
+		total := w * h
+		return total < 500000
+	},
+}
 
-	tmpl, err := template.New("layout").Funcs(funcMap).Parse(layoutTemplate)
+// NewRendererService creates the renderer, rendering up to poolSize frames
+// in Chrome at once.
+func NewRendererService(poolSize int) (*RendererService, error) {
+	if poolSize <= 0 {
+		poolSize = DefaultRendererPoolSize
+	}
+	tmpl, err := template.New("layout").Funcs(templateFuncs).Parse(layoutTemplate)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse layout template: %w", err)
 	}
@@ -106,10 +172,42 @@ func NewRendererService() (*RendererService, error) {
 		log.Printf("Warning: could not read Material Symbols font from any known path (weather icons will degrade to text)")
 	}
 
-	return &RendererService{tmpl: tmpl, fontBase64: fontBase64}, nil
+	native, err := newNativeRenderer()
+	if err != nil {
+		return nil, err
+	}
+	_, chrome := launcher.LookPath()
+	if !chrome {
+		log.Printf("Warning: chromium/chrome not found, layouts will be rendered natively (custom layout templates are unavailable)")
+	}
+
+	return &RendererService{
+		chrome:     chrome,
+		native:     native,
+		tmpl:       tmpl,
+		fontBase64: fontBase64,
+		custom:     make(map[string]*template.Template),
+		poolSize:   poolSize,
+		slots:      make(chan struct{}, poolSize),
+	}, nil
 }
 
-// launchBrowser starts headless Chrome. Must be called with s.mu held.
+// ChromeAvailable reports whether Chrome was found, which user-defined
+// layout templates need.
+func (s *RendererService) ChromeAvailable() bool {
+	return s.chrome
+}
+
+// Engine returns the engine frames asking for engine are rendered with.
+func (s *RendererService) Engine(engine string) string {
+	if engine == RendererNative || !s.chrome {
+		return RendererNative
+	}
+	return RendererChrome
+}
+
+// launchBrowser starts headless Chrome and opens the pool's pages. Must be
+// called with s.mu held.
 func (s *RendererService) launchBrowser() error {
 	log.Println("Launching headless Chrome for renderer...")
 	path, found := launcher.LookPath()
@@ -117,37 +215,57 @@ func (s *RendererService) launchBrowser() error {
 		return fmt.Errorf("chromium/chrome not found")
 	}
 
-	u, err := launcher.New().Bin(path).
+	l := launcher.New().Bin(path).
 		Headless(true).
 		Set("no-sandbox", "").
 		Set("disable-gpu", "").
-		Set("disable-dev-shm-usage", "").
-		Launch()
+		Set("disable-dev-shm-usage", "")
+	u, err := l.Launch()
 	if err != nil {
 		return fmt.Errorf("failed to launch browser: %w", err)
 	}
 
 	browser := rod.New().ControlURL(u)
 	if err := browser.Connect(); err != nil {
+		l.Kill()
 		return fmt.Errorf("failed to connect to browser: %w", err)
 	}
 
 	s.browser = browser
-	log.Println("Headless Chrome launched successfully")
+	s.launcher = l
+	for i := 0; i < s.poolSize; i++ {
+		page, err := browser.Page(proto.TargetCreateTarget{URL: "about:blank"})
+		if err != nil {
+			break
+		}
+		s.pages = append(s.pages, page)
+	}
+	log.Printf("Headless Chrome launched successfully with %d pages", len(s.pages))
 	return nil
 }
 
-// closeBrowser shuts down Chrome. Must be called with s.mu held.
-func (s *RendererService) closeBrowser() {
-	if s.browser != nil {
-		log.Println("Closing idle headless Chrome to free memory")
-		s.browser.Close()
-		s.browser = nil
-	}
+// detachBrowser retires the running browser and its pages, returning a
+// function that shuts it down. Must be called with s.mu held; call the
+// function after releasing it, as a hung browser takes a while to close.
+func (s *RendererService) detachBrowser() func() {
+	browser, l := s.browser, s.launcher
+	s.browser = nil
+	s.launcher = nil
+	s.pages = nil
+	s.generation++
 	if s.idleTimer != nil {
 		s.idleTimer.Stop()
 		s.idleTimer = nil
 	}
+	return func() {
+		if browser != nil {
+			browser.Timeout(browserCloseTimeout).Close()
+		}
+		if l != nil {
+			// Makes sure a hung or crashed browser is gone too
+			l.Kill()
+		}
+	}
 }
 
 // resetIdleTimer resets the idle shutdown timer. Must be called with s.mu held.
@@ -157,119 +275,345 @@ func (s *RendererService) resetIdleTimer() {
 	}
 	s.idleTimer = time.AfterFunc(browserIdleTimeout, func() {
 		s.mu.Lock()
-		defer s.mu.Unlock()
-		s.closeBrowser()
+		if s.active > 0 || s.browser == nil {
+			s.mu.Unlock()
+			return
+		}
+		closeBrowser := s.detachBrowser()
+		s.mu.Unlock()
+		log.Println("Closing idle headless Chrome to free memory")
+		closeBrowser()
 	})
 }
 
-// ensureBrowser launches Chrome if not running, and resets the idle timer.
-func (s *RendererService) ensureBrowser() error {
+// takePage returns an idle page, launching Chrome if it isn't running, and
+// the browser generation it belongs to.
+func (s *RendererService) takePage() (*rod.Page, int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if s.browser == nil {
 		if err := s.launchBrowser(); err != nil {
-			return err
+			return nil, 0, err
 		}
 	}
+	var page *rod.Page
+	if n := len(s.pages); n > 0 {
+		page = s.pages[n-1]
+		s.pages = s.pages[:n-1]
+	} else {
+		var err error
+		if page, err = s.browser.Page(proto.TargetCreateTarget{URL: "about:blank"}); err != nil {
+			return nil, 0, fmt.Errorf("failed to create page: %w", err)
+		}
+	}
+	s.active++
 	s.resetIdleTimer()
-	return nil
+	return page, s.generation, nil
 }
 
-func (s *RendererService) Close() {
+// returnPage puts a page back in the pool, or closes it when its render
+// failed or its browser is gone.
+func (s *RendererService) returnPage(page *rod.Page, generation int, ok bool) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.closeBrowser()
+	s.active--
+	pooled := ok && generation == s.generation && len(s.pages) < s.poolSize
+	if pooled {
+		s.pages = append(s.pages, page)
+	}
+	current := generation == s.generation
+	s.resetIdleTimer()
+	s.mu.Unlock()
+
+	if !pooled && current {
+		page.Timeout(browserCloseTimeout).Close()
+	}
 }
 
-// Render renders the given options to an image.
-func (s *RendererService) Render(opts RenderOptions) (image.Image, error) {
-	if err := s.ensureBrowser(); err != nil {
-		return nil, fmt.Errorf("renderer not available: %w", err)
+// recoverBrowser checks the browser after a failed render and relaunches it
+// on the next render if it crashed or hung. Returns whether it did.
+func (s *RendererService) recoverBrowser(generation int) bool {
+	s.mu.Lock()
+	browser := s.browser
+	if generation != s.generation || browser == nil {
+		// Already replaced by another render
+		s.mu.Unlock()
+		return true
 	}
+	s.mu.Unlock()
 
-	// Encode photo as base64 JPEG
-	photoBase64, err := imageToBase64(opts.Photo)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encode photo: %w", err)
+	if _, err := (proto.BrowserGetVersion{}).Call(browser.Timeout(2 * time.Second)); err == nil {
+		return false
 	}
 
-	// Calculate DPI-aware sizes
-	dpmm := calcDPMM(opts.Width, opts.Height, opts.NativeWidth, opts.NativeHeight)
+	s.mu.Lock()
+	if generation != s.generation {
+		s.mu.Unlock()
+		return true
+	}
+	log.Println("Headless Chrome stopped responding, relaunching")
+	closeBrowser := s.detachBrowser()
+	s.stats.restarts++
+	s.mu.Unlock()
+	closeBrowser()
+	return true
+}
 
-	// Determine max events to show based on screen size and layout
-	maxEvents := calcMaxEvents(opts.Layout, opts.Width, opts.Height)
+// rendererStats are the counters behind Stats, guarded by s.mu.
+type rendererStats struct {
+	queued     int
+	renders    int64
+	failures   int64
+	restarts   int64
+	lastRender time.Duration
+	avgRender  time.Duration
+	avgWait    time.Duration
+}
 
-	// Compute the photo area ratio based on layout
-	photoRatio := calcPhotoRatio(opts.Layout, opts.Width, opts.Height)
+// RendererStats reports how renders in Chrome are keeping up.
+type RendererStats struct {
+	ChromeAvailable bool  `json:"chrome_available"`
+	BrowserRunning  bool  `json:"browser_running"`
+	PoolSize        int   `json:"pool_size"`
+	Active          int   `json:"active"` // Renders holding a page
+	Queued          int   `json:"queued"` // Renders waiting for one
+	Renders         int64 `json:"renders"`
+	Failures        int64 `json:"failures"`
+	Restarts        int64 `json:"restarts"` // Relaunches after the browser crashed or hung
+	LastRenderMs    int64 `json:"last_render_ms"`
+	AvgRenderMs     int64 `json:"avg_render_ms"` // Moving averages; render time excludes the wait
+	AvgWaitMs       int64 `json:"avg_wait_ms"`
+}
+
+// Stats returns the renderer's queue depth, latency and failure counts.
+func (s *RendererService) Stats() RendererStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return RendererStats{
+		ChromeAvailable: s.chrome,
+		BrowserRunning:  s.browser != nil,
+		PoolSize:        s.poolSize,
+		Active:          s.active,
+		Queued:          s.stats.queued,
+		Renders:         s.stats.renders,
+		Failures:        s.stats.failures,
+		Restarts:        s.stats.restarts,
+		LastRenderMs:    s.stats.lastRender.Milliseconds(),
+		AvgRenderMs:     s.stats.avgRender.Milliseconds(),
+		AvgWaitMs:       s.stats.avgWait.Milliseconds(),
+	}
+}
 
-	// Determine next event for overlay display.
-	// For overlay layout on small screens, skip all-day events.
-	var nextEvent *gcalendar.Event
-	if opts.ShowCalendar && len(opts.Events) > 0 {
-		filteredForNext := filterEventsForLayout(opts.Layout, opts.Events, maxEvents)
-		if len(filteredForNext) > 0 {
-			nextEvent = gcalendar.GetNextEvent(filteredForNext)
+// recordRender adds a finished render in Chrome to the stats.
+func (s *RendererService) recordRender(wait, took time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Exponential moving averages, seeded with the first sample
+	average := func(avg, sample time.Duration) time.Duration {
+		if avg == 0 {
+			return sample
 		}
+		return avg + (sample-avg)/8
+	}
+	s.stats.avgWait = average(s.stats.avgWait, wait)
+	if err != nil {
+		s.stats.failures++
+		log.Printf("Render failed after waiting %s: %v", wait.Round(time.Millisecond), err)
+	} else {
+		s.stats.avgRender = average(s.stats.avgRender, took)
+		s.stats.lastRender = took
 	}
+	s.stats.renders++
+}
 
-	displayMode := opts.DisplayMode
-	if displayMode == "" {
-		displayMode = "cover"
+func (s *RendererService) Close() {
+	s.mu.Lock()
+	closeBrowser := s.detachBrowser()
+	s.mu.Unlock()
+	closeBrowser()
+}
+
+// maxCustomTemplates bounds the parsed user-defined layouts kept around.
+const maxCustomTemplates = 32
+
+// layoutFor returns the template to render opts with, parsing a
+// user-defined layout the first time it is used.
+func (s *RendererService) layoutFor(opts RenderOptions) (*template.Template, error) {
+	if opts.Template == "" {
+		return s.tmpl, nil
 	}
+	key := CacheKey(opts.Template)
+	s.customMu.Lock()
+	defer s.customMu.Unlock()
+	if tmpl, ok := s.custom[key]; ok {
+		return tmpl, nil
+	}
+	tmpl, err := ParseLayoutTemplate(opts.Template)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.custom) >= maxCustomTemplates {
+		clear(s.custom)
+	}
+	s.custom[key] = tmpl
+	return tmpl, nil
+}
 
-	// Viewport-relative base unit with dampened scaling for large screens.
-	// Uses power-law: baseUnit = 4.8 * (minDim/480)^0.62
-	// At 800x480:    baseUnit = 4.8  (reference)
-	// At 1200x1600:  baseUnit ≈ 8.5
-	minDim := opts.Width
-	if opts.Height < minDim {
-		minDim = opts.Height
+// ParseLayoutTemplate parses the HTML of a user-defined layout.
+func ParseLayoutTemplate(html string) (*template.Template, error) {
+	tmpl, err := template.New("custom").Funcs(templateFuncs).Parse(html)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse layout template: %w", err)
 	}
-	baseUnit := 4.8 * math.Pow(float64(minDim)/480.0, 0.62)
+	return tmpl, nil
+}
+
+// ValidateLayoutTemplate checks that a user-defined layout parses and
+// executes against sample data of every registered widget, so mistakes such
+// as unknown fields are caught when it is saved rather than when a device
+// wakes up.
+func ValidateLayoutTemplate(html string, fields map[string]string, widgets *WidgetRegistry) error {
+	tmpl, err := ParseLayoutTemplate(html)
+	if err != nil {
+		return err
+	}
+	opts := widgets.SampleRenderOptions(800, 480)
+	opts.Template = html
+	opts.Fields = fields
+	data, err := newTemplateData(opts, "")
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(io.Discard, data); err != nil {
+		return fmt.Errorf("failed to execute layout template: %w", err)
+	}
+	return nil
+}
 
-	// Use device timezone for date formatting if available.
-	now := time.Now()
-	if opts.Timezone != "" {
-		if loc, err := time.LoadLocation(opts.Timezone); err == nil {
-			now = now.In(loc)
+// sampleRenderOptions returns options with a placeholder photo, for
+// previewing layouts.
+func sampleRenderOptions(w, h int) RenderOptions {
+	photo := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Sky to sea gradient
+			t := float64(y) / float64(h)
+			photo.Pix[y*photo.Stride+x*4] = uint8(80 + 100*t)
+			photo.Pix[y*photo.Stride+x*4+1] = uint8(150 + 50*float64(x)/float64(w))
+			photo.Pix[y*photo.Stride+x*4+2] = uint8(230 - 90*t)
+			photo.Pix[y*photo.Stride+x*4+3] = 255
 		}
 	}
+	return RenderOptions{
+		Layout:       model.LayoutPhotoOverlay,
+		DisplayMode:  "cover",
+		Width:        w,
+		Height:       h,
+		NativeWidth:  w,
+		NativeHeight: h,
+		Photo:        photo,
+		DeviceName:   "Sample frame",
+	}
+}
+
+// Render renders the given options to an image. Natively rendered frames
+// use the built-in layout even when opts has a user-defined Template.
+func (s *RendererService) Render(opts RenderOptions) (image.Image, error) {
+	img, _, err := s.RenderFrame(opts)
+	return img, err
+}
 
-	data := templateData{
-		Layout:       opts.Layout,
-		DisplayMode:  displayMode,
-		Width:        opts.Width,
-		Height:       opts.Height,
-		PhotoBase64:  photoBase64,
-		FontBase64:   s.fontBase64,
-		DPMM:         dpmm,
-		BaseUnit:     baseUnit,
-		ShowDate:     opts.ShowDate,
-		DateStr:      now.Format(dateFormat(opts.DateFormat)),
-		DateStrLong:  now.Format("Monday, January 02, 2006"),
-		TimeStr:      now.Format("15:04"),
-		ShowWeather:  opts.ShowWeather,
-		Weather:      opts.Weather,
-		ShowCalendar: opts.ShowCalendar,
-		Events:       filterEventsForLayout(opts.Layout, opts.Events, maxEvents),
-		NextEvent:    nextEvent,
-		IsPortrait:   opts.Height > opts.Width,
-		IsSmall:      (opts.Width * opts.Height) < 500000,
-		PhotoRatio:   photoRatio,
+// RenderFrame is Render that also returns the engine the frame was drawn
+// with, which is native rather than Engine(opts.Engine) when Chrome could
+// not be launched.
+func (s *RendererService) RenderFrame(opts RenderOptions) (image.Image, string, error) {
+	if s.Engine(opts.Engine) == RendererNative {
+		img, err := s.native.Render(opts)
+		return img, RendererNative, err
+	}
+	tmpl, err := s.layoutFor(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := newTemplateData(opts, s.fontBase64)
+	if err != nil {
+		return nil, "", err
 	}
 
 	var htmlBuf bytes.Buffer
-	if err := s.tmpl.Execute(&htmlBuf, data); err != nil {
-		return nil, fmt.Errorf("failed to execute template: %w", err)
+	if err := tmpl.Execute(&htmlBuf, data); err != nil {
+		return nil, "", fmt.Errorf("failed to execute template: %w", err)
 	}
 
-	// Render HTML to image using headless Chrome
-	page, err := s.browser.Page(proto.TargetCreateTarget{URL: "about:blank"})
+	wait, err := s.acquireSlot()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create page: %w", err)
+		s.recordRender(wait, 0, err)
+		return nil, "", err
 	}
-	defer page.Close()
+	defer func() { <-s.slots }()
+
+	start := time.Now()
+	img, err := s.renderPage(opts, htmlBuf.String())
+	if errors.Is(err, errBrowserUnavailable) {
+		log.Printf("Chrome not available, rendering natively: %v", err)
+		img, err = s.native.Render(opts)
+		return img, RendererNative, err
+	}
+	s.recordRender(wait, time.Since(start), err)
+	return img, RendererChrome, err
+}
+
+// errBrowserUnavailable is returned by renderPage when Chrome can't be
+// launched.
+var errBrowserUnavailable = errors.New("browser unavailable")
+
+// acquireSlot waits for one of the pool's render slots and returns how long
+// it waited.
+func (s *RendererService) acquireSlot() (time.Duration, error) {
+	start := time.Now()
+	s.mu.Lock()
+	s.stats.queued++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.stats.queued--
+		s.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(renderQueueTimeout)
+	defer timer.Stop()
+	select {
+	case s.slots <- struct{}{}:
+		return time.Since(start), nil
+	case <-timer.C:
+		return time.Since(start), fmt.Errorf("renderer busy: no page free after %s", renderQueueTimeout)
+	}
+}
+
+// renderPage renders html on a pooled page, retrying once on a fresh
+// browser if Chrome crashed during the render.
+func (s *RendererService) renderPage(opts RenderOptions, html string) (image.Image, error) {
+	for attempt := 0; ; attempt++ {
+		page, generation, err := s.takePage()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errBrowserUnavailable, err)
+		}
+		img, err := screenshotPage(page.Timeout(renderTimeout), opts, html)
+		s.returnPage(page, generation, err == nil)
+		if err == nil {
+			return img, nil
+		}
+		if !s.recoverBrowser(generation) || attempt > 0 {
+			return nil, err
+		}
+		log.Printf("Retrying render after browser failure: %v", err)
+	}
+}
+
+// screenshotPage renders html on the page. The page's context carries the
+// render deadline.
+func screenshotPage(page *rod.Page, opts RenderOptions, html string) (image.Image, error) {
+	defer page.CancelTimeout()
 
 	// Set viewport to exact device dimensions
 	if err := page.SetViewport(&proto.EmulationSetDeviceMetricsOverride{
@@ -280,12 +624,14 @@ func (s *RendererService) Render(opts RenderOptions) (image.Image, error) {
 		return nil, fmt.Errorf("failed to set viewport: %w", err)
 	}
 
-	if err := page.SetDocumentContent(htmlBuf.String()); err != nil {
+	if err := page.SetDocumentContent(html); err != nil {
 		return nil, fmt.Errorf("failed to set page content: %w", err)
 	}
 
 	// Wait for fonts and images to load
-	page.MustWaitStable()
+	if err := page.WaitStable(time.Second); err != nil {
+		return nil, fmt.Errorf("failed waiting for page: %w", err)
+	}
 
 	// Take screenshot
 	screenshot, err := page.Screenshot(true, &proto.PageCaptureScreenshot{
@@ -311,37 +657,129 @@ func (s *RendererService) Render(opts RenderOptions) (image.Image, error) {
 	return img, nil
 }
 
+// newTemplateData computes what layout templates see for the given options.
+func newTemplateData(opts RenderOptions, fontBase64 string) (templateData, error) {
+	// Calculate DPI-aware sizes
+	dpmm := calcDPMM(opts.Width, opts.Height, opts.NativeWidth, opts.NativeHeight)
+
+	// Compute the photo area ratio based on layout
+	photoRatio := calcPhotoRatio(opts.Layout, opts.Width, opts.Height)
+
+	widgets, err := renderWidgets(opts)
+	if err != nil {
+		return templateData{}, err
+	}
+	widgetData := make(map[string]interface{})
+	for _, w := range opts.Widgets {
+		widgetData[w.Name] = w.Data
+	}
+	clock := templateClock(opts)
+
+	displayMode := opts.DisplayMode
+	if displayMode == "" {
+		displayMode = "cover"
+	}
+	// Dashboards may have no photo at all
+	photo := opts.Photo
+	objectPosition := "50% 50%"
+	var photoBase64 string
+	if photo != nil {
+		if displayMode == "cover" || opts.Layout == model.LayoutDashboard {
+			// object-fit crops in the browser, so a manual crop window is
+			// applied to the pixels up front
+			boxW, boxH := photoBox(opts.Layout, opts.Width, opts.Height, photoRatio)
+			photo = imageops.CropTo(photo, boxW, boxH)
+			objectPosition = imageops.ObjectPosition(imageops.FocusOf(photo))
+		}
+
+		// Encode photo as base64 JPEG
+		photoBase64, err = imageToBase64(photo)
+		if err != nil {
+			return templateData{}, fmt.Errorf("failed to encode photo: %w", err)
+		}
+	}
+
+	return templateData{
+		Layout:         opts.Layout,
+		DisplayMode:    displayMode,
+		ObjectPosition: objectPosition,
+		Width:          opts.Width,
+		Height:         opts.Height,
+		PhotoBase64:    photoBase64,
+		FontBase64:     fontBase64,
+		DPMM:           dpmm,
+		BaseUnit:       calcBaseUnit(opts.Width, opts.Height),
+		Widgets:        widgets,
+		WidgetData:     widgetData,
+		IsPortrait:     opts.Height > opts.Width,
+		IsSmall:        (opts.Width * opts.Height) < 500000,
+		PhotoRatio:     photoRatio,
+		DeviceName:     opts.DeviceName,
+		Fields:         opts.Fields,
+		DateStr:        clock.Short,
+		DateStrLong:    clock.Long,
+		TimeStr:        clock.Time,
+	}, nil
+}
+
+// templateClock returns the date and time for user-defined layouts: the date
+// widget's when the device shows it, which may have its zone from the
+// weather, otherwise the current time in the device's timezone.
+func templateClock(opts RenderOptions) *DateData {
+	if date, ok := opts.WidgetData(WidgetDate).(*DateData); ok {
+		return date
+	}
+	env := &WidgetEnv{Timezone: opts.Timezone}
+	return newDateData(env.Now(), opts.DateFormat)
+}
+
 type templateData struct {
-	Layout       string
-	DisplayMode  string // "cover" or "contain"
-	Width        int
-	Height       int
-	PhotoBase64  string
-	FontBase64   string
-	DPMM         float64 // dots per mm (kept for compatibility)
-	BaseUnit     float64 // min(width,height)/100, for viewport-relative sizing
-	ShowDate     bool
-	DateStr      string // short: "Mon, Jan 02"
-	DateStrLong  string // long: "Monday, January 02, 2006"
-	TimeStr      string
-	ShowWeather  bool
-	Weather      *weather.CurrentWeather
-	ShowCalendar bool
-	Events       []gcalendar.Event
-	NextEvent    *gcalendar.Event
-	IsPortrait   bool
-	IsSmall      bool
-	PhotoRatio   float64 // fraction of screen for photo (0.0-1.0)
+	Layout      string
+	DisplayMode string // "cover" or "contain"
+	// ObjectPosition keeps the photo's focus in view when cropping in cover mode
+	ObjectPosition string
+	Width          int
+	Height         int
+	PhotoBase64    string
+	FontBase64     string
+	DPMM           float64 // dots per mm (kept for compatibility)
+	BaseUnit       float64 // min(width,height)/100, for viewport-relative sizing
+	IsPortrait     bool
+	IsSmall        bool
+	PhotoRatio     float64 // fraction of screen for photo (0.0-1.0)
+	// Drawn widgets by placement: "primary", "secondary" and "detail"
+	Widgets map[string][]template.HTML
+	// Only used by user-defined layouts
+	DeviceName string
+	Fields     map[string]string      // the template's own settings
+	WidgetData map[string]interface{} // what each widget fetched, by name
+	// The date and time regardless of widgets, as in the date widget
+	DateStr     string
+	DateStrLong string
+	TimeStr     string
 }
 
 func imageToBase64(img image.Image) (string, error) {
 	var buf bytes.Buffer
-	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+	if err := jpeg.Encode(&buf, imageops.Unwrap(img), &jpeg.Options{Quality: 90}); err != nil {
 		return "", err
 	}
 	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
 }
 
+// calcBaseUnit returns the viewport-relative base unit text is sized in,
+// with dampened scaling for large screens.
+// Uses power-law: baseUnit = 4.8 * (minDim/480)^0.62
+// At 800x480:    baseUnit = 4.8  (reference)
+// At 1200x1600:  baseUnit ≈ 8.5
+func calcBaseUnit(w, h int) float64 {
+	minDim := w
+	if h < minDim {
+		minDim = h
+	}
+	return 4.8 * math.Pow(float64(minDim)/480.0, 0.62)
+}
+
 func calcDPMM(logicalW, logicalH, nativeW, nativeH int) float64 {
 	key := fmt.Sprintf("%dx%d", nativeW, nativeH)
 	profile, ok := displayProfiles[key]
@@ -379,6 +817,11 @@ func calcMaxEvents(layout string, w, h int) int {
 			return 2
 		}
 		return 6
+	case model.LayoutDashboard:
+		if isSmall {
+			return 8
+		}
+		return 14
 	default:
 		return 1
 	}
@@ -403,11 +846,73 @@ func calcPhotoRatio(layout string, w, h int) float64 {
 			return 0.60
 		}
 		return 0.80
+	case model.LayoutDashboard:
+		// The photo tile
+		if isPortrait {
+			return 0.25
+		}
+		return 0.30
 	default:
 		return 1.0 // photo_overlay: full screen
 	}
 }
 
+// photoBox returns the size of the photo area: a column beside the panel
+// for the landscape side panel layout, the top rows otherwise. The
+// dashboard's tile sits below its header.
+func photoBox(layout string, w, h int, ratio float64) (int, int) {
+	if layout == model.LayoutDashboard {
+		if w >= h {
+			return int(float64(w) * ratio), h * 3 / 4
+		}
+		return w, int(float64(h) * ratio)
+	}
+	if layout == model.LayoutSidePanel && w >= h {
+		return int(float64(w) * ratio), h
+	}
+	return w, int(float64(h) * ratio)
+}
+
+// Fingerprint summarizes everything besides the photo that Render's output
+// depends on at the current time: layout, dimensions and the widgets as
+// drawn right now. Two calls with the same fingerprint and photo render
+// identical frames.
+func (s *RendererService) Fingerprint(opts RenderOptions) string {
+	// Drawing the widgets is cheap, and covers whatever they show
+	widgets, err := renderWidgets(opts)
+	if err != nil {
+		widgets = nil
+	}
+
+	engine := s.Engine(opts.Engine)
+	templateHash := layoutTemplateHash
+	if engine == RendererNative {
+		templateHash = nativeLayoutVersion
+	} else if opts.Template != "" {
+		// User-defined layouts may show any of the widgets' data, the date,
+		// and the time when they use it
+		widgetData := make([]interface{}, len(opts.Widgets))
+		for i, w := range opts.Widgets {
+			widgetData[i] = w.Data
+		}
+		clock := *templateClock(opts)
+		if !strings.Contains(opts.Template, ".TimeStr") {
+			clock.Time = ""
+		}
+		templateHash = CacheKey(opts.Template, opts.Fields, opts.DeviceName, widgetData, clock)
+	}
+	return CacheKey(engine, templateHash, opts.Layout, opts.DisplayMode,
+		opts.Width, opts.Height, opts.NativeWidth, opts.NativeHeight, widgets)
+}
+
+// layoutTemplateHash changes whenever the layout template does, so cached
+// frames from an older template are never served.
+var layoutTemplateHash = CacheKey(layoutTemplate)
+
+// nativeLayoutVersion plays the part of layoutTemplateHash for natively
+// rendered frames; bump it when nativeRenderer draws differently.
+const nativeLayoutVersion = "native-1"
+
 // dateFormat returns the Go time format string to use for date rendering.
 // An empty string falls back to the default English short format.
 func dateFormat(fmt string) string {
@@ -457,7 +962,8 @@ func init() {
 	log.SetFlags(log.LstdFlags)
 }
 
-// The HTML/CSS template for all 3 layouts
+// The HTML/CSS template for all 4 layouts. Widgets are drawn into the
+// areas their placement names.
 const layoutTemplate = `<!DOCTYPE html>
 <html>
 <head>
@@ -516,6 +1022,7 @@ const layoutTemplate = `<!DOCTYPE html>
     width: 100%;
     height: 100%;
     object-fit: {{.DisplayMode}};
+    object-position: {{.ObjectPosition}};
     display: block;
     position: relative;
     z-index: 1;
@@ -764,6 +1271,94 @@ const layoutTemplate = `<!DOCTYPE html>
     overflow: hidden;
   }
 
+  /* --- LAYOUT 4: Dashboard --- */
+  .layout-dashboard {
+    --body-size: {{printf "%.1f" (mul .BaseUnit 3.6)}}px;
+    --secondary-size: {{printf "%.1f" (mul .BaseUnit 3.0)}}px;
+    --heading-size: {{printf "%.1f" (mul .BaseUnit 5.6)}}px;
+    --icon-size: {{printf "%.1f" (mul .BaseUnit 9.0)}}px;
+    --small-icon-size: {{printf "%.1f" (mul .BaseUnit 5.0)}}px;
+    --padding: {{printf "%.1f" (mul .BaseUnit 3.6)}}px;
+    --gap: {{printf "%.1f" (mul .BaseUnit 2.4)}}px;
+    width: 100%;
+    height: 100%;
+    padding: var(--padding);
+    background: #fff;
+    color: #000;
+    display: flex;
+    flex-direction: column;
+    overflow: hidden;
+  }
+  .layout-dashboard .info-header {
+    margin-bottom: 0;
+  }
+  .layout-dashboard .date {
+    font-size: calc(var(--heading-size) * 1.3);
+  }
+  .dashboard-body {
+    flex: 1;
+    min-height: 0;
+    display: flex;
+    gap: calc(var(--gap) * 2);
+  }
+  .layout-dashboard.portrait .dashboard-body {
+    flex-direction: column;
+  }
+  .dashboard-cell {
+    flex: 1 1 0;
+    min-width: 0;
+    min-height: 0;
+    overflow: hidden;
+  }
+  .dashboard-tile {
+    flex: 0 0 {{printf "%.0f" (mul .PhotoRatio 100)}}%;
+    overflow: hidden;
+  }
+  .dashboard-tile img {
+    width: 100%;
+    height: 100%;
+    object-fit: cover;
+    object-position: {{.ObjectPosition}};
+    display: block;
+  }
+
+  .agenda-day {
+    font-size: var(--body-size);
+    font-weight: 600;
+    margin-top: calc(var(--gap) * 0.6);
+  }
+  .agenda-day:first-child {
+    margin-top: 0;
+  }
+  .forecast-hours {
+    display: flex;
+    justify-content: space-between;
+    margin-bottom: var(--gap);
+  }
+  .forecast-hour {
+    display: flex;
+    flex-direction: column;
+    align-items: center;
+  }
+  .forecast-day {
+    display: flex;
+    align-items: center;
+    gap: var(--gap);
+    padding: calc(var(--gap) * 0.3) 0;
+    font-size: var(--body-size);
+  }
+  .forecast-day-name {
+    min-width: 2.5em;
+    font-weight: 600;
+  }
+  .forecast-temp {
+    font-size: var(--body-size);
+    font-weight: 600;
+  }
+  .forecast-day .forecast-temp {
+    flex: 1;
+  }
+
 </style>
 </head>
 <body>
@@ -777,72 +1372,15 @@ const layoutTemplate = `<!DOCTYPE html>
   </div>
   <div class="info-panel">
     <div class="info-header">
-      {{if .ShowDate}}
-      <div>
-        <div class="date">{{.DateStr}}</div>
-      </div>
-      {{end}}
-      {{if and .ShowWeather .Weather}}
-      <div class="weather-block">
-        <span class="material-symbols-outlined weather-icon">{{.Weather.IconName}}</span>
-        <div>
-          <div class="weather-temp">{{printf "%.1f" .Weather.Temperature}}&deg;C</div>
-          <div class="weather-details">{{.Weather.Humidity}}% humidity</div>
-        </div>
-      </div>
-      {{end}}
+      {{with .Widgets.primary}}<div>{{range .}}{{.}}{{end}}</div>{{end}}
+      {{with .Widgets.secondary}}<div>{{range .}}{{.}}{{end}}</div>{{end}}
     </div>
 
-    {{if and .ShowCalendar (gt (len .Events) 0)}}
+    {{with .Widgets.detail}}
     <hr class="divider">
-    <ul class="events-list">
-      {{range .Events}}
-      <li class="event-item">
-        <span class="event-time">{{formatEventTime .}}</span>
-        <span class="event-title">{{.Summary}}</span>
-      </li>
-      {{end}}
-    </ul>
-    {{end}}
-  </div>
-</div>
-
-{{else if eq .Layout "photo_overlay"}}
-<!-- LAYOUT 2: Full Photo + Bottom Overlay -->
-<div class="layout-photo_overlay">
-  <div class="photo-area">
-    {{if eq .DisplayMode "contain"}}<img class="photo-blur" src="data:image/jpeg;base64,{{.PhotoBase64}}">{{end}}
-    <img class="photo" src="data:image/jpeg;base64,{{.PhotoBase64}}">
-  </div>
-  {{if or .ShowDate .ShowWeather .ShowCalendar}}
-  <div class="overlay">
-    <div class="overlay-left">
-      {{if .ShowDate}}
-      <div class="date">{{.DateStr}}</div>
-      {{end}}
-      {{if and .ShowCalendar .NextEvent}}
-      <div class="event-inline">
-        {{formatEventTime .NextEvent}} &mdash; {{.NextEvent.Summary}}
-      </div>
-      {{end}}
-      {{if and .ShowCalendar (gt (len .Events) 1)}}
-        {{range $i, $ev := .Events}}
-          {{if and (gt $i 0) (le $i 2)}}
-          <div class="event-inline">
-            {{formatEventTime $ev}} &mdash; {{$ev.Summary}}
-          </div>
-          {{end}}
-        {{end}}
-      {{end}}
-    </div>
-    {{if and .ShowWeather .Weather}}
-    <div class="overlay-right">
-      <span class="material-symbols-outlined weather-icon-small">{{.Weather.IconName}}</span>
-      <div class="weather-details">{{printf "%.1f" .Weather.Temperature}}&deg;C &nbsp; {{.Weather.Humidity}}%</div>
-    </div>
+    {{range .}}{{.}}{{end}}
     {{end}}
   </div>
-  {{end}}
 </div>
 
 {{else if eq .Layout "side_panel"}}
@@ -853,60 +1391,54 @@ const layoutTemplate = `<!DOCTYPE html>
     <img class="photo" src="data:image/jpeg;base64,{{.PhotoBase64}}">
   </div>
   <div class="info-panel">
-    {{if or .ShowDate (and .ShowWeather .Weather)}}
+    {{if or .Widgets.primary .Widgets.secondary}}
     <div class="info-header">
-      {{if .ShowDate}}
-      <div class="date">{{.DateStr}}</div>
-      {{end}}
-      {{if and .ShowWeather .Weather}}
-      <div class="weather-block">
-        <span class="material-symbols-outlined weather-icon">{{.Weather.IconName}}</span>
-        <div>
-          <div class="weather-temp">{{printf "%.1f" .Weather.Temperature}}&deg;C</div>
-          <div class="weather-details">{{.Weather.Description}} &middot; {{.Weather.Humidity}}%</div>
-        </div>
-      </div>
-      {{end}}
+      {{with .Widgets.primary}}<div>{{range .}}{{.}}{{end}}</div>{{end}}
+      {{with .Widgets.secondary}}<div>{{range .}}{{.}}{{end}}</div>{{end}}
     </div>
     {{end}}
 
-    {{if and .ShowCalendar (gt (len .Events) 0)}}
+    {{with .Widgets.detail}}
     <hr class="divider">
-    <ul class="events-list">
-      {{range .Events}}
-      <li class="event-item">
-        <span class="event-time">{{formatEventTime .}}</span>
-        <span class="event-title">{{.Summary}}</span>
-      </li>
-      {{end}}
-    </ul>
+    {{range .}}{{.}}{{end}}
+    {{end}}
+  </div>
+</div>
+
+{{else if eq .Layout "dashboard"}}
+<!-- LAYOUT 4: Dashboard -->
+<div class="layout-dashboard {{if .IsPortrait}}portrait{{else}}landscape{{end}}">
+  {{if or .Widgets.primary .Widgets.secondary}}
+  <div class="info-header">
+    {{with .Widgets.primary}}<div>{{range .}}{{.}}{{end}}</div>{{end}}
+    {{with .Widgets.secondary}}<div>{{range .}}{{.}}{{end}}</div>{{end}}
+  </div>
+  <hr class="divider">
+  {{end}}
+  <div class="dashboard-body">
+    {{range .Widgets.detail}}<div class="dashboard-cell">{{.}}</div>{{end}}
+    {{if .PhotoBase64}}
+    <div class="dashboard-tile"><img src="data:image/jpeg;base64,{{.PhotoBase64}}"></div>
     {{end}}
   </div>
 </div>
 
 {{else}}
-<!-- Default: same as photo_overlay -->
+<!-- LAYOUT 2 and default: Full Photo + Bottom Overlay -->
 <div class="layout-photo_overlay">
   <div class="photo-area">
     {{if eq .DisplayMode "contain"}}<img class="photo-blur" src="data:image/jpeg;base64,{{.PhotoBase64}}">{{end}}
     <img class="photo" src="data:image/jpeg;base64,{{.PhotoBase64}}">
   </div>
-  {{if or .ShowDate .ShowWeather .ShowCalendar}}
+  {{if .Widgets}}
   <div class="overlay">
     <div class="overlay-left">
-      {{if .ShowDate}}
-      <div class="date">{{.DateStr}}</div>
-      {{end}}
-      {{if and .ShowCalendar .NextEvent}}
-      <div class="event-inline">
-        {{formatEventTime .NextEvent}} &mdash; {{.NextEvent.Summary}}
-      </div>
-      {{end}}
+      {{range .Widgets.primary}}{{.}}{{end}}
+      {{range .Widgets.detail}}{{.}}{{end}}
     </div>
-    {{if and .ShowWeather .Weather}}
+    {{with .Widgets.secondary}}
     <div class="overlay-right">
-      <span class="material-symbols-outlined weather-icon-small">{{.Weather.IconName}}</span>
-      <div class="weather-details">{{printf "%.1f" .Weather.Temperature}}&deg;C &nbsp; {{.Weather.Humidity}}%</div>
+      {{range .}}{{.}}{{end}}
     </div>
     {{end}}
   </div>
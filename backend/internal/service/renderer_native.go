@@ -0,0 +1,441 @@
+package service
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"sync"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// nativeRenderer draws the built-in layouts in Go with the bundled Go fonts,
+// for hosts without Chrome. It follows the proportions and text sizes of the
+// HTML layouts closely enough for e-paper; widgets are drawn through their
+// TextWidget lines, so the weather is named rather than shown as an icon.
+// User-defined HTML layouts need Chrome.
+type nativeRenderer struct {
+	regular *opentype.Font
+	bold    *opentype.Font
+
+	mu    sync.Mutex // font faces are not safe for concurrent use
+	faces map[nativeFaceKey]font.Face
+}
+
+type nativeFaceKey struct {
+	bold bool
+	size float64
+}
+
+// nativeSizes are the text sizes and spacing of one area of a layout, in
+// pixels, as set by the layout CSS.
+type nativeSizes struct {
+	heading, body, secondary float64
+	padding, gap             float64
+}
+
+func newNativeRenderer() (*nativeRenderer, error) {
+	regular, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font: %w", err)
+	}
+	bold, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font: %w", err)
+	}
+	return &nativeRenderer{regular: regular, bold: bold, faces: make(map[nativeFaceKey]font.Face)}, nil
+}
+
+// Render draws the layout of opts. Must not be called with a Template.
+func (n *nativeRenderer) Render(opts RenderOptions) (image.Image, error) {
+	if opts.Width <= 0 || opts.Height <= 0 {
+		return nil, fmt.Errorf("invalid size %dx%d", opts.Width, opts.Height)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	dst := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	lines := widgetLines(opts)
+	baseUnit := calcBaseUnit(opts.Width, opts.Height)
+	if opts.Layout == model.LayoutDashboard {
+		n.drawDashboard(dst, opts, lines, nativeSizes{
+			heading:   mul(baseUnit, 5.6),
+			body:      mul(baseUnit, 3.6),
+			secondary: mul(baseUnit, 3.0),
+			padding:   mul(baseUnit, 3.6),
+			gap:       mul(baseUnit, 2.4),
+		})
+		return dst, nil
+	}
+	draw.Draw(dst, dst.Bounds(), image.Black, image.Point{}, draw.Src)
+
+	photoArea, panel := nativeAreas(opts.Layout, opts.Width, opts.Height)
+	if opts.Photo != nil {
+		drawNativePhoto(dst, photoArea, opts.Photo, opts.DisplayMode)
+	}
+
+	if panel.Empty() {
+		n.drawOverlay(dst, lines, nativeSizes{
+			heading:   mul(baseUnit, 6.8),
+			body:      mul(baseUnit, 4.7),
+			secondary: mul(baseUnit, 4.0),
+			padding:   mul(baseUnit, 3.6),
+			gap:       mul(baseUnit, 2.6),
+		})
+		return dst, nil
+	}
+
+	sizes := nativeSizes{
+		heading:   mul(baseUnit, 4.4),
+		body:      mul(baseUnit, 3.1),
+		secondary: mul(baseUnit, 2.6),
+		padding:   mul(baseUnit, 3.1),
+		gap:       mul(baseUnit, 2.1),
+	}
+	if opts.Width*opts.Height < 500000 {
+		sizes = nativeSizes{
+			heading:   mul(baseUnit, 4.5),
+			body:      mul(baseUnit, 3.5),
+			secondary: mul(baseUnit, 3.0),
+			padding:   mul(baseUnit, 2.4),
+			gap:       mul(baseUnit, 1.6),
+		}
+	}
+	draw.Draw(dst, panel, image.White, image.Point{}, draw.Src)
+	n.drawPanel(dst, panel, lines, sizes, opts.Layout == model.LayoutSidePanel && opts.Width >= opts.Height)
+	return dst, nil
+}
+
+// nativeAreas splits the frame into the photo and the info panel, which is
+// empty for the overlay layout.
+func nativeAreas(layout string, w, h int) (photo, panel image.Rectangle) {
+	frame := image.Rect(0, 0, w, h)
+	portrait := h > w
+	var split int
+	switch layout {
+	case model.LayoutPhotoInfo:
+		// The panel takes at most a quarter of the width, or a fifth of
+		// the height in portrait
+		if portrait {
+			split = h - h/5
+		} else {
+			split = w - w/4
+		}
+	case model.LayoutSidePanel:
+		if portrait {
+			split = h * 4 / 5
+		} else {
+			split = int(float64(w) * calcPhotoRatio(layout, w, h))
+		}
+	default:
+		return frame, image.Rectangle{}
+	}
+	if portrait {
+		return image.Rect(0, 0, w, split), image.Rect(0, split, w, h)
+	}
+	return image.Rect(0, 0, split, h), image.Rect(split, 0, w, h)
+}
+
+// drawNativePhoto fills r with the photo like object-fit does: cropped
+// around its focus for cover, or whole over a blurred, dimmed copy of
+// itself for contain.
+func drawNativePhoto(dst *image.RGBA, r image.Rectangle, photo image.Image, mode string) {
+	if r.Empty() {
+		return
+	}
+	if mode != "contain" {
+		imageops.DrawCover(dst, r, photo)
+		return
+	}
+
+	b := photo.Bounds()
+	if b.Empty() {
+		return
+	}
+	// Upscaling a thumbnail bilinearly blurs it
+	thumbW := 24
+	thumbH := max(1, thumbW*b.Dy()/b.Dx())
+	imageops.DrawCover(dst, r, imageops.Resize(photo, b, thumbW, thumbH))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := dst.Pix[dst.PixOffset(r.Min.X, y):dst.PixOffset(r.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			row[i] = uint8(float64(row[i]) * 0.9)
+			row[i+1] = uint8(float64(row[i+1]) * 0.9)
+			row[i+2] = uint8(float64(row[i+2]) * 0.9)
+		}
+	}
+
+	scale := math.Min(float64(r.Dx())/float64(b.Dx()), float64(r.Dy())/float64(b.Dy()))
+	fw := max(1, int(math.Round(float64(b.Dx())*scale)))
+	fh := max(1, int(math.Round(float64(b.Dy())*scale)))
+	at := image.Pt(r.Min.X+(r.Dx()-fw)/2, r.Min.Y+(r.Dy()-fh)/2)
+	draw.Draw(dst, image.Rectangle{Min: at, Max: at.Add(image.Pt(fw, fh))}, imageops.Resize(photo, b, fw, fh), image.Point{}, draw.Src)
+}
+
+// drawOverlay draws the widgets in white at the bottom of the photo over a
+// darkening gradient: primary and detail ones on the left, secondary ones
+// right-aligned on the right.
+func (n *nativeRenderer) drawOverlay(dst *image.RGBA, lines map[string][][]WidgetLine, sizes nativeSizes) {
+	left := n.column(append(lines[PlacementPrimary], lines[PlacementDetail]...), sizes, sizes.gap*0.5, 0)
+	right := n.column(lines[PlacementSecondary], sizes, sizes.gap*0.5, 0)
+	if len(left.lines) == 0 && len(right.lines) == 0 {
+		return
+	}
+
+	w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
+	pad := int(sizes.padding)
+	top := h - pad - max(left.height, right.height) - pad*4
+	drawGradient(dst, max(0, top), h)
+
+	rightW := min(right.width, w/2)
+	leftW := w - 2*pad
+	if len(right.lines) > 0 {
+		leftW -= rightW + pad
+	}
+	left.draw(dst, pad, h-pad-left.height, leftW, false, color.White)
+	right.draw(dst, w-pad, h-pad-right.height, rightW, true, color.White)
+}
+
+// drawGradient darkens the rows from top to bottom like the overlay's CSS
+// gradient: clear, then 35%, 43% and 55% black.
+func drawGradient(dst *image.RGBA, top, bottom int) {
+	stops := []struct{ at, alpha float64 }{{0, 0}, {0.3, 0.35}, {0.6, 0.43}, {1, 0.55}}
+	b := dst.Bounds()
+	for y := top; y < bottom; y++ {
+		t := (float64(y-top) + 0.5) / float64(bottom-top)
+		alpha := stops[len(stops)-1].alpha
+		for i := 1; i < len(stops); i++ {
+			if t <= stops[i].at {
+				f := (t - stops[i-1].at) / (stops[i].at - stops[i-1].at)
+				alpha = stops[i-1].alpha + f*(stops[i].alpha-stops[i-1].alpha)
+				break
+			}
+		}
+		keep := 1 - alpha
+		row := dst.Pix[dst.PixOffset(b.Min.X, y):dst.PixOffset(b.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			row[i] = uint8(float64(row[i]) * keep)
+			row[i+1] = uint8(float64(row[i+1]) * keep)
+			row[i+2] = uint8(float64(row[i+2]) * keep)
+		}
+	}
+}
+
+// drawPanel draws the widgets in black on the info panel, vertically
+// centered: a header with the primary widgets on the left and the secondary
+// ones on the right, stacked when they don't fit side by side or the panel
+// is a narrow column, then a divider and the detail widgets.
+func (n *nativeRenderer) drawPanel(dst *image.RGBA, panel image.Rectangle, lines map[string][][]WidgetLine, sizes nativeSizes, column bool) {
+	pad := int(sizes.padding)
+	if column {
+		pad = int(sizes.padding * 1.2)
+	}
+	inner := panel.Inset(pad)
+	if inner.Empty() {
+		return
+	}
+	gap := int(sizes.gap)
+
+	primary := n.column(lines[PlacementPrimary], sizes, sizes.gap*0.5, 0)
+	secondary := n.column(lines[PlacementSecondary], sizes, sizes.gap*0.5, 0)
+	detail := n.column(lines[PlacementDetail], sizes, sizes.gap*0.8, sizes.gap*0.8)
+	stacked := column || primary.width+gap+secondary.width > inner.Dx()
+
+	headerH := max(primary.height, secondary.height)
+	if stacked {
+		headerH = primary.height + secondary.height
+		if len(primary.lines) > 0 && len(secondary.lines) > 0 {
+			headerH += int(sizes.gap * 0.5)
+		}
+	}
+	height := headerH
+	dividerAbove, dividerBelow := gap, gap
+	if column {
+		dividerAbove = int(sizes.gap * 1.2)
+	}
+	if len(detail.lines) > 0 {
+		height += dividerAbove + 1 + dividerBelow + detail.height
+	}
+
+	y := inner.Min.Y + max(0, (inner.Dy()-height)/2)
+	clip := dst.SubImage(inner).(*image.RGBA)
+	if stacked {
+		primary.draw(clip, inner.Min.X, y, inner.Dx(), false, color.Black)
+		secondaryY := y + primary.height
+		if len(primary.lines) > 0 {
+			secondaryY += int(sizes.gap * 0.5)
+		}
+		secondary.draw(clip, inner.Min.X, secondaryY, inner.Dx(), false, color.Black)
+	} else {
+		primary.draw(clip, inner.Min.X, y+(headerH-primary.height)/2, inner.Dx()-secondary.width-gap, false, color.Black)
+		secondary.draw(clip, inner.Max.X, y+(headerH-secondary.height)/2, secondary.width, true, color.Black)
+	}
+	if len(detail.lines) == 0 {
+		return
+	}
+	y += headerH + dividerAbove
+	draw.Draw(clip, image.Rect(inner.Min.X, y, inner.Max.X, y+1), image.Black, image.Point{}, draw.Src)
+	detail.draw(clip, inner.Min.X, y+1+dividerBelow, inner.Dx(), false, color.Black)
+}
+
+// drawDashboard draws the dashboard in black on white: a header like the
+// panels', a divider, then a column for each detail widget with the photo
+// tile beside them, or rows of them in portrait.
+func (n *nativeRenderer) drawDashboard(dst *image.RGBA, opts RenderOptions, lines map[string][][]WidgetLine, sizes nativeSizes) {
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	inner := dst.Bounds().Inset(int(sizes.padding))
+	gap := int(sizes.gap)
+	portrait := opts.Height > opts.Width
+
+	primary := n.column(lines[PlacementPrimary], sizes, sizes.gap*0.5, 0)
+	secondary := n.column(lines[PlacementSecondary], sizes, sizes.gap*0.5, 0)
+	y := inner.Min.Y
+	if len(primary.lines) > 0 || len(secondary.lines) > 0 {
+		headerH := max(primary.height, secondary.height)
+		primary.draw(dst, inner.Min.X, y+(headerH-primary.height)/2, inner.Dx()-secondary.width-gap, false, color.Black)
+		secondary.draw(dst, inner.Max.X, y+(headerH-secondary.height)/2, secondary.width, true, color.Black)
+		y += headerH + gap
+		draw.Draw(dst, image.Rect(inner.Min.X, y, inner.Max.X, y+1), image.Black, image.Point{}, draw.Src)
+		y += 1 + gap
+	}
+	body := image.Rect(inner.Min.X, y, inner.Max.X, inner.Max.Y)
+
+	if opts.Photo != nil {
+		ratio := calcPhotoRatio(model.LayoutDashboard, opts.Width, opts.Height)
+		tile := body
+		if portrait {
+			tile.Min.Y = body.Max.Y - int(float64(body.Dy())*ratio)
+			body.Max.Y = tile.Min.Y - 2*gap
+		} else {
+			tile.Min.X = body.Max.X - int(float64(body.Dx())*ratio)
+			body.Max.X = tile.Min.X - 2*gap
+		}
+		drawNativePhoto(dst, tile, opts.Photo, "cover")
+	}
+
+	cells := lines[PlacementDetail]
+	for i, block := range cells {
+		cell := body
+		if portrait {
+			h := (body.Dy() - 2*gap*(len(cells)-1)) / len(cells)
+			cell.Min.Y = body.Min.Y + i*(h+2*gap)
+			cell.Max.Y = cell.Min.Y + h
+		} else {
+			w := (body.Dx() - 2*gap*(len(cells)-1)) / len(cells)
+			cell.Min.X = body.Min.X + i*(w+2*gap)
+			cell.Max.X = cell.Min.X + w
+		}
+		if cell.Empty() {
+			continue
+		}
+		col := n.column([][]WidgetLine{block}, sizes, 0, sizes.gap*0.4)
+		col.draw(dst.SubImage(cell).(*image.RGBA), cell.Min.X, cell.Min.Y, cell.Dx(), false, color.Black)
+	}
+}
+
+// nativeColumn is a stack of text lines measured for drawing.
+type nativeColumn struct {
+	lines  []nativeLine
+	width  int
+	height int
+}
+
+type nativeLine struct {
+	text   string
+	face   font.Face
+	top    int // relative to the column
+	height int
+}
+
+// column stacks the widgets' lines with blockGap between widgets and
+// lineGap between the lines of one widget.
+func (n *nativeRenderer) column(blocks [][]WidgetLine, sizes nativeSizes, blockGap, lineGap float64) nativeColumn {
+	var c nativeColumn
+	for i, block := range blocks {
+		if i > 0 {
+			c.height += int(blockGap)
+		}
+		for j, l := range block {
+			if j > 0 {
+				c.height += int(lineGap)
+			}
+			face := n.face(l.Style, sizes)
+			lineH := int(math.Ceil(float64(face.Metrics().Height.Ceil()) * 1.15))
+			c.lines = append(c.lines, nativeLine{text: l.Text, face: face, top: c.height, height: lineH})
+			c.width = max(c.width, font.MeasureString(face, l.Text).Ceil())
+			c.height += lineH
+		}
+	}
+	return c
+}
+
+// draw draws the column with its top at y, starting at x or, right-aligned,
+// ending there. Lines wider than maxW are cut short with an ellipsis.
+func (c nativeColumn) draw(dst *image.RGBA, x, y, maxW int, alignRight bool, col color.Color) {
+	for _, l := range c.lines {
+		text := truncateText(l.face, l.text, maxW)
+		lx := x
+		if alignRight {
+			lx -= font.MeasureString(l.face, text).Ceil()
+		}
+		m := l.face.Metrics()
+		baseline := y + l.top + (l.height-(m.Ascent+m.Descent).Ceil())/2 + m.Ascent.Ceil()
+		d := font.Drawer{Dst: dst, Src: image.NewUniform(col), Face: l.face, Dot: fixed.P(lx, baseline)}
+		d.DrawString(text)
+	}
+}
+
+// truncateText shortens text to fit maxW pixels, ending it with an ellipsis.
+func truncateText(face font.Face, text string, maxW int) string {
+	if maxW <= 0 {
+		return ""
+	}
+	limit := fixed.I(maxW)
+	if font.MeasureString(face, text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		if s := string(runes) + "…"; font.MeasureString(face, s) <= limit {
+			return s
+		}
+	}
+	return ""
+}
+
+// face returns the font face for a text style. Must be called with n.mu
+// held.
+func (n *nativeRenderer) face(style string, sizes nativeSizes) font.Face {
+	key := nativeFaceKey{bold: style == TextHeading, size: sizes.body}
+	switch style {
+	case TextHeading:
+		key.size = sizes.heading
+	case TextSecondary:
+		key.size = sizes.secondary
+	}
+	if f, ok := n.faces[key]; ok {
+		return f
+	}
+	src := n.regular
+	if key.bold {
+		src = n.bold
+	}
+	f, err := opentype.NewFace(src, &opentype.FaceOptions{Size: math.Max(key.size, 1), DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		log.Printf("Failed to load %.0fpx font: %v", key.size, err)
+		return basicfont.Face7x13
+	}
+	n.faces[key] = f
+	return f
+}
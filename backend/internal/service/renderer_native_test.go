@@ -0,0 +1,109 @@
+package service
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNativeRenderer_Layouts(t *testing.T) {
+	n, err := newNativeRenderer()
+	require.NoError(t, err)
+	widgets := newBuiltinWidgets(t)
+
+	for _, size := range [][2]int{{800, 480}, {480, 800}, {1600, 1200}, {1200, 1600}} {
+		for _, layout := range []string{model.LayoutPhotoInfo, model.LayoutPhotoOverlay, model.LayoutSidePanel} {
+			opts := widgets.SampleRenderOptions(size[0], size[1])
+			opts.Layout = layout
+			img, err := n.Render(opts)
+			require.NoError(t, err)
+			assert.Equal(t, size[0], img.Bounds().Dx())
+			assert.Equal(t, size[1], img.Bounds().Dy())
+
+			_, panel := nativeAreas(layout, size[0], size[1])
+			if layout == model.LayoutPhotoOverlay {
+				assert.True(t, panel.Empty())
+				continue
+			}
+			// The panel is white with black text on it
+			var dark int
+			for y := panel.Min.Y; y < panel.Max.Y; y++ {
+				for x := panel.Min.X; x < panel.Max.X; x++ {
+					if c := color.GrayModel.Convert(img.At(x, y)).(color.Gray); c.Y < 128 {
+						dark++
+					}
+				}
+			}
+			assert.Equal(t, color.RGBA{255, 255, 255, 255}, img.At(panel.Max.X-1, panel.Max.Y-1), "%s %v", layout, size)
+			assert.Greater(t, dark, 100, "%s %v", layout, size)
+		}
+	}
+}
+
+func TestNativeRenderer_Dashboard(t *testing.T) {
+	n, err := newNativeRenderer()
+	require.NoError(t, err)
+	widgets := newBuiltinWidgets(t)
+
+	for _, size := range [][2]int{{800, 480}, {1200, 1600}} {
+		// Without a photo the whole screen is the dashboard
+		opts := widgets.SampleRenderOptions(size[0], size[1])
+		opts.Layout = model.LayoutDashboard
+		opts.Photo = nil
+		img, err := n.Render(opts)
+		require.NoError(t, err)
+		assert.Equal(t, size[1], img.Bounds().Dy())
+		assert.Equal(t, color.RGBA{255, 255, 255, 255}, img.At(size[0]-1, size[1]-1), "%v", size)
+
+		var dark int
+		for y := 0; y < size[1]; y++ {
+			for x := 0; x < size[0]; x++ {
+				if c := color.GrayModel.Convert(img.At(x, y)).(color.Gray); c.Y < 128 {
+					dark++
+				}
+			}
+		}
+		assert.Greater(t, dark, 1000, "%v", size)
+	}
+}
+
+func TestRendererService_NativeFallback(t *testing.T) {
+	n, err := newNativeRenderer()
+	require.NoError(t, err)
+	s := &RendererService{native: n}
+
+	// Without Chrome every device renders natively, custom templates too
+	opts := newBuiltinWidgets(t).SampleRenderOptions(400, 240)
+	opts.Template = "<html>{{.DeviceName}}</html>"
+	assert.Equal(t, RendererNative, s.Engine(""))
+	img, err := s.Render(opts)
+	require.NoError(t, err)
+	assert.Equal(t, 400, img.Bounds().Dx())
+
+	s.chrome = true
+	assert.Equal(t, RendererChrome, s.Engine(""))
+	assert.Equal(t, RendererNative, s.Engine(RendererNative))
+	opts.Engine = RendererNative
+	native := s.Fingerprint(opts)
+	opts.Engine = RendererChrome
+	assert.NotEqual(t, native, s.Fingerprint(opts))
+}
+
+func TestRendererService_RenderFrameReportsFallback(t *testing.T) {
+	s, err := NewRendererService(1)
+	require.NoError(t, err)
+	if s.ChromeAvailable() {
+		t.Skip("Chrome is installed, nothing to fall back from")
+	}
+
+	// Chrome was there at startup but can't be launched now
+	s.chrome = true
+	img, engine, err := s.RenderFrame(newBuiltinWidgets(t).SampleRenderOptions(400, 240))
+	require.NoError(t, err)
+	assert.Equal(t, 400, img.Bounds().Dx())
+	assert.Equal(t, RendererNative, engine)
+	assert.Equal(t, RendererChrome, s.Engine(""))
+}
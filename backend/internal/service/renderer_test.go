@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRendererService_Queue(t *testing.T) {
+	s, err := NewRendererService(1)
+	require.NoError(t, err)
+	defer s.Close()
+
+	wait, err := s.acquireSlot()
+	require.NoError(t, err)
+	assert.Less(t, wait, time.Second)
+
+	// A second render queues until the first gives its slot back
+	acquired := make(chan time.Duration)
+	go func() {
+		wait, _ := s.acquireSlot()
+		acquired <- wait
+	}()
+	require.Eventually(t, func() bool { return s.Stats().Queued == 1 }, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	<-s.slots
+	assert.GreaterOrEqual(t, <-acquired, 20*time.Millisecond)
+	assert.Equal(t, 0, s.Stats().Queued)
+	<-s.slots
+
+	s.recordRender(0, 400*time.Millisecond, nil)
+	s.recordRender(0, 1200*time.Millisecond, nil)
+	s.recordRender(time.Second, 0, errors.New("timeout"))
+	stats := s.Stats()
+	assert.Equal(t, 1, stats.PoolSize)
+	assert.Equal(t, int64(3), stats.Renders)
+	assert.Equal(t, int64(1), stats.Failures)
+	assert.Equal(t, int64(1200), stats.LastRenderMs)
+	assert.Equal(t, int64(500), stats.AvgRenderMs)
+}
+
+func TestRendererService_BrowserRecovery(t *testing.T) {
+	s, err := NewRendererService(1)
+	require.NoError(t, err)
+	if !s.ChromeAvailable() {
+		t.Skip("Chrome is not installed")
+	}
+	defer s.Close()
+	opts := newBuiltinWidgets(t).SampleRenderOptions(400, 240)
+
+	_, engine, err := s.RenderFrame(opts)
+	require.NoError(t, err)
+	assert.Equal(t, RendererChrome, engine)
+
+	// Chrome dies between two renders: the second relaunches it and retries
+	s.mu.Lock()
+	l := s.launcher
+	s.mu.Unlock()
+	l.Kill()
+	img, engine, err := s.RenderFrame(opts)
+	require.NoError(t, err)
+	assert.Equal(t, RendererChrome, engine)
+	assert.Equal(t, 400, img.Bounds().Dx())
+	assert.Equal(t, int64(1), s.Stats().Restarts)
+
+	// A page that never settles gives up at the render deadline, and the
+	// browser keeps serving renders
+	defer func(timeout time.Duration) { renderTimeout = timeout }(renderTimeout)
+	renderTimeout = 2 * time.Second
+	hung := opts
+	hung.Template = "<script>while (true) {}</script>"
+	start := time.Now()
+	_, _, err = s.RenderFrame(hung)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	_, engine, err = s.RenderFrame(opts)
+	require.NoError(t, err)
+	assert.Equal(t, RendererChrome, engine)
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+const (
+	minutesPerDay  = 24 * 60
+	minutesPerWeek = 7 * minutesPerDay
+	allDays        = 1<<7 - 1
+)
+
+// ScheduleService manages per-device playlists and resolves which entry is
+// active at a given time.
+type ScheduleService struct {
+	db *gorm.DB
+}
+
+func NewScheduleService(db *gorm.DB) *ScheduleService {
+	return &ScheduleService{db: db}
+}
+
+// ListSchedules returns the device's entries, highest priority first.
+func (s *ScheduleService) ListSchedules(deviceID uint) ([]model.DeviceSchedule, error) {
+	var schedules []model.DeviceSchedule
+	if err := s.db.Where("device_id = ?", deviceID).
+		Order("priority desc, start_minute, id").
+		Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+func (s *ScheduleService) CreateSchedule(schedule *model.DeviceSchedule) error {
+	if err := s.validate(schedule); err != nil {
+		return err
+	}
+	return s.db.Create(schedule).Error
+}
+
+func (s *ScheduleService) UpdateSchedule(schedule *model.DeviceSchedule) error {
+	if err := s.validate(schedule); err != nil {
+		return err
+	}
+	return s.db.Save(schedule).Error
+}
+
+func (s *ScheduleService) DeleteSchedule(deviceID, id uint) error {
+	result := s.db.Where("device_id = ?", deviceID).Delete(&model.DeviceSchedule{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ActiveSchedule returns the entry that applies to the device at now, or nil
+// when no entry covers that time.
+func (s *ScheduleService) ActiveSchedule(device *model.Device, now time.Time) (*model.DeviceSchedule, error) {
+	var schedules []model.DeviceSchedule
+	if err := s.db.Where("device_id = ? AND enabled = ?", device.ID, true).Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return activeSchedule(schedules, now.In(DeviceLocation(device))), nil
+}
+
+// DeviceLocation returns the device's configured timezone, falling back to
+// the server's local time when unset or invalid.
+func DeviceLocation(device *model.Device) *time.Location {
+	if device.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(device.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// ValidateTimezone accepts empty (server local time) or an IANA zone name.
+func ValidateTimezone(tz string) error {
+	if tz == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return fmt.Errorf("invalid timezone: %s", tz)
+	}
+	return nil
+}
+
+func (s *ScheduleService) validate(schedule *model.DeviceSchedule) error {
+	if schedule.Days < 0 || schedule.Days > allDays {
+		return errors.New("days must be a weekday bitmask between 0 and 127")
+	}
+	if schedule.StartMinute < 0 || schedule.StartMinute >= minutesPerDay ||
+		schedule.EndMinute < 0 || schedule.EndMinute >= minutesPerDay {
+		return errors.New("start_minute and end_minute must be between 0 and 1439")
+	}
+	switch schedule.Source {
+	case model.SourceGooglePhotos, model.SourceTelegram, model.SourceURLProxy, model.SourceAIGeneration, model.SourceMix, model.SourceDashboard:
+		if schedule.AlbumID != "" {
+			return fmt.Errorf("album_id is not supported for source %s", schedule.Source)
+		}
+	case model.SourceSynologyPhotos, model.SourceImmich:
+	default:
+		return fmt.Errorf("invalid source: %s", schedule.Source)
+	}
+	switch schedule.Layout {
+	case "", model.LayoutPhotoInfo, model.LayoutPhotoOverlay, model.LayoutSidePanel, model.LayoutDashboard:
+	default:
+		return fmt.Errorf("invalid layout: %s", schedule.Layout)
+	}
+
+	if !schedule.Enabled {
+		return nil
+	}
+	var others []model.DeviceSchedule
+	if err := s.db.Where("device_id = ? AND priority = ? AND enabled = ? AND id != ?",
+		schedule.DeviceID, schedule.Priority, true, schedule.ID).
+		Find(&others).Error; err != nil {
+		return err
+	}
+	for _, other := range others {
+		if schedulesOverlap(*schedule, other) {
+			return fmt.Errorf("overlaps schedule %q with the same priority", other.Name)
+		}
+	}
+	return nil
+}
+
+// weekIntervals expands a schedule into half-open [start, end) ranges of
+// minutes since Sunday midnight. Ranges spanning midnight may run past the end
+// of the week; callers compare modulo minutesPerWeek.
+func weekIntervals(schedule model.DeviceSchedule) [][2]int {
+	days := schedule.Days
+	if days == 0 {
+		days = allDays
+	}
+	length := schedule.EndMinute - schedule.StartMinute
+	if length <= 0 {
+		length += minutesPerDay
+	}
+
+	var intervals [][2]int
+	for day := 0; day < 7; day++ {
+		if days&(1<<day) == 0 {
+			continue
+		}
+		start := day*minutesPerDay + schedule.StartMinute
+		intervals = append(intervals, [2]int{start, start + length})
+	}
+	return intervals
+}
+
+// covers reports whether the minute of the week falls inside the schedule.
+func covers(schedule model.DeviceSchedule, minuteOfWeek int) bool {
+	for _, iv := range weekIntervals(schedule) {
+		if minuteOfWeek >= iv[0] && minuteOfWeek < iv[1] {
+			return true
+		}
+		// Ranges wrapping from Saturday into Sunday
+		if minuteOfWeek+minutesPerWeek >= iv[0] && minuteOfWeek+minutesPerWeek < iv[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func schedulesOverlap(a, b model.DeviceSchedule) bool {
+	for _, x := range weekIntervals(a) {
+		for _, y := range weekIntervals(b) {
+			for _, shift := range []int{-minutesPerWeek, 0, minutesPerWeek} {
+				if x[0] < y[1]+shift && y[0]+shift < x[1] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// activeSchedule picks the highest priority entry covering now, which is
+// expected to already be in the device's timezone.
+func activeSchedule(schedules []model.DeviceSchedule, now time.Time) *model.DeviceSchedule {
+	minuteOfWeek := int(now.Weekday())*minutesPerDay + now.Hour()*60 + now.Minute()
+
+	var active *model.DeviceSchedule
+	for i := range schedules {
+		schedule := &schedules[i]
+		if !schedule.Enabled || !covers(*schedule, minuteOfWeek) {
+			continue
+		}
+		if active == nil || schedule.Priority > active.Priority ||
+			(schedule.Priority == active.Priority && schedule.ID < active.ID) {
+			active = schedule
+		}
+	}
+	return active
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+const weekdays = 0b0111110
+
+func at(weekday time.Weekday, hour, minute int) time.Time {
+	// 2024-01-07 is a Sunday
+	return time.Date(2024, 1, 7+int(weekday), hour, minute, 0, 0, time.UTC)
+}
+
+func TestActiveSchedule_Precedence(t *testing.T) {
+	schedules := []model.DeviceSchedule{
+		{ID: 1, Name: "default", Source: model.SourceImmich, Enabled: true},
+		{ID: 2, Name: "mornings", Days: weekdays, StartMinute: 6 * 60, EndMinute: 9 * 60, Source: model.SourceSynologyPhotos, Priority: 10, Enabled: true},
+		{ID: 3, Name: "disabled", Source: model.SourceAIGeneration, Priority: 20},
+	}
+
+	assert.Equal(t, uint(2), activeSchedule(schedules, at(time.Monday, 7, 30)).ID)
+	assert.Equal(t, uint(1), activeSchedule(schedules, at(time.Monday, 9, 0)).ID)
+	assert.Equal(t, uint(1), activeSchedule(schedules, at(time.Saturday, 7, 30)).ID)
+	assert.Nil(t, activeSchedule(schedules[1:], at(time.Sunday, 7, 30)))
+}
+
+func TestActiveSchedule_SpansMidnight(t *testing.T) {
+	saturdayNight := []model.DeviceSchedule{
+		{ID: 1, Days: 1 << time.Saturday, StartMinute: 22 * 60, EndMinute: 2 * 60, Enabled: true},
+	}
+
+	assert.NotNil(t, activeSchedule(saturdayNight, at(time.Saturday, 23, 0)))
+	assert.NotNil(t, activeSchedule(saturdayNight, at(time.Sunday, 1, 59)))
+	assert.Nil(t, activeSchedule(saturdayNight, at(time.Sunday, 2, 0)))
+	assert.Nil(t, activeSchedule(saturdayNight, at(time.Saturday, 1, 0)))
+}
+
+func TestSchedulesOverlap(t *testing.T) {
+	evenings := model.DeviceSchedule{Days: weekdays, StartMinute: 18 * 60, EndMinute: 23 * 60}
+	mornings := model.DeviceSchedule{Days: weekdays, StartMinute: 6 * 60, EndMinute: 9 * 60}
+	lateNight := model.DeviceSchedule{Days: 1 << time.Saturday, StartMinute: 23 * 60, EndMinute: 7 * 60}
+	sundayMorning := model.DeviceSchedule{Days: 1 << time.Sunday, StartMinute: 6 * 60, EndMinute: 8 * 60}
+
+	assert.False(t, schedulesOverlap(evenings, mornings))
+	assert.True(t, schedulesOverlap(evenings, model.DeviceSchedule{}))
+	assert.True(t, schedulesOverlap(lateNight, sundayMorning))
+	assert.False(t, schedulesOverlap(lateNight, mornings))
+}
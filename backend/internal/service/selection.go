@@ -0,0 +1,123 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+)
+
+// favoriteWeight is how many times a favorite appears in a shuffle cycle
+// under the favorites strategy, relative to a regular photo.
+const favoriteWeight = 4
+
+// unratedWeight treats unrated photos as average (three stars) under the
+// rating strategy so they are not starved by a few rated ones.
+const unratedWeight = 3
+
+// memoriesMinMatches is how many photos the memories strategy looks for
+// before it stops widening its window around today's date.
+const memoriesMinMatches = 5
+
+// DefaultMemoriesWindowDays is used when a device has no window configured.
+const DefaultMemoriesWindowDays = 7
+
+// ValidateSelectionStrategy returns an error for unknown strategies. An empty
+// strategy is accepted and behaves as uniform.
+func ValidateSelectionStrategy(strategy string) error {
+	switch strategy {
+	case "", model.SelectionUniform, model.SelectionFavorites, model.SelectionRating, model.SelectionMemories:
+		return nil
+	default:
+		return fmt.Errorf("unknown selection strategy: %s", strategy)
+	}
+}
+
+// SelectionWeight returns how many times img should appear per shuffle cycle
+// under the given strategy. The result is always at least 1 so no eligible
+// photo is ever excluded from rotation.
+func SelectionWeight(strategy string, img model.Image) int {
+	switch strategy {
+	case model.SelectionFavorites:
+		if img.Favorite {
+			return favoriteWeight
+		}
+		return 1
+	case model.SelectionRating:
+		if img.Favorite {
+			return 5
+		}
+		if img.Rating <= 0 {
+			return unratedWeight
+		}
+		return min(img.Rating, 5)
+	default:
+		return 1
+	}
+}
+
+// WeightedPool expands images into the eligible list passed to
+// ShuffleService.Draw, repeating each ID according to its selection weight.
+func WeightedPool(strategy string, images []model.Image) []uint {
+	pool := make([]uint, 0, len(images))
+	for _, img := range images {
+		for i := SelectionWeight(strategy, img); i > 0; i-- {
+			pool = append(pool, img.ID)
+		}
+	}
+	return pool
+}
+
+// MemoryCandidates returns the photos taken on today's month and day in
+// earlier years. When fewer than memoriesMinMatches match, the window widens
+// one day at a time on either side, up to maxWindowDays. Photos without a
+// capture time never match.
+func MemoryCandidates(images []model.Image, today time.Time, maxWindowDays int) []model.Image {
+	if maxWindowDays <= 0 {
+		maxWindowDays = DefaultMemoriesWindowDays
+	}
+
+	distances := make([]int, len(images))
+	for i, img := range images {
+		distances[i] = -1
+		if img.TakenAt != nil && img.TakenAt.Year() < today.Year() {
+			distances[i] = dayOfYearDistance(*img.TakenAt, today)
+		}
+	}
+
+	window := 0
+	for ; window < maxWindowDays; window++ {
+		count := 0
+		for _, d := range distances {
+			if d >= 0 && d <= window {
+				count++
+			}
+		}
+		if count >= memoriesMinMatches {
+			break
+		}
+	}
+
+	var matches []model.Image
+	for i, img := range images {
+		if distances[i] >= 0 && distances[i] <= window {
+			matches = append(matches, img)
+		}
+	}
+	return matches
+}
+
+// dayOfYearDistance returns how many days apart the month and day of taken
+// and today are, ignoring the year and wrapping around New Year.
+func dayOfYearDistance(taken, today time.Time) int {
+	year := today.Year()
+	t := time.Date(year, taken.Month(), taken.Day(), 0, 0, 0, 0, time.UTC)
+	d := time.Date(year, today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+
+	diff := int(t.Sub(d).Hours() / 24)
+	if diff < 0 {
+		diff = -diff
+	}
+	daysInYear := time.Date(year, 12, 31, 0, 0, 0, 0, time.UTC).YearDay()
+	return min(diff, daysInYear-diff)
+}
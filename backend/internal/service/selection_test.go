@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func takenOn(id uint, year int, month time.Month, day int) model.Image {
+	t := time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+	return model.Image{ID: id, TakenAt: &t}
+}
+
+func memoryIDs(images []model.Image) []uint {
+	var ids []uint
+	for _, img := range images {
+		ids = append(ids, img.ID)
+	}
+	return ids
+}
+
+func TestMemoryCandidates(t *testing.T) {
+	today := time.Date(2025, time.January, 2, 9, 0, 0, 0, time.UTC)
+	images := []model.Image{
+		takenOn(1, 2020, time.January, 2),
+		takenOn(2, 2025, time.January, 2), // this year, never a memory
+		takenOn(3, 2019, time.December, 30),
+		takenOn(4, 2018, time.January, 20),
+		{ID: 5}, // no capture time
+	}
+
+	// Too few exact matches: widen across New Year up to the window
+	assert.ElementsMatch(t, []uint{1, 3}, memoryIDs(MemoryCandidates(images, today, 7)))
+	assert.ElementsMatch(t, []uint{1}, memoryIDs(MemoryCandidates(images, today, 1)))
+	assert.Empty(t, MemoryCandidates(images[1:], today, 1))
+}
+
+func TestMemoryCandidates_StopsWideningWithEnoughMatches(t *testing.T) {
+	today := time.Date(2025, time.June, 15, 9, 0, 0, 0, time.UTC)
+	var images []model.Image
+	for i := uint(1); i <= memoriesMinMatches; i++ {
+		images = append(images, takenOn(i, 2010+int(i), time.June, 15))
+	}
+	images = append(images, takenOn(100, 2020, time.June, 16))
+
+	assert.NotContains(t, memoryIDs(MemoryCandidates(images, today, 7)), uint(100))
+}
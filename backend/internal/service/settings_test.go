@@ -1,10 +1,12 @@
 package service
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -15,6 +17,15 @@ func setupTestDB() *gorm.DB {
 	return db
 }
 
+// setupModelTestDB opens an in-memory database of the test's own, migrated
+// for models.
+func setupModelTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(models...))
+	return db
+}
+
 func TestSettingsService_SetGet(t *testing.T) {
 	db := setupTestDB()
 	svc := NewSettingsService(db)
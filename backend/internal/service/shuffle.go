@@ -0,0 +1,299 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// ShuffleService maintains a persisted shuffle bag per device and pool. Every
+// eligible photo is drawn exactly once per cycle before any photo repeats, and
+// the bag lives in the database so a cycle survives server restarts.
+type ShuffleService struct {
+	db     *gorm.DB
+	mu     *sync.Mutex
+	dryRun bool
+	drawn  []ShuffleDraw // Draws of a dry-run view, for Commit
+}
+
+// ShuffleDraw is a photo drawn from a device's bag by a dry run.
+type ShuffleDraw struct {
+	DeviceID uint
+	Pool     string
+	ImageID  uint
+	Eligible []uint // The pool the photo was drawn from
+}
+
+// errDryRun rolls back the transaction of a dry-run draw.
+var errDryRun = errors.New("shuffle: dry run")
+
+func NewShuffleService(db *gorm.DB) *ShuffleService {
+	return &ShuffleService{db: db, mu: &sync.Mutex{}}
+}
+
+// DryRun returns a view of the service whose draws pick the same photo a real
+// draw would, for previews and for frames that may never be shown. Dry runs
+// leave the stored bags untouched; as new photos and new cycles are shuffled
+// from the bag's own state, the next real draw shuffles them the same way.
+// The view remembers its draws so they can be committed once shown.
+func (s *ShuffleService) DryRun() *ShuffleService {
+	return &ShuffleService{db: s.db, mu: s.mu, dryRun: true}
+}
+
+// Drawn returns the photos drawn so far through a dry-run view.
+func (s *ShuffleService) Drawn() []ShuffleDraw {
+	return s.drawn
+}
+
+// Commit draws the photos drawn by a dry run for real, once the frame they
+// were drawn for has actually been shown. Photos that left the bag since are
+// skipped.
+func (s *ShuffleService) Commit(draws []ShuffleDraw) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	live := &ShuffleService{db: s.db, mu: s.mu}
+	for _, d := range draws {
+		if len(d.Eligible) == 0 {
+			continue
+		}
+		accept := func(id uint) bool { return id == d.ImageID }
+		if _, err := live.draw(d.DeviceID, d.Pool, d.Eligible, accept); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Draw returns the next photo of the device's bag for pool and marks it played.
+//
+// The bag is first reconciled with eligible: photos that are new to the pool
+// are inserted at a random position of the current cycle and photos that are
+// no longer eligible are dropped. A photo listed n times in eligible appears n
+// times per cycle, which is how selection weights are applied. Once every entry has been played a new cycle
+// is shuffled. accept optionally restricts which photos may be drawn (e.g. a
+// specific orientation for collages); when no unplayed entry is accepted the
+// least recently played accepted entry is reused instead of failing.
+func (s *ShuffleService) Draw(deviceID uint, pool string, eligible []uint, accept func(imageID uint) bool) (uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draw(deviceID, pool, eligible, accept)
+}
+
+func (s *ShuffleService) draw(deviceID uint, pool string, eligible []uint, accept func(imageID uint) bool) (uint, error) {
+	if len(eligible) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	var drawn uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		entries, err := s.reconcile(tx, deviceID, pool, eligible)
+		if err != nil {
+			return err
+		}
+
+		if allPlayed(entries) {
+			if entries, err = s.newCycle(tx, deviceID, pool, entries); err != nil {
+				return err
+			}
+		}
+
+		entry := pickEntry(entries, accept)
+		if entry == nil {
+			return gorm.ErrRecordNotFound
+		}
+
+		drawn = entry.ImageID
+		if s.dryRun {
+			return errDryRun
+		}
+		return markPlayed(tx, entry)
+	})
+	if errors.Is(err, errDryRun) {
+		s.drawn = append(s.drawn, ShuffleDraw{DeviceID: deviceID, Pool: pool, ImageID: drawn, Eligible: eligible})
+		return drawn, nil
+	}
+	return drawn, err
+}
+
+func markPlayed(tx *gorm.DB, entry *model.ShuffleEntry) error {
+	return tx.Model(&model.ShuffleEntry{}).Where("id = ?", entry.ID).
+		Updates(map[string]interface{}{"played": true, "played_at": time.Now()}).Error
+}
+
+// reconcile syncs the stored bag with the currently eligible photos and
+// returns its entries ordered by sort key.
+func (s *ShuffleService) reconcile(tx *gorm.DB, deviceID uint, pool string, eligible []uint) ([]model.ShuffleEntry, error) {
+	var stored []model.ShuffleEntry
+	if err := tx.Where("device_id = ? AND pool = ?", deviceID, pool).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	want := make(map[uint]int, len(eligible))
+	for _, id := range eligible {
+		want[id]++
+	}
+
+	entries := make([]model.ShuffleEntry, 0, len(eligible))
+	have := make(map[uint]int, len(stored))
+	var stale []uint
+	for _, e := range stored {
+		if have[e.ImageID] >= want[e.ImageID] {
+			stale = append(stale, e.ID)
+			continue
+		}
+		have[e.ImageID]++
+		entries = append(entries, e)
+	}
+	if len(stale) > 0 {
+		if err := tx.Where("id IN ?", stale).Delete(&model.ShuffleEntry{}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	rng := bagRand(deviceID, pool, stored)
+	var added []model.ShuffleEntry
+	for _, id := range eligible {
+		if have[id] >= want[id] {
+			continue
+		}
+		have[id]++
+		added = append(added, model.ShuffleEntry{
+			DeviceID: deviceID,
+			Pool:     pool,
+			ImageID:  id,
+			SortKey:  rng.Float64(),
+		})
+	}
+	if len(added) > 0 {
+		if err := tx.CreateInBatches(&added, 500).Error; err != nil {
+			return nil, err
+		}
+		entries = append(entries, added...)
+	}
+
+	sortEntries(entries)
+	return entries, nil
+}
+
+// newCycle reshuffles every photo of the bag into a fresh, unplayed cycle. The
+// photo that ended the previous cycle is kept away from the front so the
+// cycle boundary never shows the same photo twice in a row.
+func (s *ShuffleService) newCycle(tx *gorm.DB, deviceID uint, pool string, entries []model.ShuffleEntry) ([]model.ShuffleEntry, error) {
+	lastPlayed := lastPlayedImage(entries)
+	rng := bagRand(deviceID, pool, entries)
+
+	if err := tx.Where("device_id = ? AND pool = ?", deviceID, pool).Delete(&model.ShuffleEntry{}).Error; err != nil {
+		return nil, err
+	}
+
+	fresh := make([]model.ShuffleEntry, 0, len(entries))
+	for _, e := range entries {
+		fresh = append(fresh, model.ShuffleEntry{
+			DeviceID: deviceID,
+			Pool:     pool,
+			ImageID:  e.ImageID,
+			SortKey:  rng.Float64(),
+		})
+	}
+	sortEntries(fresh)
+	if fresh[0].ImageID == lastPlayed {
+		var others []int
+		for i := range fresh {
+			if fresh[i].ImageID != lastPlayed {
+				others = append(others, i)
+			}
+		}
+		if len(others) > 0 {
+			swap := others[rng.Intn(len(others))]
+			fresh[0].SortKey, fresh[swap].SortKey = fresh[swap].SortKey, fresh[0].SortKey
+			sortEntries(fresh)
+		}
+	}
+
+	if err := tx.CreateInBatches(&fresh, 500).Error; err != nil {
+		return nil, err
+	}
+	return fresh, nil
+}
+
+// bagRand returns the random source to shuffle a change of the bag with,
+// seeded from its current entries: a dry run and the draw after it see the
+// same bag and shuffle alike, while every cycle ends differently.
+func bagRand(deviceID uint, pool string, entries []model.ShuffleEntry) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%s", deviceID, pool)
+	for _, e := range entries {
+		var playedAt int64
+		if e.PlayedAt != nil {
+			playedAt = e.PlayedAt.UnixNano()
+		}
+		fmt.Fprintf(h, "/%d:%t:%d", e.ImageID, e.Played, playedAt)
+	}
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// pickEntry returns the first unplayed accepted entry, falling back to the
+// least recently played accepted one. Weighted photos have several entries per
+// cycle, so an entry repeating the photo shown last is skipped when possible.
+func pickEntry(entries []model.ShuffleEntry, accept func(uint) bool) *model.ShuffleEntry {
+	lastPlayed := lastPlayedImage(entries)
+	var repeat, fallback *model.ShuffleEntry
+	for i := range entries {
+		e := &entries[i]
+		if accept != nil && !accept(e.ImageID) {
+			continue
+		}
+		if !e.Played {
+			if e.ImageID != lastPlayed {
+				return e
+			}
+			if repeat == nil {
+				repeat = e
+			}
+			continue
+		}
+		if fallback == nil || (e.PlayedAt != nil && fallback.PlayedAt != nil && e.PlayedAt.Before(*fallback.PlayedAt)) {
+			fallback = e
+		}
+	}
+	if repeat != nil {
+		return repeat
+	}
+	return fallback
+}
+
+// lastPlayedImage returns the image of the most recently played entry, or 0.
+func lastPlayedImage(entries []model.ShuffleEntry) uint {
+	var last uint
+	var lastAt time.Time
+	for _, e := range entries {
+		if e.PlayedAt != nil && e.PlayedAt.After(lastAt) {
+			last = e.ImageID
+			lastAt = *e.PlayedAt
+		}
+	}
+	return last
+}
+
+func allPlayed(entries []model.ShuffleEntry) bool {
+	for _, e := range entries {
+		if !e.Played {
+			return false
+		}
+	}
+	return true
+}
+
+func sortEntries(entries []model.ShuffleEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].SortKey < entries[j].SortKey
+	})
+}
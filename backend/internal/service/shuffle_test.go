@@ -0,0 +1,177 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func drawCycle(t *testing.T, svc *ShuffleService, eligible []uint, n int) []uint {
+	var drawn []uint
+	for i := 0; i < n; i++ {
+		id, err := svc.Draw(1, "pool", eligible, nil)
+		require.NoError(t, err)
+		drawn = append(drawn, id)
+	}
+	return drawn
+}
+
+func TestShuffleService_FullCycleWithoutRepeats(t *testing.T) {
+	svc := NewShuffleService(setupModelTestDB(t, &model.ShuffleEntry{}))
+	eligible := []uint{1, 2, 3, 4, 5, 6, 7, 8}
+
+	for cycle := 0; cycle < 3; cycle++ {
+		drawn := drawCycle(t, svc, eligible, len(eligible))
+		assert.ElementsMatch(t, eligible, drawn)
+	}
+}
+
+func TestShuffleService_NewPhotoJoinsCurrentCycle(t *testing.T) {
+	svc := NewShuffleService(setupModelTestDB(t, &model.ShuffleEntry{}))
+	eligible := []uint{1, 2, 3, 4}
+
+	first := drawCycle(t, svc, eligible, 2)
+	eligible = append(eligible, 5)
+	rest := drawCycle(t, svc, eligible, 3)
+
+	assert.ElementsMatch(t, eligible, append(first, rest...))
+}
+
+func TestShuffleService_RemovedPhotoIsNotDrawn(t *testing.T) {
+	svc := NewShuffleService(setupModelTestDB(t, &model.ShuffleEntry{}))
+
+	drawCycle(t, svc, []uint{1, 2, 3}, 1)
+	drawn := drawCycle(t, svc, []uint{1, 2}, 4)
+
+	assert.NotContains(t, drawn, uint(3))
+}
+
+func TestShuffleService_CycleSurvivesRestart(t *testing.T) {
+	db := setupModelTestDB(t, &model.ShuffleEntry{})
+	eligible := []uint{1, 2, 3, 4, 5, 6}
+
+	first := drawCycle(t, NewShuffleService(db), eligible, 3)
+	rest := drawCycle(t, NewShuffleService(db), eligible, 3)
+
+	assert.ElementsMatch(t, eligible, append(first, rest...))
+}
+
+func TestShuffleService_AcceptFallsBackToPlayed(t *testing.T) {
+	svc := NewShuffleService(setupModelTestDB(t, &model.ShuffleEntry{}))
+	eligible := []uint{1, 2, 3}
+
+	id, err := svc.Draw(1, "pool", eligible, func(id uint) bool { return id == 2 })
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), id)
+
+	id, err = svc.Draw(1, "pool", eligible, func(id uint) bool { return id == 2 })
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), id)
+
+	_, err = svc.Draw(1, "pool", nil, nil)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestShuffleService_WeightedCycle(t *testing.T) {
+	svc := NewShuffleService(setupModelTestDB(t, &model.ShuffleEntry{}))
+	images := []model.Image{
+		{ID: 1, Favorite: true},
+		{ID: 2},
+		{ID: 3},
+	}
+	eligible := WeightedPool(model.SelectionFavorites, images)
+	require.Len(t, eligible, favoriteWeight+2)
+
+	drawn := drawCycle(t, svc, eligible, len(eligible))
+	assert.ElementsMatch(t, eligible, drawn)
+	for i := 1; i < len(drawn); i++ {
+		if drawn[i] == 1 && drawn[i-1] == 1 {
+			// Back-to-back repeats are only allowed once nothing else is left.
+			assert.NotContains(t, drawn[i:], uint(2))
+			assert.NotContains(t, drawn[i:], uint(3))
+		}
+	}
+}
+
+func TestShuffleService_DryRunLeavesBagUntouched(t *testing.T) {
+	db := setupModelTestDB(t, &model.ShuffleEntry{})
+	svc := NewShuffleService(db)
+	eligible := []uint{1, 2, 3, 4}
+	drawCycle(t, svc, eligible, 2)
+
+	peeked, err := svc.DryRun().Draw(1, "pool", eligible, nil)
+	require.NoError(t, err)
+	again, err := svc.DryRun().Draw(1, "pool", eligible, nil)
+	require.NoError(t, err)
+	assert.Equal(t, peeked, again)
+
+	var played int64
+	require.NoError(t, db.Model(&model.ShuffleEntry{}).Where("played = ?", true).Count(&played).Error)
+	assert.Equal(t, int64(2), played)
+
+	drawn, err := svc.Draw(1, "pool", eligible, nil)
+	require.NoError(t, err)
+	assert.Equal(t, peeked, drawn)
+}
+
+func TestShuffleService_DryRunMatchesDraw(t *testing.T) {
+	db := setupModelTestDB(t, &model.ShuffleEntry{})
+	svc := NewShuffleService(db)
+	bag := func(pool string) []model.ShuffleEntry {
+		var entries []model.ShuffleEntry
+		require.NoError(t, db.Where("pool = ?", pool).Order("id").Find(&entries).Error)
+		return entries
+	}
+	draw := func(s *ShuffleService, pool string, eligible []uint) uint {
+		id, err := s.Draw(1, pool, eligible, nil)
+		require.NoError(t, err)
+		return id
+	}
+	peek := func(pool string, eligible []uint) {
+		before := bag(pool)
+		peeked := draw(svc.DryRun(), pool, eligible)
+		assert.Equal(t, peeked, draw(svc.DryRun(), pool, eligible))
+		assert.Equal(t, before, bag(pool))
+		assert.Equal(t, peeked, draw(svc, pool, eligible))
+	}
+
+	for i := 0; i < 10; i++ {
+		// At the cycle boundary, the dry run shuffles the next cycle as the
+		// draw after it will
+		pool := fmt.Sprintf("boundary%d", i)
+		eligible := []uint{1, 2, 3, 4}
+		for range eligible {
+			draw(svc, pool, eligible)
+		}
+		peek(pool, eligible)
+
+		// New photos join the current cycle at random positions
+		pool = fmt.Sprintf("added%d", i)
+		draw(svc, pool, eligible)
+		peek(pool, append(eligible, 5, 6, 7, 8))
+	}
+}
+
+func TestShuffleService_CommitDryRunDraws(t *testing.T) {
+	svc := NewShuffleService(setupModelTestDB(t, &model.ShuffleEntry{}))
+	eligible := []uint{1, 2, 3}
+
+	// A frame that is never shown doesn't use up its photo
+	dry := svc.DryRun()
+	first, err := dry.Draw(1, "pool", eligible, nil)
+	require.NoError(t, err)
+	again, err := svc.DryRun().Draw(1, "pool", eligible, nil)
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	require.NoError(t, svc.Commit(dry.Drawn()))
+	drawn := append([]uint{first}, drawCycle(t, svc, eligible, 2)...)
+	assert.ElementsMatch(t, eligible, drawn)
+
+	// Photos that left the bag are skipped
+	assert.NoError(t, svc.Commit([]ShuffleDraw{{DeviceID: 1, Pool: "pool", ImageID: 9, Eligible: eligible}}))
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/synology"
 	"gorm.io/gorm"
 )
@@ -225,6 +226,19 @@ func (s *SynologyService) ImportPhotos() error {
 					existing.ThumbnailKey = p.Additional.Thumbnail.M
 					updated = true
 				}
+				if existing.AlbumID != albumIDStr {
+					existing.AlbumID = albumIDStr
+					updated = true
+				}
+				if existing.TakenAt == nil && p.TakenAt() != nil {
+					existing.TakenAt = p.TakenAt()
+					updated = true
+				}
+				// Only pick up ratings set in Synology; local edits are kept.
+				if existing.Rating == 0 && p.Additional.Rating > 0 {
+					existing.Rating = p.Additional.Rating
+					updated = true
+				}
 				if existing.Orientation == "" {
 					pw, ph := p.Additional.Resolution.Width, p.Additional.Resolution.Height
 					if ph > pw && pw > 0 {
@@ -255,6 +269,10 @@ func (s *SynologyService) ImportPhotos() error {
 				Source:          model.SourceSynologyPhotos,
 				FilePath:        p.Filename,
 				ThumbnailKey:    p.Additional.Thumbnail.M,
+				AlbumID:         albumIDStr,
+				Rating:          p.Additional.Rating,
+				TakenAt:         p.TakenAt(),
+				Format:          imageops.FormatFromName(p.Filename),
 				Width:           pw,
 				Height:          ph,
 				Orientation:     orientation,
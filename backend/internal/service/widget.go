@@ -0,0 +1,434 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+)
+
+// Areas of the built-in layouts widgets can be placed in.
+const (
+	PlacementPrimary   = "primary"   // Bottom left of the overlay, left of the panel header
+	PlacementSecondary = "secondary" // Bottom right of the overlay, right of the panel header
+	PlacementDetail    = "detail"    // Under the primary widgets in the overlay, below the panel's divider
+)
+
+// Widget is an element drawn over or beside the photo, such as the date or
+// the weather. Widgets are registered with a WidgetRegistry and enabled per
+// device; the image handler and device pushes only go through the registry.
+type Widget interface {
+	// Name identifies the widget in device settings, e.g. "weather".
+	Name() string
+	// DefaultPlacement is where the widget goes when the device doesn't say.
+	DefaultPlacement() string
+	// TTL is how long fetched data is reused for a device, 0 = fetched for
+	// every frame.
+	TTL() time.Duration
+	// Fetch returns the data for the device's frame, nil when there is
+	// nothing to show.
+	Fetch(env *WidgetEnv) (interface{}, error)
+	// Sample returns made-up data for layout previews.
+	Sample() interface{}
+	// Fragment is the html/template drawing the widget, executed with a
+	// WidgetView.
+	Fragment() string
+}
+
+// timezoneWidget is implemented by widgets whose data tells the device's
+// timezone. They are fetched first so the others can use it when the device
+// has no timezone set.
+type timezoneWidget interface {
+	Timezone(data interface{}) string
+}
+
+// TextWidget is implemented by widgets that can also be drawn as plain
+// lines of text, by the native renderer used where Chrome isn't available.
+// Widgets without it are left out of natively rendered frames.
+type TextWidget interface {
+	Lines(view WidgetView) []WidgetLine
+}
+
+// Text styles of a WidgetLine, sized like the built-in layouts' text.
+const (
+	TextHeading   = "heading" // Bold, like the date
+	TextBody      = "body"
+	TextSecondary = "secondary"
+)
+
+// WidgetLine is a line of text drawn by a TextWidget.
+type WidgetLine struct {
+	Text  string
+	Style string
+}
+
+// WidgetEnv is what widgets fetch their data for.
+type WidgetEnv struct {
+	Device   *model.Device
+	Timezone string // IANA zone, empty = server local time
+}
+
+// Now returns the current time in the device's timezone.
+func (e *WidgetEnv) Now() time.Time {
+	now := time.Now()
+	if e.Timezone != "" {
+		if loc, err := time.LoadLocation(e.Timezone); err == nil {
+			now = now.In(loc)
+		}
+	}
+	return now
+}
+
+// WidgetView is what a widget's fragment is executed with.
+type WidgetView struct {
+	Layout     string
+	Overlay    bool // Drawn over the photo rather than in a panel
+	Width      int
+	Height     int
+	IsPortrait bool
+	IsSmall    bool
+	Data       interface{} // What the widget's Fetch returned
+}
+
+// WidgetData is a widget's fetched data and where the device shows it.
+type WidgetData struct {
+	Name      string
+	Placement string
+	Data      interface{}
+	widget    Widget
+	fragment  *template.Template
+}
+
+type widgetCacheEntry struct {
+	data    interface{}
+	fetched time.Time
+}
+
+// WidgetRegistry holds the available widgets and caches what they fetched
+// per device.
+type WidgetRegistry struct {
+	mu        sync.Mutex
+	widgets   []Widget
+	fragments map[string]*template.Template
+	cache     map[string]widgetCacheEntry // by widget name and device ID
+}
+
+func NewWidgetRegistry() *WidgetRegistry {
+	return &WidgetRegistry{
+		fragments: make(map[string]*template.Template),
+		cache:     make(map[string]widgetCacheEntry),
+	}
+}
+
+// Register makes a widget available to devices.
+func (r *WidgetRegistry) Register(w Widget) error {
+	if err := ValidatePlacement(w.DefaultPlacement()); err != nil {
+		return err
+	}
+	fragment, err := template.New(w.Name()).Funcs(templateFuncs).Parse(w.Fragment())
+	if err != nil {
+		return fmt.Errorf("failed to parse %s widget: %w", w.Name(), err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.fragments[w.Name()]; ok {
+		return fmt.Errorf("widget %s is already registered", w.Name())
+	}
+	r.widgets = append(r.widgets, w)
+	r.fragments[w.Name()] = fragment
+	return nil
+}
+
+// Widgets returns the registered widgets in registration order.
+func (r *WidgetRegistry) Widgets() []Widget {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Widget(nil), r.widgets...)
+}
+
+// Get returns the widget registered under name, nil if there is none.
+func (r *WidgetRegistry) Get(name string) Widget {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, w := range r.widgets {
+		if w.Name() == name {
+			return w
+		}
+	}
+	return nil
+}
+
+// Fetch gets the data of the device's widgets, reusing what is still within
+// each widget's TTL. Widgets that fail or have nothing to show are left out;
+// a failed fetch falls back to the last data the widget had.
+func (r *WidgetRegistry) Fetch(device *model.Device, placements []model.WidgetPlacement) []WidgetData {
+	if device == nil || len(placements) == 0 {
+		return nil
+	}
+	env := &WidgetEnv{Device: device, Timezone: device.Timezone}
+
+	var widgets, rest []Widget
+	for _, p := range placements {
+		w := r.Get(p.Widget)
+		if w == nil {
+			continue
+		}
+		if _, ok := w.(timezoneWidget); ok {
+			widgets = append(widgets, w)
+		} else {
+			rest = append(rest, w)
+		}
+	}
+	fetched := make(map[string]interface{})
+	for _, w := range append(widgets, rest...) {
+		data := r.fetch(w, env)
+		if data == nil {
+			continue
+		}
+		fetched[w.Name()] = data
+		if tz, ok := w.(timezoneWidget); ok && env.Timezone == "" {
+			env.Timezone = tz.Timezone(data)
+		}
+	}
+
+	var result []WidgetData
+	for _, p := range placements {
+		if data, ok := fetched[p.Widget]; ok {
+			result = append(result, r.widgetData(p, data))
+		}
+	}
+	return result
+}
+
+func (r *WidgetRegistry) fetch(w Widget, env *WidgetEnv) interface{} {
+	key := fmt.Sprintf("%s/%d", w.Name(), env.Device.ID)
+	r.mu.Lock()
+	cached, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && time.Since(cached.fetched) < w.TTL() {
+		return cached.data
+	}
+
+	data, err := w.Fetch(env)
+	if err != nil {
+		log.Printf("Failed to fetch %s widget for device %d: %v", w.Name(), env.Device.ID, err)
+		return cached.data
+	}
+	if w.TTL() > 0 {
+		r.mu.Lock()
+		r.cache[key] = widgetCacheEntry{data: data, fetched: time.Now()}
+		r.mu.Unlock()
+	}
+	return data
+}
+
+// Data returns the named widget's data for the device, through the same
+// cache as Fetch; nil when the widget isn't registered or has nothing to show.
+func (r *WidgetRegistry) Data(device *model.Device, name string) interface{} {
+	w := r.Get(name)
+	if device == nil || w == nil {
+		return nil
+	}
+	return r.fetch(w, &WidgetEnv{Device: device, Timezone: device.Timezone})
+}
+
+// Invalidate drops the data cached for a device, after its settings change.
+func (r *WidgetRegistry) Invalidate(deviceID uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	suffix := fmt.Sprintf("/%d", deviceID)
+	for key := range r.cache {
+		if strings.HasSuffix(key, suffix) {
+			delete(r.cache, key)
+		}
+	}
+}
+
+func (r *WidgetRegistry) widgetData(p model.WidgetPlacement, data interface{}) WidgetData {
+	w := r.Get(p.Widget)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return WidgetData{Name: p.Widget, Placement: p.Placement, Data: data, widget: w, fragment: r.fragments[p.Widget]}
+}
+
+// SampleRenderOptions returns options showing every registered widget with
+// made-up data over a placeholder photo, for previewing layouts.
+func (r *WidgetRegistry) SampleRenderOptions(w, h int) RenderOptions {
+	opts := sampleRenderOptions(w, h)
+	for _, widget := range r.Widgets() {
+		p := model.WidgetPlacement{Widget: widget.Name(), Placement: widget.DefaultPlacement()}
+		opts.Widgets = append(opts.Widgets, r.widgetData(p, widget.Sample()))
+	}
+	return opts
+}
+
+// ValidatePlacement checks that placement is one of the layout areas.
+func ValidatePlacement(placement string) error {
+	switch placement {
+	case PlacementPrimary, PlacementSecondary, PlacementDetail:
+		return nil
+	}
+	return fmt.Errorf("unknown widget placement: %s", placement)
+}
+
+// LayoutWidgets returns the widgets the device shows in the layout. On
+// dashboards, devices that never picked widgets get the date, weather,
+// agenda and forecast.
+func LayoutWidgets(device *model.Device, layout string) []model.WidgetPlacement {
+	if device == nil || layout != model.LayoutDashboard || device.Widgets != nil {
+		return DeviceWidgets(device)
+	}
+	return []model.WidgetPlacement{
+		{Widget: WidgetDate, Placement: PlacementPrimary},
+		{Widget: WidgetWeather, Placement: PlacementSecondary},
+		{Widget: WidgetAgenda, Placement: PlacementDetail},
+		{Widget: WidgetForecast, Placement: PlacementDetail},
+	}
+}
+
+// DeviceWidgets returns the widgets the device shows. Devices that never
+// picked widgets get the built-in ones their show_date, show_weather and
+// show_calendar switches turn on, in their usual places.
+func DeviceWidgets(device *model.Device) []model.WidgetPlacement {
+	if device == nil {
+		return nil
+	}
+	if device.Widgets != nil {
+		return device.Widgets
+	}
+	var widgets []model.WidgetPlacement
+	for _, sw := range widgetSwitches(device) {
+		if *sw.on {
+			widgets = append(widgets, model.WidgetPlacement{Widget: sw.widget, Placement: sw.placement})
+		}
+	}
+	return widgets
+}
+
+// SetWidgets stores the widgets the device shows, in drawing order. The
+// show_date, show_weather and show_calendar switches follow the list.
+func (s *DeviceService) SetWidgets(device *model.Device, widgets []model.WidgetPlacement) error {
+	seen := make(map[string]bool)
+	for i, p := range widgets {
+		w := s.widgets.Get(p.Widget)
+		if w == nil {
+			return fmt.Errorf("unknown widget: %s", p.Widget)
+		}
+		if seen[p.Widget] {
+			return fmt.Errorf("widget %s is listed twice", p.Widget)
+		}
+		seen[p.Widget] = true
+		if p.Placement == "" {
+			widgets[i].Placement = w.DefaultPlacement()
+		} else if err := ValidatePlacement(p.Placement); err != nil {
+			return err
+		}
+	}
+	if widgets == nil {
+		widgets = []model.WidgetPlacement{}
+	}
+
+	device.Widgets = widgets
+	for _, sw := range widgetSwitches(device) {
+		*sw.on = seen[sw.widget]
+	}
+	s.widgets.Invalidate(device.ID)
+	return s.db.Model(device).Select("Widgets", "ShowDate", "ShowWeather", "ShowCalendar").Updates(device).Error
+}
+
+type widgetSwitch struct {
+	widget    string
+	placement string
+	on        *bool
+}
+
+// widgetSwitches pairs the built-in widgets with the device switches that
+// predate per-device widget lists.
+func widgetSwitches(device *model.Device) []widgetSwitch {
+	return []widgetSwitch{
+		{WidgetDate, PlacementPrimary, &device.ShowDate},
+		{WidgetWeather, PlacementSecondary, &device.ShowWeather},
+		{WidgetCalendar, PlacementDetail, &device.ShowCalendar},
+	}
+}
+
+// syncWidgetSwitches adds or removes built-in widgets from a device's list
+// when their switch is flipped through the device settings.
+func syncWidgetSwitches(device *model.Device) {
+	if device.Widgets == nil {
+		return
+	}
+	for _, sw := range widgetSwitches(device) {
+		idx := -1
+		for i, p := range device.Widgets {
+			if p.Widget == sw.widget {
+				idx = i
+			}
+		}
+		switch {
+		case *sw.on && idx < 0:
+			device.Widgets = append(device.Widgets, model.WidgetPlacement{Widget: sw.widget, Placement: sw.placement})
+		case !*sw.on && idx >= 0:
+			device.Widgets = append(device.Widgets[:idx], device.Widgets[idx+1:]...)
+		}
+	}
+}
+
+// renderWidgets draws the widgets for the layout, grouped by placement.
+// Widgets that draw nothing are left out.
+func renderWidgets(opts RenderOptions) (map[string][]template.HTML, error) {
+	slots := make(map[string][]template.HTML)
+	view := newWidgetView(opts)
+	for _, w := range opts.Widgets {
+		if w.fragment == nil {
+			continue
+		}
+		view.Data = w.Data
+		var buf bytes.Buffer
+		if err := w.fragment.Execute(&buf, view); err != nil {
+			return nil, fmt.Errorf("failed to render %s widget: %w", w.Name, err)
+		}
+		html := strings.TrimSpace(buf.String())
+		if html == "" {
+			continue
+		}
+		// Fragments are html/templates, so their output is already escaped
+		slots[w.Placement] = append(slots[w.Placement], template.HTML(html))
+	}
+	return slots, nil
+}
+
+// widgetLines returns the text of the widgets that have any, grouped by
+// placement.
+func widgetLines(opts RenderOptions) map[string][][]WidgetLine {
+	lines := make(map[string][][]WidgetLine)
+	view := newWidgetView(opts)
+	for _, w := range opts.Widgets {
+		tw, ok := w.widget.(TextWidget)
+		if !ok {
+			continue
+		}
+		view.Data = w.Data
+		if l := tw.Lines(view); len(l) > 0 {
+			lines[w.Placement] = append(lines[w.Placement], l)
+		}
+	}
+	return lines
+}
+
+func newWidgetView(opts RenderOptions) WidgetView {
+	return WidgetView{
+		Layout:     opts.Layout,
+		Overlay:    opts.Layout != model.LayoutPhotoInfo && opts.Layout != model.LayoutSidePanel && opts.Layout != model.LayoutDashboard,
+		Width:      opts.Width,
+		Height:     opts.Height,
+		IsPortrait: opts.Height > opts.Width,
+		IsSmall:    opts.Width*opts.Height < 500000,
+	}
+}
@@ -0,0 +1,544 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/gcalendar"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/googlephotos"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/weather"
+)
+
+// Names of the built-in widgets.
+const (
+	WidgetDate     = "date"
+	WidgetWeather  = "weather"
+	WidgetCalendar = "calendar"
+	WidgetAgenda   = "agenda"
+	WidgetForecast = "forecast"
+)
+
+const (
+	agendaDays   = 4 // Days the agenda covers, starting today
+	forecastDays = 7
+)
+
+// DateData is what the date widget shows.
+type DateData struct {
+	Short string // In the device's date format, "Mon, Jan 02" by default
+	Long  string // "Monday, January 02, 2006"
+	Time  string // "15:04"
+}
+
+// DateWidget shows today's date in the device's timezone.
+type DateWidget struct{}
+
+func NewDateWidget() *DateWidget {
+	return &DateWidget{}
+}
+
+func (w *DateWidget) Name() string             { return WidgetDate }
+func (w *DateWidget) DefaultPlacement() string { return PlacementPrimary }
+func (w *DateWidget) TTL() time.Duration       { return 0 }
+
+func (w *DateWidget) Fetch(env *WidgetEnv) (interface{}, error) {
+	return newDateData(env.Now(), env.Device.DateFormat), nil
+}
+
+func (w *DateWidget) Sample() interface{} {
+	return newDateData(time.Now(), "")
+}
+
+func (w *DateWidget) Fragment() string {
+	return `<div class="date">{{.Data.Short}}</div>`
+}
+
+func (w *DateWidget) Lines(view WidgetView) []WidgetLine {
+	data, ok := view.Data.(*DateData)
+	if !ok {
+		return nil
+	}
+	return []WidgetLine{{Text: data.Short, Style: TextHeading}}
+}
+
+func newDateData(now time.Time, format string) *DateData {
+	return &DateData{
+		Short: now.Format(dateFormat(format)),
+		Long:  now.Format("Monday, January 02, 2006"),
+		Time:  now.Format("15:04"),
+	}
+}
+
+// WeatherWidget shows the current weather at the device's coordinates.
+type WeatherWidget struct {
+	client *weather.Client
+}
+
+func NewWeatherWidget(client *weather.Client) *WeatherWidget {
+	return &WeatherWidget{client: client}
+}
+
+func (w *WeatherWidget) Name() string             { return WidgetWeather }
+func (w *WeatherWidget) DefaultPlacement() string { return PlacementSecondary }
+func (w *WeatherWidget) TTL() time.Duration       { return 10 * time.Minute }
+
+func (w *WeatherWidget) Fetch(env *WidgetEnv) (interface{}, error) {
+	device := env.Device
+	if w.client == nil || device.WeatherLat == 0 || device.WeatherLon == 0 {
+		return nil, nil
+	}
+	data, err := w.client.GetWeather(fmt.Sprintf("%f", device.WeatherLat), fmt.Sprintf("%f", device.WeatherLon))
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Timezone returns the zone of the device's coordinates, which the date
+// and calendar use when the device has none set.
+func (w *WeatherWidget) Timezone(data interface{}) string {
+	if current, ok := data.(*weather.CurrentWeather); ok {
+		return current.Timezone
+	}
+	return ""
+}
+
+func (w *WeatherWidget) Sample() interface{} {
+	return &weather.CurrentWeather{Temperature: 21.5, WeatherCode: 2, Humidity: 60}
+}
+
+func (w *WeatherWidget) Fragment() string {
+	return `{{if .Overlay}}
+<span class="material-symbols-outlined weather-icon-small">{{.Data.IconName}}</span>
+<div class="weather-details">{{printf "%.1f" .Data.Temperature}}&deg;C &nbsp; {{.Data.Humidity}}%</div>
+{{else}}
+<div class="weather-block">
+  <span class="material-symbols-outlined weather-icon">{{.Data.IconName}}</span>
+  <div>
+    <div class="weather-temp">{{printf "%.1f" .Data.Temperature}}&deg;C</div>
+    {{if eq .Layout "side_panel"}}
+    <div class="weather-details">{{.Data.Description}} &middot; {{.Data.Humidity}}%</div>
+    {{else}}
+    <div class="weather-details">{{.Data.Humidity}}% humidity</div>
+    {{end}}
+  </div>
+</div>
+{{end}}`
+}
+
+// Lines has no icon font to draw with, so the overlay names the weather.
+func (w *WeatherWidget) Lines(view WidgetView) []WidgetLine {
+	current, ok := view.Data.(*weather.CurrentWeather)
+	if !ok {
+		return nil
+	}
+	temp := fmt.Sprintf("%.1f°C", current.Temperature)
+	if view.Overlay {
+		return []WidgetLine{{Text: fmt.Sprintf("%s  %s  %d%%", current.Description(), temp, current.Humidity), Style: TextSecondary}}
+	}
+	details := fmt.Sprintf("%d%% humidity", current.Humidity)
+	if view.Layout == model.LayoutSidePanel {
+		details = fmt.Sprintf("%s · %d%%", current.Description(), current.Humidity)
+	}
+	return []WidgetLine{{Text: temp, Style: TextHeading}, {Text: details, Style: TextSecondary}}
+}
+
+// CalendarWidget shows today's events from the device's Google calendar.
+type CalendarWidget struct {
+	client *gcalendar.Client
+	google *googlephotos.Client
+}
+
+func NewCalendarWidget(client *gcalendar.Client, google *googlephotos.Client) *CalendarWidget {
+	return &CalendarWidget{client: client, google: google}
+}
+
+func (w *CalendarWidget) Name() string             { return WidgetCalendar }
+func (w *CalendarWidget) DefaultPlacement() string { return PlacementDetail }
+func (w *CalendarWidget) TTL() time.Duration       { return 5 * time.Minute }
+
+func (w *CalendarWidget) Fetch(env *WidgetEnv) (interface{}, error) {
+	if w.client == nil || w.google == nil {
+		return nil, nil
+	}
+	httpClient, err := w.google.GetClient()
+	if err != nil {
+		// Calendar not connected
+		return nil, nil
+	}
+	calendarID := env.Device.CalendarID
+	if calendarID == "" {
+		calendarID = "primary"
+	}
+	events, err := w.client.GetTodayEvents(httpClient, calendarID, env.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []gcalendar.Event{}
+	}
+	return events, nil
+}
+
+func (w *CalendarWidget) Sample() interface{} {
+	today := time.Now().Truncate(24 * time.Hour)
+	return []gcalendar.Event{
+		{Summary: "Team standup", Start: today.Add(9 * time.Hour), End: today.Add(9*time.Hour + 15*time.Minute)},
+		{Summary: "Lunch with Sam", Start: today.Add(12 * time.Hour), End: today.Add(13 * time.Hour)},
+		{Summary: "Holiday", Start: today, End: today.Add(24 * time.Hour), AllDay: true},
+	}
+}
+
+// The overlay shows the next event and up to two more inline; panels list
+// as many as fit below the divider.
+func (w *CalendarWidget) Fragment() string {
+	return `{{$events := layoutEvents . .Data}}
+{{if .Overlay}}
+{{with nextEvent $events}}
+<div class="event-inline">{{formatEventTime .}} &mdash; {{.Summary}}</div>
+{{end}}
+{{range $i, $ev := $events}}{{if and (gt $i 0) (le $i 2)}}
+<div class="event-inline">{{formatEventTime $ev}} &mdash; {{$ev.Summary}}</div>
+{{end}}{{end}}
+{{else if $events}}
+<ul class="events-list">
+  {{range $events}}
+  <li class="event-item">
+    <span class="event-time">{{formatEventTime .}}</span>
+    <span class="event-title">{{.Summary}}</span>
+  </li>
+  {{end}}
+</ul>
+{{end}}`
+}
+
+func (w *CalendarWidget) Lines(view WidgetView) []WidgetLine {
+	events, ok := view.Data.([]gcalendar.Event)
+	if !ok {
+		return nil
+	}
+	events = layoutEvents(view, events)
+	var lines []WidgetLine
+	if view.Overlay {
+		if next := gcalendar.GetNextEvent(events); next != nil {
+			lines = append(lines, WidgetLine{Text: gcalendar.FormatEventTime(*next) + " — " + next.Summary, Style: TextSecondary})
+		}
+		for i := 1; i < len(events) && i <= 2; i++ {
+			lines = append(lines, WidgetLine{Text: gcalendar.FormatEventTime(events[i]) + " — " + events[i].Summary, Style: TextSecondary})
+		}
+		return lines
+	}
+	for _, ev := range events {
+		lines = append(lines, WidgetLine{Text: gcalendar.FormatEventTime(ev) + "   " + ev.Summary, Style: TextBody})
+	}
+	return lines
+}
+
+// layoutEvents picks the events that fit the layout the calendar is drawn in.
+func layoutEvents(view WidgetView, events []gcalendar.Event) []gcalendar.Event {
+	return filterEventsForLayout(view.Layout, events, calcMaxEvents(view.Layout, view.Width, view.Height))
+}
+
+// AgendaData is the agenda widget's events, by day.
+type AgendaData struct {
+	Days []AgendaDay
+}
+
+// AgendaDay is one day of the agenda that has events.
+type AgendaDay struct {
+	Label  string // "Today", "Tomorrow", then the date
+	Date   time.Time
+	Events []gcalendar.Event
+}
+
+// AgendaWidget shows the device's Google calendar for the next few days.
+type AgendaWidget struct {
+	client *gcalendar.Client
+	google *googlephotos.Client
+}
+
+func NewAgendaWidget(client *gcalendar.Client, google *googlephotos.Client) *AgendaWidget {
+	return &AgendaWidget{client: client, google: google}
+}
+
+func (w *AgendaWidget) Name() string             { return WidgetAgenda }
+func (w *AgendaWidget) DefaultPlacement() string { return PlacementDetail }
+func (w *AgendaWidget) TTL() time.Duration       { return 5 * time.Minute }
+
+func (w *AgendaWidget) Fetch(env *WidgetEnv) (interface{}, error) {
+	if w.client == nil || w.google == nil {
+		return nil, nil
+	}
+	httpClient, err := w.google.GetClient()
+	if err != nil {
+		// Calendar not connected
+		return nil, nil
+	}
+	calendarID := env.Device.CalendarID
+	if calendarID == "" {
+		calendarID = "primary"
+	}
+	events, err := w.client.GetEvents(httpClient, calendarID, env.Timezone, agendaDays)
+	if err != nil {
+		return nil, err
+	}
+	return newAgendaData(events, env.Now(), agendaDays, env.Device.DateFormat), nil
+}
+
+func (w *AgendaWidget) Sample() interface{} {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	tomorrow := today.AddDate(0, 0, 1)
+	events := []gcalendar.Event{
+		{Summary: "Team standup", Start: today.Add(9 * time.Hour), End: today.Add(9*time.Hour + 15*time.Minute)},
+		{Summary: "Lunch with Sam", Start: today.Add(12 * time.Hour), End: today.Add(13 * time.Hour)},
+		{Summary: "Dentist", Start: tomorrow.Add(10 * time.Hour), End: tomorrow.Add(11 * time.Hour)},
+		{Summary: "Holiday", Start: today.AddDate(0, 0, 2), End: today.AddDate(0, 0, 3), AllDay: true},
+	}
+	// Events of the sample day that are already over would be left out
+	return newAgendaData(events, today, agendaDays, "")
+}
+
+func (w *AgendaWidget) Fragment() string {
+	return `{{$agenda := limitAgenda . .Data}}
+{{if .Overlay}}
+{{range $agenda.Days}}{{$day := .}}{{range .Events}}
+<div class="event-inline">{{$day.Label}} {{formatEventTime .}} &mdash; {{.Summary}}</div>
+{{end}}{{end}}
+{{else}}
+<div class="agenda">
+  {{range $agenda.Days}}
+  <div class="agenda-day">{{.Label}}</div>
+  <ul class="events-list">
+    {{range .Events}}
+    <li class="event-item">
+      <span class="event-time">{{formatEventTime .}}</span>
+      <span class="event-title">{{.Summary}}</span>
+    </li>
+    {{end}}
+  </ul>
+  {{else}}
+  <div class="weather-details">No upcoming events</div>
+  {{end}}
+</div>
+{{end}}`
+}
+
+func (w *AgendaWidget) Lines(view WidgetView) []WidgetLine {
+	agenda := limitAgenda(view, view.Data)
+	var lines []WidgetLine
+	for _, day := range agenda.Days {
+		if !view.Overlay {
+			lines = append(lines, WidgetLine{Text: day.Label, Style: TextHeading})
+		}
+		for _, ev := range day.Events {
+			if view.Overlay {
+				lines = append(lines, WidgetLine{Text: day.Label + " " + gcalendar.FormatEventTime(ev) + " — " + ev.Summary, Style: TextSecondary})
+			} else {
+				lines = append(lines, WidgetLine{Text: gcalendar.FormatEventTime(ev) + "   " + ev.Summary, Style: TextBody})
+			}
+		}
+	}
+	if len(lines) == 0 && !view.Overlay {
+		lines = append(lines, WidgetLine{Text: "No upcoming events", Style: TextSecondary})
+	}
+	return lines
+}
+
+// newAgendaData groups the events by the days they fall on, starting with
+// the day of now and in its timezone. All-day events spanning several days
+// are listed on each; days without events are left out.
+func newAgendaData(events []gcalendar.Event, now time.Time, days int, format string) *AgendaData {
+	agenda := &AgendaData{Days: []AgendaDay{}}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for i := 0; i < days; i++ {
+		start := today.AddDate(0, 0, i)
+		end := start.AddDate(0, 0, 1)
+		day := AgendaDay{Date: start}
+		for _, ev := range events {
+			switch {
+			case ev.AllDay:
+				if ev.Start.Before(end) && ev.End.After(start) {
+					day.Events = append(day.Events, ev)
+				}
+			case !ev.End.After(now):
+				// Over already
+			case i == 0 && ev.Start.Before(end):
+				// Today's, and ongoing ones from before today
+				day.Events = append(day.Events, ev)
+			case !ev.Start.Before(start) && ev.Start.Before(end):
+				day.Events = append(day.Events, ev)
+			}
+		}
+		if len(day.Events) == 0 {
+			continue
+		}
+		switch i {
+		case 0:
+			day.Label = "Today"
+		case 1:
+			day.Label = "Tomorrow"
+		default:
+			day.Label = start.Format(dateFormat(format))
+		}
+		agenda.Days = append(agenda.Days, day)
+	}
+	return agenda
+}
+
+// limitAgenda trims the agenda to what fits the layout it is drawn in,
+// counting each day's heading as a row in panels.
+func limitAgenda(view WidgetView, data interface{}) *AgendaData {
+	agenda, ok := data.(*AgendaData)
+	if !ok {
+		return &AgendaData{}
+	}
+	rows := calcMaxEvents(view.Layout, view.Width, view.Height)
+	limited := &AgendaData{}
+	for _, day := range agenda.Days {
+		if !view.Overlay {
+			rows--
+		}
+		if rows <= 0 {
+			break
+		}
+		day.Events = limitEvents(day.Events, rows)
+		rows -= len(day.Events)
+		limited.Days = append(limited.Days, day)
+	}
+	return limited
+}
+
+// ForecastWidget shows the hourly and daily forecast at the device's
+// coordinates.
+type ForecastWidget struct {
+	client *weather.Client
+}
+
+func NewForecastWidget(client *weather.Client) *ForecastWidget {
+	return &ForecastWidget{client: client}
+}
+
+func (w *ForecastWidget) Name() string             { return WidgetForecast }
+func (w *ForecastWidget) DefaultPlacement() string { return PlacementDetail }
+func (w *ForecastWidget) TTL() time.Duration       { return 30 * time.Minute }
+
+func (w *ForecastWidget) Fetch(env *WidgetEnv) (interface{}, error) {
+	device := env.Device
+	if w.client == nil || device.WeatherLat == 0 || device.WeatherLon == 0 {
+		return nil, nil
+	}
+	return w.client.GetForecast(fmt.Sprintf("%f", device.WeatherLat), fmt.Sprintf("%f", device.WeatherLon), forecastDays)
+}
+
+// Timezone returns the zone of the device's coordinates, like the weather
+// widget's.
+func (w *ForecastWidget) Timezone(data interface{}) string {
+	if forecast, ok := data.(*weather.Forecast); ok {
+		return forecast.Timezone
+	}
+	return ""
+}
+
+func (w *ForecastWidget) Sample() interface{} {
+	now := time.Now().Truncate(time.Hour)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	forecast := &weather.Forecast{}
+	for i := 0; i < 24; i++ {
+		forecast.Hourly = append(forecast.Hourly, weather.HourlyForecast{
+			Time:                     now.Add(time.Duration(i) * time.Hour),
+			Temperature:              18 + 4*math.Sin(float64(i)/4),
+			WeatherCode:              []int{0, 2, 3, 61}[i/6],
+			PrecipitationProbability: i * 3,
+		})
+	}
+	for i := 0; i < forecastDays; i++ {
+		forecast.Daily = append(forecast.Daily, weather.DailyForecast{
+			Date:                     today.AddDate(0, 0, i),
+			TemperatureMax:           float64(21 + i%3),
+			TemperatureMin:           float64(11 + i%2),
+			WeatherCode:              []int{2, 0, 61, 3}[i%4],
+			PrecipitationProbability: []int{10, 0, 80, 30}[i%4],
+		})
+	}
+	return forecast
+}
+
+func (w *ForecastWidget) Fragment() string {
+	return `{{$f := limitForecast . .Data}}
+{{if .Overlay}}
+<div class="event-inline">{{range $i, $d := $f.Daily}}{{if $i}} &middot; {{end}}{{$d.Date.Format "Mon"}} {{printf "%.0f" $d.TemperatureMax}}&deg;/{{printf "%.0f" $d.TemperatureMin}}&deg;{{end}}</div>
+{{else}}
+<div class="forecast">
+  {{with $f.Hourly}}
+  <div class="forecast-hours">
+    {{range .}}
+    <div class="forecast-hour">
+      <div class="weather-details">{{.Time.Format "15:04"}}</div>
+      <span class="material-symbols-outlined weather-icon-small">{{.IconName}}</span>
+      <div class="forecast-temp">{{printf "%.0f" .Temperature}}&deg;</div>
+    </div>
+    {{end}}
+  </div>
+  {{end}}
+  {{range $f.Daily}}
+  <div class="forecast-day">
+    <span class="forecast-day-name">{{.Date.Format "Mon"}}</span>
+    <span class="material-symbols-outlined weather-icon-small">{{.IconName}}</span>
+    <span class="forecast-temp">{{printf "%.0f" .TemperatureMax}}&deg; / {{printf "%.0f" .TemperatureMin}}&deg;</span>
+    <span class="weather-details">{{.PrecipitationProbability}}%</span>
+  </div>
+  {{end}}
+</div>
+{{end}}`
+}
+
+func (w *ForecastWidget) Lines(view WidgetView) []WidgetLine {
+	f := limitForecast(view, view.Data)
+	if view.Overlay {
+		var days []string
+		for _, d := range f.Daily {
+			days = append(days, fmt.Sprintf("%s %.0f°/%.0f°", d.Date.Format("Mon"), d.TemperatureMax, d.TemperatureMin))
+		}
+		if len(days) == 0 {
+			return nil
+		}
+		return []WidgetLine{{Text: strings.Join(days, " · "), Style: TextSecondary}}
+	}
+	var lines []WidgetLine
+	for _, h := range f.Hourly {
+		lines = append(lines, WidgetLine{Text: fmt.Sprintf("%s   %.0f°   %s", h.Time.Format("15:04"), h.Temperature, h.Description()), Style: TextSecondary})
+	}
+	for _, d := range f.Daily {
+		lines = append(lines, WidgetLine{Text: fmt.Sprintf("%s   %.0f° / %.0f°   %s %d%%", d.Date.Format("Mon"), d.TemperatureMax, d.TemperatureMin, d.Description(), d.PrecipitationProbability), Style: TextBody})
+	}
+	return lines
+}
+
+// limitForecast picks what of the forecast fits the layout it is drawn in:
+// every other hour of the next half day and the coming days on dashboards,
+// only the days elsewhere.
+func limitForecast(view WidgetView, data interface{}) *weather.Forecast {
+	forecast, ok := data.(*weather.Forecast)
+	if !ok {
+		return &weather.Forecast{}
+	}
+	limited := &weather.Forecast{Timezone: forecast.Timezone}
+	days := 3
+	if view.Layout == model.LayoutDashboard {
+		hours := 6
+		days = 5
+		if view.IsSmall {
+			hours = 4
+			days = 4
+		}
+		for i := 0; i < len(forecast.Hourly) && len(limited.Hourly) < hours; i += 2 {
+			limited.Hourly = append(limited.Hourly, forecast.Hourly[i])
+		}
+	}
+	limited.Daily = forecast.Daily[:min(days, len(forecast.Daily))]
+	return limited
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/gcalendar"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/weather"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBuiltinWidgets(t *testing.T) *WidgetRegistry {
+	r := NewWidgetRegistry()
+	require.NoError(t, r.Register(NewDateWidget()))
+	require.NoError(t, r.Register(NewWeatherWidget(nil)))
+	require.NoError(t, r.Register(NewCalendarWidget(nil, nil)))
+	require.NoError(t, r.Register(NewAgendaWidget(nil, nil)))
+	require.NoError(t, r.Register(NewForecastWidget(nil)))
+	return r
+}
+
+// counterWidget counts its fetches and fails when told to.
+type counterWidget struct {
+	fetches int
+	fail    bool
+}
+
+func (w *counterWidget) Name() string             { return "counter" }
+func (w *counterWidget) DefaultPlacement() string { return PlacementDetail }
+func (w *counterWidget) TTL() time.Duration       { return time.Hour }
+func (w *counterWidget) Sample() interface{}      { return 0 }
+func (w *counterWidget) Fragment() string         { return `<b>{{.Data}}</b>` }
+
+func (w *counterWidget) Fetch(env *WidgetEnv) (interface{}, error) {
+	if w.fail {
+		return nil, errors.New("offline")
+	}
+	w.fetches++
+	return w.fetches, nil
+}
+
+func TestWidgetRegistry_FetchCaches(t *testing.T) {
+	r := NewWidgetRegistry()
+	counter := &counterWidget{}
+	require.NoError(t, r.Register(counter))
+	assert.Error(t, r.Register(counter))
+
+	device := &model.Device{ID: 1}
+	placements := []model.WidgetPlacement{{Widget: "counter", Placement: PlacementDetail}, {Widget: "unknown"}}
+
+	data := r.Fetch(device, placements)
+	require.Len(t, data, 1)
+	assert.Equal(t, 1, data[0].Data)
+
+	// Within the TTL, and on failure, the last data is reused
+	assert.Equal(t, 1, r.Fetch(device, placements)[0].Data)
+	counter.fail = true
+	r.cache["counter/1"] = widgetCacheEntry{data: 1}
+	assert.Equal(t, 1, r.Fetch(device, placements)[0].Data)
+
+	counter.fail = false
+	r.Invalidate(1)
+	assert.Equal(t, 2, r.Fetch(device, placements)[0].Data)
+}
+
+func TestRenderWidgets(t *testing.T) {
+	r := newBuiltinWidgets(t)
+	placements := []model.WidgetPlacement{
+		{Widget: WidgetWeather, Placement: PlacementSecondary},
+		{Widget: WidgetCalendar, Placement: PlacementDetail},
+	}
+	opts := RenderOptions{Layout: model.LayoutSidePanel, Width: 800, Height: 480}
+	opts.Widgets = []WidgetData{
+		r.widgetData(placements[0], &weather.CurrentWeather{Temperature: 18, WeatherCode: 0, Humidity: 40}),
+		r.widgetData(placements[1], r.Get(WidgetCalendar).Sample()),
+	}
+
+	slots, err := renderWidgets(opts)
+	require.NoError(t, err)
+	require.Len(t, slots[PlacementSecondary], 1)
+	assert.Contains(t, string(slots[PlacementSecondary][0]), "Clear &middot; 40%")
+	assert.Contains(t, string(slots[PlacementDetail][0]), "Team standup")
+
+	// The overlay shows the weather inline; a day without events draws nothing
+	opts.Layout = model.LayoutPhotoOverlay
+	opts.Widgets[1].Data = []gcalendar.Event{}
+	slots, err = renderWidgets(opts)
+	require.NoError(t, err)
+	assert.Contains(t, string(slots[PlacementSecondary][0]), "weather-icon-small")
+	assert.Empty(t, slots[PlacementDetail])
+}
+
+func TestAgenda(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	now := time.Date(2024, 3, 4, 10, 0, 0, 0, loc)
+	at := func(day, hour int) time.Time { return time.Date(2024, 3, day, hour, 0, 0, 0, loc) }
+	events := []gcalendar.Event{
+		{Summary: "Breakfast", Start: at(4, 8), End: at(4, 9)},
+		{Summary: "Standup", Start: at(4, 9), End: at(4, 11)},
+		{Summary: "Holiday", Start: at(5, 0), End: at(7, 0), AllDay: true},
+		{Summary: "Dentist", Start: at(6, 15), End: at(6, 16)},
+		{Summary: "Too late", Start: at(8, 9), End: at(8, 10)},
+	}
+
+	agenda := newAgendaData(events, now, agendaDays, "")
+	require.Len(t, agenda.Days, 3)
+	assert.Equal(t, "Today", agenda.Days[0].Label)
+	assert.Equal(t, "Standup", agenda.Days[0].Events[0].Summary)
+	assert.Equal(t, "Tomorrow", agenda.Days[1].Label)
+	assert.Equal(t, []string{"Holiday", "Dentist"}, []string{agenda.Days[2].Events[0].Summary, agenda.Days[2].Events[1].Summary})
+
+	// Day headings count as rows in panels
+	view := WidgetView{Layout: model.LayoutPhotoInfo, Width: 800, Height: 480}
+	rows := calcMaxEvents(view.Layout, view.Width, view.Height)
+	limited := limitAgenda(view, agenda)
+	var used int
+	for _, day := range limited.Days {
+		used += 1 + len(day.Events)
+	}
+	assert.LessOrEqual(t, used, rows)
+	view = WidgetView{Layout: model.LayoutDashboard, Width: 800, Height: 480}
+	assert.Len(t, limitAgenda(view, agenda).Days, 3)
+}
+
+func TestLayoutWidgets(t *testing.T) {
+	device := &model.Device{ShowDate: true}
+	assert.Equal(t, DeviceWidgets(device), LayoutWidgets(device, model.LayoutPhotoInfo))
+
+	// A dashboard shows everything until widgets have been picked
+	names := []string{}
+	for _, p := range LayoutWidgets(device, model.LayoutDashboard) {
+		names = append(names, p.Widget)
+	}
+	assert.Equal(t, []string{WidgetDate, WidgetWeather, WidgetAgenda, WidgetForecast}, names)
+	device.Widgets = []model.WidgetPlacement{{Widget: WidgetAgenda, Placement: PlacementDetail}}
+	assert.Equal(t, device.Widgets, LayoutWidgets(device, model.LayoutDashboard))
+}
+
+func TestDeviceWidgets(t *testing.T) {
+	device := &model.Device{ShowDate: true, ShowCalendar: true}
+	assert.Equal(t, []model.WidgetPlacement{
+		{Widget: WidgetDate, Placement: PlacementPrimary},
+		{Widget: WidgetCalendar, Placement: PlacementDetail},
+	}, DeviceWidgets(device))
+
+	// Once picked, the list wins; the switches add and remove built-ins
+	device.Widgets = []model.WidgetPlacement{{Widget: WidgetCalendar, Placement: PlacementPrimary}}
+	device.ShowCalendar = true
+	device.ShowDate = false
+	device.ShowWeather = true
+	syncWidgetSwitches(device)
+	assert.Equal(t, []model.WidgetPlacement{
+		{Widget: WidgetCalendar, Placement: PlacementPrimary},
+		{Widget: WidgetWeather, Placement: PlacementSecondary},
+	}, DeviceWidgets(device))
+}
+
+func TestSetWidgets(t *testing.T) {
+	db := setupModelTestDB(t, &model.Device{})
+	svc := &DeviceService{db: db, widgets: newBuiltinWidgets(t)}
+	device := &model.Device{Name: "Hall", ShowDate: true}
+	require.NoError(t, db.Create(device).Error)
+
+	assert.Error(t, svc.SetWidgets(device, []model.WidgetPlacement{{Widget: "clock"}}))
+	assert.Error(t, svc.SetWidgets(device, []model.WidgetPlacement{{Widget: WidgetDate, Placement: "top"}}))
+	assert.Error(t, svc.SetWidgets(device, []model.WidgetPlacement{{Widget: WidgetDate}, {Widget: WidgetDate}}))
+
+	require.NoError(t, svc.SetWidgets(device, []model.WidgetPlacement{{Widget: WidgetWeather}}))
+	var reloaded model.Device
+	require.NoError(t, db.First(&reloaded, device.ID).Error)
+	assert.Equal(t, []model.WidgetPlacement{{Widget: WidgetWeather, Placement: PlacementSecondary}}, reloaded.Widgets)
+	assert.False(t, reloaded.ShowDate)
+	assert.True(t, reloaded.ShowWeather)
+
+	// No widgets at all is different from never having picked any
+	require.NoError(t, svc.SetWidgets(device, nil))
+	require.NoError(t, db.First(&reloaded, device.ID).Error)
+	assert.NotNil(t, reloaded.Widgets)
+	assert.Empty(t, DeviceWidgets(&reloaded))
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/db"
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/handler"
@@ -11,6 +12,7 @@ import (
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/service"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/gcalendar"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/googlephotos"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/photoframe"
 	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/weather"
 	"github.com/labstack/echo/v4"
@@ -153,22 +155,62 @@ func main() {
 	calendarConfigProvider := service.NewCalendarConfigProvider(settingsService)
 	googleCalendarClient := googlephotos.NewClient(calendarConfigProvider, calendarTokenStore)
 
-	// Initialize Processor
-	processorService := service.NewProcessorService()
+	// Initialize Processor (IMAGE_PROCESSOR=cli selects epaper-image-convert)
+	processorService := service.NewProcessorService(os.Getenv("IMAGE_PROCESSOR"))
+	// Face-aware cropping uses the built-in pico cascade, or the cascade
+	// file FACE_CASCADE names; without one crops follow the saliency map alone.
+	cascade, err := imageops.DefaultCascade()
+	if cascadePath := os.Getenv("FACE_CASCADE"); cascadePath != "" {
+		cascade, err = imageops.LoadCascade(cascadePath)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to load face cascade: %v", err)
+	} else {
+		imageops.SetFaceCascade(cascade)
+	}
 	weatherClient := weather.NewClient()
 	calendarClient := gcalendar.NewClient()
 	// Initialize Renderer (HTML/CSS → image via headless Chrome)
 	// Chrome is launched lazily on first render request to save memory.
-	rendererService, err := service.NewRendererService()
+	// Hosts without it get the built-in layouts drawn natively. Up to
+	// RENDERER_POOL_SIZE frames render at once, the rest queue.
+	rendererPoolSize := service.DefaultRendererPoolSize
+	if v, err := strconv.Atoi(os.Getenv("RENDERER_POOL_SIZE")); err == nil && v > 0 {
+		rendererPoolSize = v
+	}
+	rendererService, err := service.NewRendererService(rendererPoolSize)
 	if err != nil {
 		log.Fatalf("Failed to initialize renderer: %v", err)
 	}
+	// Initialize Widget Registry (date, weather, calendar and other overlay widgets)
+	widgetRegistry := service.NewWidgetRegistry()
+	for _, w := range []service.Widget{
+		service.NewDateWidget(),
+		service.NewWeatherWidget(weatherClient),
+		service.NewCalendarWidget(calendarClient, googleCalendarClient),
+		service.NewAgendaWidget(calendarClient, googleCalendarClient),
+		service.NewForecastWidget(weatherClient),
+	} {
+		if err := widgetRegistry.Register(w); err != nil {
+			log.Fatalf("Failed to register widget: %v", err)
+		}
+	}
 	// Initialize Synology Photos Service
 	synologyService := service.NewSynologyService(database, settingsService)
 	// Initialize Immich Service
 	immichService := service.NewImmichService(database, settingsService)
 	// Initialize AI Generation Service
 	aiGenerationService := service.NewAIGenerationService(settingsService)
+	// Initialize Device Assignment Service
+	assignmentService := service.NewAssignmentService(database)
+	// Initialize Shuffle Service (per-device rotation state)
+	shuffleService := service.NewShuffleService(database)
+	// Initialize Schedule Service (per-device playlists)
+	scheduleService := service.NewScheduleService(database)
+	// Initialize Mix Service (per-device source weights)
+	mixService := service.NewMixService(database)
+	// Initialize Layout Template Service (user-defined HTML layouts)
+	layoutTemplateService := service.NewLayoutTemplateService(database, widgetRegistry)
 
 	// Initialize Picker Service
 	// dataDir already set from migration logic above
@@ -180,20 +222,43 @@ func main() {
 	cleanupTempThumbnails(dataDir)
 
 	pickerService := service.NewPickerService(googleClient, database, dataDir)
+	go pickerService.BackfillCaptureTimes()
+
+	// Initialize Analyzer Service (perceptual hashes and quality scores, computed in the background)
+	analyzerService := service.NewAnalyzerService(service.AnalyzerServiceDeps{
+		DB:       database,
+		Synology: synologyService,
+		Immich:   immichService,
+		Settings: settingsService,
+		DataDir:  dataDir,
+	})
+	go analyzerService.Run()
+
+	// Initialize Render Cache (processed frames, bounded by RENDER_CACHE_MB)
+	renderCacheMB := int64(256)
+	if v, err := strconv.ParseInt(os.Getenv("RENDER_CACHE_MB"), 10, 64); err == nil && v > 0 {
+		renderCacheMB = v
+	}
+	renderCache := service.NewRenderCache(filepath.Join(dataDir, "render_cache"), renderCacheMB<<20)
 
 	// Initialize PhotoFrame Client
 	photoframeClient := photoframe.NewClient()
 
 	// Initialize Device Service
 	deviceService := service.NewDeviceService(service.DeviceServiceDeps{
-		DB:             database,
-		Settings:       settingsService,
-		Processor:      processorService,
-		Renderer:       rendererService,
-		Weather:        weatherClient,
-		Calendar:       calendarClient,
-		CalendarGoogle: googleCalendarClient,
-		PFClient:       photoframeClient,
+		DB:        database,
+		Settings:  settingsService,
+		Processor: processorService,
+		Renderer:  rendererService,
+		Templates: layoutTemplateService,
+		Widgets:   widgetRegistry,
+		PFClient:  photoframeClient,
+	})
+	// Initialize Refresh Service (per-device wake-up policy)
+	refreshService := service.NewRefreshService(service.RefreshServiceDeps{
+		DB:       database,
+		Widgets:  widgetRegistry,
+		PFClient: photoframeClient,
 	})
 	deviceHandler := handler.NewDeviceHandler(deviceService, synologyService, immichService, authService, settingsService, database)
 
@@ -214,23 +279,37 @@ func main() {
 	googleHandler := handler.NewGoogleHandler(googleClient, googleCalendarClient, pickerService, database, dataDir)
 	sh := handler.NewSynologyHandler(synologyService)
 	imh := handler.NewImmichHandler(immichService)
-	gh := handler.NewGalleryHandler(database, synologyService, immichService, dataDir)
+	gh := handler.NewGalleryHandler(database, synologyService, immichService, analyzerService, dataDir)
 	ih := handler.NewImageHandler(handler.ImageHandlerDeps{
-		Settings:       settingsService,
-		Renderer:       rendererService,
-		Processor:      processorService,
-		Google:         googleClient,
-		CalendarGoogle: googleCalendarClient,
-		Synology:       synologyService,
-		Immich:         immichService,
-		AIGen:          aiGenerationService,
-		Weather:        weatherClient,
-		Calendar:       calendarClient,
-		DB:             database,
-		DataDir:        dataDir,
+		Settings:    settingsService,
+		Renderer:    rendererService,
+		Processor:   processorService,
+		Google:      googleClient,
+		Synology:    synologyService,
+		Immich:      immichService,
+		AIGen:       aiGenerationService,
+		Assignments: assignmentService,
+		Shuffle:     shuffleService,
+		Schedules:   scheduleService,
+		Mix:         mixService,
+		Templates:   layoutTemplateService,
+		RenderCache: renderCache,
+		Refresh:     refreshService,
+		Widgets:     widgetRegistry,
+		DB:          database,
+		DataDir:     dataDir,
 	})
 	ch := handler.NewCalendarHandler(googleCalendarClient, calendarClient)
 	ah := handler.NewAuthHandler(authService)
+	asgh := handler.NewAssignmentHandler(assignmentService, database)
+	sch := handler.NewScheduleHandler(scheduleService, database)
+	mxh := handler.NewMixHandler(mixService, database)
+	rfh := handler.NewRefreshHandler(refreshService, database)
+	plh := handler.NewPaletteHandler(deviceService, database)
+	clh := handler.NewCollageHandler(deviceService, database)
+	rdh := handler.NewRendererHandler(deviceService, rendererService, database)
+	lth := handler.NewLayoutTemplateHandler(layoutTemplateService, rendererService, widgetRegistry, database)
+	wdh := handler.NewWidgetHandler(deviceService, widgetRegistry, database)
 
 	// Echo instance
 	e := echo.New()
@@ -284,6 +363,44 @@ func main() {
 	protectedApi.DELETE("/devices/:id", deviceHandler.DeleteDevice)
 	protectedApi.POST("/devices/:id/push", deviceHandler.PushToDevice)
 	protectedApi.POST("/devices/:id/configure-source", deviceHandler.ConfigureDeviceSource)
+	protectedApi.GET("/devices/:id/preview", ih.PreviewFrame)
+
+	// Device Photo/Album Assignments (Protected)
+	protectedApi.GET("/devices/:id/assignments", asgh.GetAssignments)
+	protectedApi.POST("/devices/:id/assignments/photos", asgh.AssignPhotos)
+	protectedApi.DELETE("/devices/:id/assignments/photos", asgh.UnassignPhotos)
+	protectedApi.POST("/devices/:id/assignments/albums", asgh.AssignAlbum)
+	protectedApi.DELETE("/devices/:id/assignments/albums", asgh.UnassignAlbum)
+	protectedApi.GET("/devices/:id/schedules", sch.ListSchedules)
+	protectedApi.POST("/devices/:id/schedules", sch.CreateSchedule)
+	protectedApi.GET("/devices/:id/schedules/active", sch.GetActiveSchedule)
+	protectedApi.PUT("/devices/:id/schedules/:scheduleId", sch.UpdateSchedule)
+	protectedApi.DELETE("/devices/:id/schedules/:scheduleId", sch.DeleteSchedule)
+	protectedApi.GET("/devices/:id/source-weights", mxh.GetSourceWeights)
+	protectedApi.PUT("/devices/:id/source-weights", mxh.SetSourceWeights)
+	protectedApi.GET("/devices/:id/refresh-policy", rfh.GetRefreshPolicy)
+	protectedApi.PUT("/devices/:id/refresh-policy", rfh.UpdateRefreshPolicy)
+	protectedApi.POST("/devices/:id/refresh-policy/push", rfh.PushRefreshPolicy)
+	protectedApi.GET("/palettes", plh.ListPresets)
+	protectedApi.GET("/devices/:id/palette", plh.GetDevicePalette)
+	protectedApi.PUT("/devices/:id/palette", plh.SetDevicePalette)
+	protectedApi.DELETE("/devices/:id/palette", plh.ClearDevicePalette)
+	protectedApi.GET("/devices/:id/collage", clh.GetCollage)
+	protectedApi.PUT("/devices/:id/collage", clh.UpdateCollage)
+	protectedApi.GET("/renderer", rdh.GetStatus)
+	protectedApi.GET("/devices/:id/renderer", rdh.GetDeviceRenderer)
+	protectedApi.PUT("/devices/:id/renderer", rdh.SetDeviceRenderer)
+	protectedApi.GET("/widgets", wdh.ListWidgets)
+	protectedApi.GET("/devices/:id/widgets", wdh.GetDeviceWidgets)
+	protectedApi.PUT("/devices/:id/widgets", wdh.SetDeviceWidgets)
+	protectedApi.GET("/devices/:id/layout-template", lth.GetDeviceTemplate)
+	protectedApi.PUT("/devices/:id/layout-template", lth.SetDeviceTemplate)
+	protectedApi.GET("/layout-templates", lth.ListTemplates)
+	protectedApi.POST("/layout-templates", lth.CreateTemplate)
+	protectedApi.POST("/layout-templates/preview", lth.PreviewTemplate)
+	protectedApi.GET("/layout-templates/:id", lth.GetTemplate)
+	protectedApi.PUT("/layout-templates/:id", lth.UpdateTemplate)
+	protectedApi.DELETE("/layout-templates/:id", lth.DeleteTemplate)
 
 	// Device Tokens (Protected)
 	protectedApi.POST("/auth/tokens", ah.GenerateDeviceToken)
@@ -298,6 +415,12 @@ func main() {
 	protectedApi.GET("/gallery/thumbnail/:id", gh.GetThumbnail)
 	protectedApi.DELETE("/gallery/photos/:id", gh.DeletePhoto)
 	protectedApi.DELETE("/gallery/photos", gh.DeletePhotos)
+	protectedApi.PUT("/gallery/photos/preferences", gh.UpdatePreferences)
+	protectedApi.GET("/gallery/photos/:id/framing", gh.GetFraming)
+	protectedApi.PUT("/gallery/photos/:id/framing", gh.UpdateFraming)
+	protectedApi.GET("/gallery/photos/:id/framing/preview", ih.PreviewCrop)
+	protectedApi.GET("/gallery/duplicates", gh.ListDuplicates)
+	protectedApi.POST("/gallery/duplicates/:id/keep", gh.KeepDuplicate)
 	// URL Proxy
 	protectedApi.POST("/gallery/urls", gh.CreateURLSource)
 	protectedApi.GET("/gallery/urls", gh.ListURLSources)
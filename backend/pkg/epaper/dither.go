@@ -0,0 +1,143 @@
+package epaper
+
+import (
+	"image"
+	"math"
+)
+
+// ditherKernel spreads the quantization error of a pixel to its unprocessed
+// neighbors. Weights are relative to divisor.
+type ditherKernel struct {
+	divisor float64
+	taps    []ditherTap
+}
+
+type ditherTap struct {
+	dx, dy int
+	weight float64
+}
+
+var ditherKernels = map[string]*ditherKernel{
+	"none": nil,
+	"floyd-steinberg": {16, []ditherTap{
+		{1, 0, 7},
+		{-1, 1, 3}, {0, 1, 5}, {1, 1, 1},
+	}},
+	"atkinson": {8, []ditherTap{
+		{1, 0, 1}, {2, 0, 1},
+		{-1, 1, 1}, {0, 1, 1}, {1, 1, 1},
+		{0, 2, 1},
+	}},
+	"burkes": {32, []ditherTap{
+		{1, 0, 8}, {2, 0, 4},
+		{-2, 1, 2}, {-1, 1, 4}, {0, 1, 8}, {1, 1, 4}, {2, 1, 2},
+	}},
+	"sierra": {32, []ditherTap{
+		{1, 0, 5}, {2, 0, 3},
+		{-2, 1, 2}, {-1, 1, 4}, {0, 1, 5}, {1, 1, 4}, {2, 1, 2},
+		{-1, 2, 2}, {0, 2, 3}, {1, 2, 2},
+	}},
+	"sierra-lite": {4, []ditherTap{
+		{1, 0, 2},
+		{-1, 1, 1}, {0, 1, 1},
+	}},
+	"stucki": {42, []ditherTap{
+		{1, 0, 8}, {2, 0, 4},
+		{-2, 1, 2}, {-1, 1, 4}, {0, 1, 8}, {1, 1, 4}, {2, 1, 2},
+		{-2, 2, 1}, {-1, 2, 2}, {0, 2, 4}, {1, 2, 2}, {2, 2, 1},
+	}},
+	"jarvis-judice-ninke": {48, []ditherTap{
+		{1, 0, 7}, {2, 0, 5},
+		{-2, 1, 3}, {-1, 1, 5}, {0, 1, 7}, {1, 1, 5}, {2, 1, 3},
+		{-2, 2, 1}, {-1, 2, 3}, {0, 2, 5}, {1, 2, 3}, {2, 2, 1},
+	}},
+}
+
+// DitherAlgorithms lists the supported error diffusion kernels.
+func DitherAlgorithms() []string {
+	return []string{"floyd-steinberg", "atkinson", "burkes", "sierra", "sierra-lite", "stucki", "jarvis-judice-ninke", "none"}
+}
+
+// quantizer finds the perceived palette color closest to a pixel.
+type quantizer struct {
+	method    string
+	perceived [][3]float64
+	labs      []lab
+}
+
+func newQuantizer(palette Palette, method string) *quantizer {
+	q := &quantizer{method: method}
+	for _, c := range palette.Perceived {
+		rgb := [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+		q.perceived = append(q.perceived, rgb)
+		q.labs = append(q.labs, rgbToLab(rgb[0], rgb[1], rgb[2]))
+	}
+	return q
+}
+
+func (q *quantizer) nearest(r, g, b float64) int {
+	best, bestDist := 0, math.MaxFloat64
+	if q.method == ColorMethodLab {
+		c := rgbToLab(r, g, b)
+		for i, p := range q.labs {
+			dl, da, db := c.L-p.L, c.A-p.A, c.B-p.B
+			if d := dl*dl + da*da + db*db; d < bestDist {
+				best, bestDist = i, d
+			}
+		}
+		return best
+	}
+	for i, p := range q.perceived {
+		dr, dg, db := r-p[0], g-p[1], b-p[2]
+		if d := dr*dr + dg*dg + db*db; d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+// dither maps every pixel to a palette index, diffusing the difference to the
+// perceived color onto the neighbors. Rows alternate direction (serpentine)
+// to avoid the diagonal artifacts of a plain raster scan.
+func dither(p *pixels, palette Palette, method, algorithm string) *image.Paletted {
+	out := image.NewPaletted(image.Rect(0, 0, p.w, p.h), palette.ColorPalette())
+	q := newQuantizer(palette, method)
+	kernel := ditherKernels[algorithm]
+
+	for y := 0; y < p.h; y++ {
+		reverse := y%2 == 1
+		for i := 0; i < p.w; i++ {
+			x := i
+			if reverse {
+				x = p.w - 1 - i
+			}
+			off := (y*p.w + x) * 3
+			r, g, b := clamp255(p.px[off]), clamp255(p.px[off+1]), clamp255(p.px[off+2])
+
+			idx := q.nearest(r, g, b)
+			out.Pix[y*out.Stride+x] = uint8(idx)
+			if kernel == nil {
+				continue
+			}
+
+			c := q.perceived[idx]
+			er, eg, eb := r-c[0], g-c[1], b-c[2]
+			for _, tap := range kernel.taps {
+				dx := tap.dx
+				if reverse {
+					dx = -dx
+				}
+				nx, ny := x+dx, y+tap.dy
+				if nx < 0 || nx >= p.w || ny >= p.h {
+					continue
+				}
+				w := tap.weight / kernel.divisor
+				n := (ny*p.w + nx) * 3
+				p.px[n] += er * w
+				p.px[n+1] += eg * w
+				p.px[n+2] += eb * w
+			}
+		}
+	}
+	return out
+}
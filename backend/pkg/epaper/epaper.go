@@ -0,0 +1,113 @@
+// Package epaper converts images for color e-paper panels: tone mapping,
+// palette quantization and error diffusion dithering, producing the same
+// output as the epaper-image-convert CLI without leaving the process.
+package epaper
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
+)
+
+// Result holds the converted frame.
+type Result struct {
+	// Image is the frame for the panel, in theoretical palette colors and
+	// native panel orientation.
+	Image *image.Paletted
+	// Preview shows how the frame looks on the panel: the dithered result in
+	// perceived colors, at half size and in the input's orientation.
+	Preview image.Image
+}
+
+// Process runs the conversion pipeline on img.
+//
+// When the panel's orientation differs from the image's (e.g. a portrait
+// layout on a landscape panel) the image is rotated 90° clockwise, then
+// resized to cover the panel.
+func Process(img image.Image, opts Options) *Result {
+	src := img
+	rotated := false
+	if opts.Width > 0 && opts.Height > 0 {
+		b := img.Bounds()
+		if (b.Dy() > b.Dx()) != (opts.Height > opts.Width) {
+			src = rotateClockwise(img)
+			rotated = true
+		}
+		if sb := src.Bounds(); sb.Dx() != opts.Width || sb.Dy() != opts.Height {
+			src = imageops.ResizeToFill(src, opts.Width, opts.Height)
+		}
+	}
+
+	p := toPixels(src)
+	applyExposure(p, opts.Exposure)
+	applySaturation(p, opts.Saturation)
+	if opts.ToneMode == ToneModeSCurve {
+		applySCurve(p, opts.Strength, opts.ShadowBoost, opts.HighlightCompress, opts.Midpoint)
+	} else {
+		applyContrast(p, opts.Contrast)
+	}
+	if opts.CompressDynamicRange {
+		compressDynamicRange(p, opts.Palette)
+	}
+
+	out := dither(p, opts.Palette, opts.ColorMethod, opts.DitherAlgorithm)
+
+	var preview image.Image = perceivedPreview(out, opts.Palette)
+	if rotated {
+		preview = rotateCounterClockwise(preview)
+	}
+	return &Result{Image: out, Preview: preview}
+}
+
+func toPixels(img image.Image) *pixels {
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+
+	p := &pixels{w: b.Dx(), h: b.Dy(), px: make([]float64, b.Dx()*b.Dy()*3)}
+	for i, j := 0, 0; i < len(rgba.Pix); i, j = i+4, j+3 {
+		p.px[j] = float64(rgba.Pix[i])
+		p.px[j+1] = float64(rgba.Pix[i+1])
+		p.px[j+2] = float64(rgba.Pix[i+2])
+	}
+	return p
+}
+
+// perceivedPreview renders the dithered frame in perceived colors, averaging
+// 2x2 blocks so the dither pattern blends the way it does from a distance.
+func perceivedPreview(frame *image.Paletted, palette Palette) *image.RGBA {
+	w, h := frame.Rect.Dx()/2, frame.Rect.Dy()/2
+	if w == 0 || h == 0 {
+		w, h = frame.Rect.Dx(), frame.Rect.Dy()
+	}
+	sx, sy := frame.Rect.Dx()/w, frame.Rect.Dy()/h
+
+	preview := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var r, g, b int
+			for dy := 0; dy < sy; dy++ {
+				for dx := 0; dx < sx; dx++ {
+					c := palette.Perceived[frame.Pix[(y*sy+dy)*frame.Stride+x*sx+dx]]
+					r, g, b = r+c.R, g+c.G, b+c.B
+				}
+			}
+			n := sx * sy
+			preview.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), 255})
+		}
+	}
+	return preview
+}
+
+// rotateClockwise turns img a quarter turn clockwise. The EXIF orientations
+// 6 and 8 are the same quarter turns, done on the pixel buffers.
+func rotateClockwise(img image.Image) image.Image {
+	return imageops.Orient(img, 6)
+}
+
+// rotateCounterClockwise turns img a quarter turn counter-clockwise.
+func rotateCounterClockwise(img image.Image) image.Image {
+	return imageops.Orient(img, 8)
+}
@@ -0,0 +1,204 @@
+package epaper
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128, 255})
+		}
+	}
+	return img
+}
+
+func TestParseOptions(t *testing.T) {
+	opts, err := ParseOptions(map[string]string{
+		"dimension":              "800x480",
+		"exposure":               "1.2",
+		"tone-mode":              "contrast",
+		"dither-algorithm":       "stucki",
+		"compress-dynamic-range": "",
+		"palette":                `{"theoretical": {"black": {"r": 0, "g": 0, "b": 0}, "white": {"r": 255, "g": 255, "b": 255}}, "perceived": {"white": {"r": 200, "g": 200, "b": 190}}}`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 800, opts.Width)
+	assert.Equal(t, 480, opts.Height)
+	assert.Equal(t, 1.2, opts.Exposure)
+	assert.Equal(t, ToneModeContrast, opts.ToneMode)
+	assert.Equal(t, "stucki", opts.DitherAlgorithm)
+	assert.True(t, opts.CompressDynamicRange)
+	assert.Equal(t, Color{200, 200, 190}, opts.Palette.Perceived[1])
+	// Inks without a perceived color fall back to the theoretical one
+	assert.Equal(t, Color{0, 0, 0}, opts.Palette.Perceived[0])
+
+	// Bad settings fall back to the defaults instead of failing the frame
+	opts, err = ParseOptions(map[string]string{"dither-algorithm": "bayer", "scurve-midpoint": "0", "exposure": "bright"})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultOptions().DitherAlgorithm, opts.DitherAlgorithm)
+	assert.Equal(t, 0.5, opts.Midpoint)
+	assert.Equal(t, 1.0, opts.Exposure)
+	_, err = ParseOptions(map[string]string{"dimension": "800"})
+	assert.Error(t, err)
+}
+
+func TestSCurve(t *testing.T) {
+	assert.InDelta(t, 0, sCurve(0, 0.9, 0, 1.5, 0.5), 1e-9)
+	assert.InDelta(t, 0.5, sCurve(0.5, 0.9, 0, 1.5, 0.5), 1e-9)
+	assert.InDelta(t, 1, sCurve(1, 0.9, 0, 1.5, 0.5), 1e-9)
+	// Highlights are compressed, shadows lifted
+	assert.Less(t, sCurve(0.75, 0.9, 0, 1.5, 0.5), 0.75)
+	assert.Greater(t, sCurve(0.25, 0.9, 1, 0, 0.5), 0.25)
+}
+
+func TestLabRoundTrip(t *testing.T) {
+	for _, c := range []Color{{0, 0, 0}, {255, 255, 255}, {205, 202, 0}, {5, 64, 158}} {
+		r, g, b := labToRGB(rgbToLab(float64(c.R), float64(c.G), float64(c.B)))
+		assert.InDelta(t, c.R, r, 0.5)
+		assert.InDelta(t, c.G, g, 0.5)
+		assert.InDelta(t, c.B, b, 0.5)
+	}
+}
+
+func TestProcess_OnlyPaletteColors(t *testing.T) {
+	for _, algorithm := range DitherAlgorithms() {
+		for _, method := range []string{ColorMethodRGB, ColorMethodLab} {
+			opts := DefaultOptions()
+			opts.DitherAlgorithm = algorithm
+			opts.ColorMethod = method
+			opts.CompressDynamicRange = true
+
+			result := Process(gradient(40, 24), opts)
+			for _, idx := range result.Image.Pix {
+				assert.Less(t, int(idx), len(opts.Palette.Names), "%s/%s", algorithm, method)
+			}
+		}
+	}
+}
+
+func TestProcess_SolidColorsMapToInks(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Saturation = 1
+	opts.ToneMode = ToneModeContrast
+
+	for i, c := range opts.Palette.Perceived {
+		img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+		for p := 0; p < len(img.Pix); p += 4 {
+			img.Pix[p], img.Pix[p+1], img.Pix[p+2], img.Pix[p+3] = uint8(c.R), uint8(c.G), uint8(c.B), 255
+		}
+		result := Process(img, opts)
+		for _, idx := range result.Image.Pix {
+			require.Equal(t, uint8(i), idx, opts.Palette.Names[i])
+		}
+	}
+}
+
+func TestProcess_RotatesToPanelOrientation(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Width, opts.Height = 80, 48
+
+	// Portrait layout on a landscape panel
+	result := Process(gradient(48, 80), opts)
+	assert.Equal(t, image.Rect(0, 0, 80, 48), result.Image.Bounds())
+	// The preview keeps the layout's orientation
+	assert.Equal(t, image.Rect(0, 0, 24, 40), result.Preview.Bounds())
+
+	result = Process(gradient(40, 24), opts)
+	assert.Equal(t, image.Rect(0, 0, 80, 48), result.Image.Bounds())
+	assert.Equal(t, image.Rect(0, 0, 40, 24), result.Preview.Bounds())
+}
+
+func TestRotateClockwise(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+
+	rotated := rotateClockwise(img)
+	assert.Equal(t, image.Rect(0, 0, 2, 3), rotated.Bounds())
+	// Top-left moves to top-right
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, rotated.At(1, 0))
+	assert.Equal(t, img.At(0, 0), rotateCounterClockwise(rotated).At(0, 0))
+}
+
+func TestParsePalette_KeepsOrderAndArbitraryInks(t *testing.T) {
+	p, err := ParsePalette(`{"perceived": {"white": {"r": 200, "g": 200, "b": 200}, "light_gray": {"r": 140, "g": 140, "b": 140}, "dark_gray": {"r": 70, "g": 70, "b": 70}, "black": {"r": 10, "g": 10, "b": 10}}}`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"white", "light_gray", "dark_gray", "black"}, p.Names)
+	assert.Equal(t, Color{170, 170, 170}, p.Theoretical[1])
+	assert.False(t, p.IsSpectra6())
+
+	p, err = ParsePalette(`{"perceived": {"black": {"r": 0, "g": 0, "b": 0}, "sepia": {"r": 112, "g": 66, "b": 20}}}`)
+	require.NoError(t, err)
+	assert.Equal(t, Color{112, 66, 20}, p.Theoretical[1])
+
+	_, err = ParsePalette(`{"perceived": {"black": {"r": 0, "g": 0, "b": 0}}}`)
+	assert.Error(t, err)
+}
+
+func TestProcess_Grayscale(t *testing.T) {
+	p, err := ParsePalette(`{"theoretical": {"black": {"r": 0, "g": 0, "b": 0}, "dark_gray": {"r": 85, "g": 85, "b": 85}, "light_gray": {"r": 170, "g": 170, "b": 170}, "white": {"r": 255, "g": 255, "b": 255}}}`)
+	require.NoError(t, err)
+	opts := DefaultOptions()
+	opts.Palette = p
+
+	result := Process(gradient(40, 24), opts)
+	assert.Len(t, result.Image.Palette, 4)
+	for _, idx := range result.Image.Pix {
+		assert.Less(t, int(idx), 4)
+	}
+}
+
+func TestEncodeFrame_PackedFormats(t *testing.T) {
+	palette := DefaultPalette()
+	frame := image.NewPaletted(image.Rect(0, 0, 3, 2), palette.ColorPalette())
+	// black white yellow / red blue green
+	copy(frame.Pix, []uint8{0, 1, 2, 3, 4, 5})
+
+	packed, err := EncodeFrame(frame, palette, FormatPacked4)
+	require.NoError(t, err)
+	// Spectra 6 skips panel index 4; odd rows are padded to a whole byte
+	assert.Equal(t, []byte{0x01, 0x20, 0x35, 0x60}, packed)
+
+	bmp, err := EncodeFrame(frame, palette, FormatBMP)
+	require.NoError(t, err)
+	assert.Equal(t, "BM", string(bmp[:2]))
+	assert.Equal(t, len(bmp), int(binary.LittleEndian.Uint32(bmp[2:6])))
+	offset := binary.LittleEndian.Uint32(bmp[10:14])
+	// Bottom-up: the last row comes first, rows padded to 4 bytes
+	assert.Equal(t, []byte{0x35, 0x60, 0, 0, 0x01, 0x20, 0, 0}, bmp[offset:])
+
+	// Full-color input is matched back to the palette
+	assert.Equal(t, frame.Pix, Quantize(image.Image(toRGBA(frame)), palette).Pix)
+}
+
+func TestFormatFromAccept(t *testing.T) {
+	format, ok := FormatFromAccept("image/png;q=0.5, application/vnd.photoframe.epd-4bpp")
+	assert.True(t, ok)
+	assert.Equal(t, FormatPNG, format)
+
+	format, ok = FormatFromAccept("application/vnd.photoframe.epd-4bpp, */*")
+	assert.True(t, ok)
+	assert.Equal(t, FormatPacked4, format)
+
+	_, ok = FormatFromAccept("*/*")
+	assert.False(t, ok)
+	assert.Error(t, ValidateFormat("jpeg"))
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			out.Set(x, y, img.At(x, y))
+		}
+	}
+	return out
+}
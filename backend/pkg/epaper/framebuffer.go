@@ -0,0 +1,218 @@
+package epaper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"mime"
+	"strings"
+)
+
+// Frame formats. PNG is decoded by the device; the packed formats carry one
+// panel index per pixel and can be written to the panel as they arrive.
+const (
+	// FormatPNG is an indexed PNG in theoretical colors.
+	FormatPNG = "png"
+	// FormatPacked4 is raw 4-bit panel indexes in panel scan order: rows top
+	// to bottom, two pixels per byte with the left pixel in the high nibble,
+	// each row padded to a whole byte.
+	FormatPacked4 = "4bpp"
+	// FormatBMP is a 4-bit indexed, bottom-up BMP whose color table maps
+	// panel indexes to theoretical colors.
+	FormatBMP = "bmp"
+)
+
+var formatContentTypes = map[string]string{
+	FormatPNG:     "image/png",
+	FormatPacked4: "application/vnd.photoframe.epd-4bpp",
+	FormatBMP:     "image/bmp",
+}
+
+// ContentType returns the MIME type of a frame format.
+func ContentType(format string) string {
+	return formatContentTypes[format]
+}
+
+// ValidateFormat accepts empty (PNG) or one of the frame formats.
+func ValidateFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	if _, ok := formatContentTypes[format]; !ok {
+		return fmt.Errorf("unsupported frame format: %s", format)
+	}
+	return nil
+}
+
+// FormatFromAccept returns the first frame format listed in an Accept header,
+// ignoring quality values, and false when none is listed.
+func FormatFromAccept(accept string) (string, bool) {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		for format, contentType := range formatContentTypes {
+			if mediaType == contentType {
+				return format, true
+			}
+		}
+	}
+	return "", false
+}
+
+// PanelIndexes returns the controller index of each ink of the palette.
+// Spectra 6 controllers keep index 4 unused (black, white, yellow, red, -,
+// blue, green); other panels use the palette order.
+func PanelIndexes(palette Palette) []uint8 {
+	indexes := make([]uint8, len(palette.Names))
+	if palette.IsSpectra6() {
+		spectra6 := map[string]uint8{"black": 0, "white": 1, "yellow": 2, "red": 3, "blue": 5, "green": 6}
+		for i, name := range palette.Names {
+			indexes[i] = spectra6[name]
+		}
+		return indexes
+	}
+	for i := range indexes {
+		indexes[i] = uint8(i)
+	}
+	return indexes
+}
+
+// Quantize maps an already converted frame back to palette entries. Pixels
+// are matched to the closest theoretical color, so frames from either engine
+// (indexed or full-color PNG) can be packed.
+func Quantize(img image.Image, palette Palette) *image.Paletted {
+	if p, ok := img.(*image.Paletted); ok && len(p.Palette) == len(palette.Theoretical) && p.Rect.Min == (image.Point{}) {
+		same := true
+		for i, c := range palette.ColorPalette() {
+			same = same && p.Palette[i] == c
+		}
+		if same {
+			return p
+		}
+	}
+
+	b := img.Bounds()
+	out := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), palette.ColorPalette())
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			out.Pix[y*out.Stride+x] = uint8(out.Palette.Index(img.At(b.Min.X+x, b.Min.Y+y)))
+		}
+	}
+	return out
+}
+
+// EncodeFrame encodes a quantized frame in the given format.
+func EncodeFrame(frame *image.Paletted, palette Palette, format string) ([]byte, error) {
+	switch format {
+	case FormatPNG, "":
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, frame); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case FormatPacked4:
+		return packNibbles(frame, palette)
+	case FormatBMP:
+		return encodeBMP4(frame, palette)
+	default:
+		return nil, fmt.Errorf("unsupported frame format: %s", format)
+	}
+}
+
+func nibbleIndexes(palette Palette) ([]uint8, error) {
+	indexes := PanelIndexes(palette)
+	for _, idx := range indexes {
+		if idx > 15 {
+			return nil, fmt.Errorf("palette with %d inks does not fit 4-bit indexes", len(indexes))
+		}
+	}
+	return indexes, nil
+}
+
+func packNibbles(frame *image.Paletted, palette Palette) ([]byte, error) {
+	indexes, err := nibbleIndexes(palette)
+	if err != nil {
+		return nil, err
+	}
+	w, h := frame.Rect.Dx(), frame.Rect.Dy()
+	rowBytes := (w + 1) / 2
+	out := make([]byte, rowBytes*h)
+	for y := 0; y < h; y++ {
+		row := out[y*rowBytes:]
+		for x := 0; x < w; x++ {
+			idx := indexes[frame.Pix[y*frame.Stride+x]]
+			if x%2 == 0 {
+				row[x/2] = idx << 4
+			} else {
+				row[x/2] |= idx
+			}
+		}
+	}
+	return out, nil
+}
+
+func encodeBMP4(frame *image.Paletted, palette Palette) ([]byte, error) {
+	indexes, err := nibbleIndexes(palette)
+	if err != nil {
+		return nil, err
+	}
+	w, h := frame.Rect.Dx(), frame.Rect.Dy()
+	rowBytes := ((w+1)/2 + 3) &^ 3
+	const headerSize = 14 + 40
+	const colorTableSize = 16 * 4
+	pixelOffset := headerSize + colorTableSize
+	fileSize := pixelOffset + rowBytes*h
+
+	buf := bytes.NewBuffer(make([]byte, 0, fileSize))
+	le := binary.LittleEndian
+
+	// BITMAPFILEHEADER
+	buf.WriteString("BM")
+	binary.Write(buf, le, uint32(fileSize))
+	binary.Write(buf, le, uint32(0))
+	binary.Write(buf, le, uint32(pixelOffset))
+
+	// BITMAPINFOHEADER
+	binary.Write(buf, le, uint32(40))
+	binary.Write(buf, le, int32(w))
+	binary.Write(buf, le, int32(h)) // positive height: bottom-up rows
+	binary.Write(buf, le, uint16(1))
+	binary.Write(buf, le, uint16(4))
+	binary.Write(buf, le, uint32(0)) // BI_RGB
+	binary.Write(buf, le, uint32(rowBytes*h))
+	binary.Write(buf, le, int32(2835)) // 72 DPI
+	binary.Write(buf, le, int32(2835))
+	binary.Write(buf, le, uint32(16))
+	binary.Write(buf, le, uint32(0))
+
+	// Color table, indexed by panel index (BGRA)
+	var table [16][4]byte
+	for i, idx := range indexes {
+		c := palette.Theoretical[i]
+		table[idx] = [4]byte{byte(c.B), byte(c.G), byte(c.R), 0}
+	}
+	for _, entry := range table {
+		buf.Write(entry[:])
+	}
+
+	row := make([]byte, rowBytes)
+	for y := h - 1; y >= 0; y-- {
+		for i := range row {
+			row[i] = 0
+		}
+		for x := 0; x < w; x++ {
+			idx := indexes[frame.Pix[y*frame.Stride+x]]
+			if x%2 == 0 {
+				row[x/2] = idx << 4
+			} else {
+				row[x/2] |= idx
+			}
+		}
+		buf.Write(row)
+	}
+	return buf.Bytes(), nil
+}
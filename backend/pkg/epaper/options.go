@@ -0,0 +1,133 @@
+package epaper
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const (
+	ToneModeContrast = "contrast"
+	ToneModeSCurve   = "scurve"
+
+	ColorMethodRGB = "rgb"
+	ColorMethodLab = "lab"
+)
+
+// Options mirrors the epaper-image-convert CLI flags.
+type Options struct {
+	Width  int // Target panel resolution, 0 keeps the input size
+	Height int
+
+	Exposure   float64
+	Saturation float64
+	ToneMode   string
+	Contrast   float64
+
+	// S-curve tone mapping
+	Strength          float64
+	ShadowBoost       float64
+	HighlightCompress float64
+	Midpoint          float64
+
+	CompressDynamicRange bool
+	ColorMethod          string
+	DitherAlgorithm      string
+	Palette              Palette
+}
+
+// DefaultOptions matches the CLI's defaults.
+func DefaultOptions() Options {
+	return Options{
+		Exposure:          1.0,
+		Saturation:        1.3,
+		ToneMode:          ToneModeSCurve,
+		Contrast:          1.0,
+		Strength:          0.9,
+		ShadowBoost:       0.0,
+		HighlightCompress: 1.5,
+		Midpoint:          0.5,
+		ColorMethod:       ColorMethodRGB,
+		DitherAlgorithm:   "floyd-steinberg",
+		Palette:           DefaultPalette(),
+	}
+}
+
+// ParseOptions reads options in the CLI's flag form (as produced by
+// ProcessorService.MapProcessingSettings), e.g. {"dimension": "800x480",
+// "tone-mode": "scurve", "compress-dynamic-range": ""}. Unset options keep
+// their defaults, and so do invalid processing settings, which are logged
+// rather than failing the whole frame. Only an invalid dimension is an error.
+func ParseOptions(opts map[string]string) (Options, error) {
+	o := DefaultOptions()
+
+	floats := map[string]*float64{
+		"exposure":         &o.Exposure,
+		"saturation":       &o.Saturation,
+		"contrast":         &o.Contrast,
+		"scurve-strength":  &o.Strength,
+		"scurve-shadow":    &o.ShadowBoost,
+		"scurve-highlight": &o.HighlightCompress,
+		"scurve-midpoint":  &o.Midpoint,
+	}
+
+	for key, value := range opts {
+		switch key {
+		case "dimension":
+			w, h, ok := strings.Cut(value, "x")
+			var errW, errH error
+			o.Width, errW = strconv.Atoi(w)
+			o.Height, errH = strconv.Atoi(h)
+			if !ok || errW != nil || errH != nil || o.Width <= 0 || o.Height <= 0 {
+				return o, fmt.Errorf("invalid dimension: %s", value)
+			}
+		case "tone-mode":
+			if value != ToneModeContrast && value != ToneModeSCurve {
+				log.Printf("Invalid tone mode %q, using %s", value, o.ToneMode)
+				continue
+			}
+			o.ToneMode = value
+		case "color-method":
+			if value != ColorMethodRGB && value != ColorMethodLab {
+				log.Printf("Invalid color method %q, using %s", value, o.ColorMethod)
+				continue
+			}
+			o.ColorMethod = value
+		case "dither-algorithm":
+			if _, ok := ditherKernels[value]; !ok {
+				log.Printf("Unsupported dither algorithm %q, using %s", value, o.DitherAlgorithm)
+				continue
+			}
+			o.DitherAlgorithm = value
+		case "compress-dynamic-range":
+			o.CompressDynamicRange = value == "" || value == "true"
+		case "palette":
+			p, err := ParsePalette(value)
+			if err != nil {
+				log.Printf("Invalid palette, using the default: %v", err)
+				continue
+			}
+			o.Palette = p
+		default:
+			dst, ok := floats[key]
+			if !ok {
+				// Flags without a native equivalent are ignored
+				continue
+			}
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				log.Printf("Invalid %s %q, using %v", key, value, *dst)
+				continue
+			}
+			*dst = v
+		}
+	}
+
+	if o.Midpoint <= 0 || o.Midpoint >= 1 {
+		midpoint := DefaultOptions().Midpoint
+		log.Printf("scurve-midpoint must be between 0 and 1, using %v instead of %v", midpoint, o.Midpoint)
+		o.Midpoint = midpoint
+	}
+	return o, nil
+}
@@ -0,0 +1,264 @@
+package epaper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// Color is an sRGB palette entry, in the JSON form used by the device and the
+// epaper-image-convert CLI.
+type Color struct {
+	R int `json:"r"`
+	G int `json:"g"`
+	B int `json:"b"`
+}
+
+// Palette pairs the colors written to the output (Theoretical, what the
+// panel driver expects) with the colors the panel actually shows (Perceived,
+// measured from a real display). Matching and error diffusion use the
+// perceived colors so the dithered result looks right on the panel. Entries
+// are in the panel's index order.
+type Palette struct {
+	Names       []string
+	Theoretical []Color
+	Perceived   []Color
+}
+
+// spectra6Order is the order of the Spectra 6 inks in the output image.
+var spectra6Order = []string{"black", "white", "yellow", "red", "blue", "green"}
+
+// theoreticalColors are the driver values of well-known inks. Inks with other
+// names are written with their perceived color.
+var theoreticalColors = map[string]Color{
+	"black":      {0, 0, 0},
+	"white":      {255, 255, 255},
+	"yellow":     {255, 255, 0},
+	"red":        {255, 0, 0},
+	"blue":       {0, 0, 255},
+	"green":      {0, 255, 0},
+	"orange":     {255, 128, 0},
+	"dark_gray":  {85, 85, 85},
+	"gray":       {128, 128, 128},
+	"light_gray": {170, 170, 170},
+}
+
+// defaultPerceived is a typical Spectra 6 panel, used when the device doesn't
+// report its own calibration.
+var defaultPerceived = map[string]Color{
+	"black":  {2, 2, 2},
+	"white":  {190, 190, 190},
+	"yellow": {205, 202, 0},
+	"red":    {135, 19, 0},
+	"blue":   {5, 64, 158},
+	"green":  {39, 102, 60},
+}
+
+// TheoreticalColor returns the driver value of a well-known ink.
+func TheoreticalColor(name string) (Color, bool) {
+	c, ok := theoreticalColors[name]
+	return c, ok
+}
+
+// DefaultPalette returns the Spectra 6 palette with typical perceived colors.
+func DefaultPalette() Palette {
+	p := Palette{Names: spectra6Order}
+	for _, name := range spectra6Order {
+		p.Theoretical = append(p.Theoretical, theoreticalColors[name])
+		p.Perceived = append(p.Perceived, defaultPerceived[name])
+	}
+	return p
+}
+
+// IsSpectra6 reports whether the palette has exactly the Spectra 6 inks.
+func (p Palette) IsSpectra6() bool {
+	if len(p.Names) != len(spectra6Order) {
+		return false
+	}
+	for _, name := range spectra6Order {
+		found := false
+		for _, n := range p.Names {
+			found = found || n == name
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ParsePalette parses the CLI's palette option:
+// {"theoretical": {"black": {"r":0,"g":0,"b":0}, ...}, "perceived": {...}}.
+// The inks are those of either set, in "theoretical" order followed by inks
+// only listed in "perceived". Inks without a theoretical color use the well-known value for
+// their name, or their perceived color; inks without a perceived color use
+// the theoretical one.
+func ParsePalette(s string) (Palette, error) {
+	var raw struct {
+		Theoretical json.RawMessage `json:"theoretical"`
+		Perceived   json.RawMessage `json:"perceived"`
+	}
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return Palette{}, fmt.Errorf("invalid palette: %w", err)
+	}
+	names, theoretical, err := decodeColors(raw.Theoretical)
+	if err != nil {
+		return Palette{}, fmt.Errorf("invalid palette: %w", err)
+	}
+	perceivedNames, perceived, err := decodeColors(raw.Perceived)
+	if err != nil {
+		return Palette{}, fmt.Errorf("invalid palette: %w", err)
+	}
+	for _, name := range perceivedNames {
+		if _, ok := theoretical[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) < 2 {
+		return Palette{}, errors.New("invalid palette: needs at least two colors")
+	}
+
+	p := Palette{Names: names}
+	for _, name := range names {
+		pc, hasPerceived := perceived[name]
+		tc, hasTheoretical := theoretical[name]
+		if !hasTheoretical {
+			if tc, hasTheoretical = theoreticalColors[name]; !hasTheoretical {
+				tc = pc
+			}
+		}
+		if !hasPerceived {
+			pc = tc
+		}
+		p.Theoretical = append(p.Theoretical, tc)
+		p.Perceived = append(p.Perceived, pc)
+	}
+	return p, nil
+}
+
+// decodeColors decodes a JSON object of named colors, keeping key order.
+func decodeColors(raw json.RawMessage) ([]string, map[string]Color, error) {
+	colors := make(map[string]Color)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, colors, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil {
+		return nil, nil, err
+	} else if tok != json.Delim('{') {
+		return nil, nil, errors.New("colors must be a JSON object")
+	}
+	var names []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		name, _ := tok.(string)
+		var c Color
+		if err := dec.Decode(&c); err != nil {
+			return nil, nil, err
+		}
+		if _, dup := colors[name]; !dup {
+			names = append(names, name)
+		}
+		colors[name] = c
+	}
+	return names, colors, nil
+}
+
+// ColorPalette returns the theoretical colors as an image palette.
+func (p Palette) ColorPalette() color.Palette {
+	pal := make(color.Palette, len(p.Theoretical))
+	for i, c := range p.Theoretical {
+		pal[i] = color.RGBA{uint8(c.R), uint8(c.G), uint8(c.B), 255}
+	}
+	return pal
+}
+
+// --- Color space helpers ---
+
+type lab struct{ L, A, B float64 }
+
+func srgbToLinear(v float64) float64 {
+	v /= 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		v *= 12.92
+	} else {
+		v = 1.055*math.Pow(v, 1/2.4) - 0.055
+	}
+	return v * 255
+}
+
+// D65 reference white
+const (
+	whiteX = 0.95047
+	whiteY = 1.0
+	whiteZ = 1.08883
+)
+
+func labF(t float64) float64 {
+	if t > 216.0/24389 {
+		return math.Cbrt(t)
+	}
+	return (24389.0/27*t + 16) / 116
+}
+
+func labFInv(t float64) float64 {
+	if t3 := t * t * t; t3 > 216.0/24389 {
+		return t3
+	}
+	return (116*t - 16) * 27 / 24389
+}
+
+func rgbToLab(r, g, b float64) lab {
+	lr, lg, lb := srgbToLinear(r), srgbToLinear(g), srgbToLinear(b)
+	x := 0.4124564*lr + 0.3575761*lg + 0.1804375*lb
+	y := 0.2126729*lr + 0.7151522*lg + 0.0721750*lb
+	z := 0.0193339*lr + 0.1191920*lg + 0.9503041*lb
+
+	fx, fy, fz := labF(x/whiteX), labF(y/whiteY), labF(z/whiteZ)
+	return lab{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
+
+func labToRGB(c lab) (float64, float64, float64) {
+	fy := (c.L + 16) / 116
+	fx := fy + c.A/500
+	fz := fy - c.B/200
+	x, y, z := labFInv(fx)*whiteX, labFInv(fy)*whiteY, labFInv(fz)*whiteZ
+
+	lr := 3.2404542*x - 1.5371385*y - 0.4985314*z
+	lg := -0.9692660*x + 1.8760108*y + 0.0415560*z
+	lb := 0.0556434*x - 0.2040259*y + 1.0572252*z
+	return linearToSRGB(clamp01(lr)), linearToSRGB(clamp01(lg)), linearToSRGB(clamp01(lb))
+}
+
+func clamp01(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+func clamp255(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return v
+}
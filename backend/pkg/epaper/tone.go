@@ -0,0 +1,159 @@
+package epaper
+
+import "math"
+
+// pixels is a working buffer of sRGB values in [0, 255], three per pixel.
+type pixels struct {
+	w, h int
+	px   []float64
+}
+
+func (p *pixels) each(fn func(r, g, b float64) (float64, float64, float64)) {
+	for i := 0; i < len(p.px); i += 3 {
+		r, g, b := fn(p.px[i], p.px[i+1], p.px[i+2])
+		p.px[i], p.px[i+1], p.px[i+2] = clamp255(r), clamp255(g), clamp255(b)
+	}
+}
+
+func applyExposure(p *pixels, exposure float64) {
+	if exposure == 1 {
+		return
+	}
+	p.each(func(r, g, b float64) (float64, float64, float64) {
+		return r * exposure, g * exposure, b * exposure
+	})
+}
+
+// applySaturation scales the HSL saturation of every pixel.
+func applySaturation(p *pixels, saturation float64) {
+	if saturation == 1 {
+		return
+	}
+	p.each(func(r, g, b float64) (float64, float64, float64) {
+		h, s, l := rgbToHSL(r, g, b)
+		return hslToRGB(h, clamp01(s*saturation), l)
+	})
+}
+
+func applyContrast(p *pixels, contrast float64) {
+	if contrast == 1 {
+		return
+	}
+	p.each(func(r, g, b float64) (float64, float64, float64) {
+		return (r-128)*contrast + 128, (g-128)*contrast + 128, (b-128)*contrast + 128
+	})
+}
+
+// applySCurve lifts shadows and compresses highlights around midpoint. Each
+// half of the range is mapped with a power curve: shadowBoost flattens the
+// lower half, highlightCompress bends the upper half down, both scaled by
+// strength.
+func applySCurve(p *pixels, strength, shadowBoost, highlightCompress, midpoint float64) {
+	var lut [256]float64
+	for i := range lut {
+		lut[i] = sCurve(float64(i)/255, strength, shadowBoost, highlightCompress, midpoint) * 255
+	}
+	curve := func(v float64) float64 {
+		i := int(v)
+		if i >= 255 {
+			return lut[255]
+		}
+		frac := v - float64(i)
+		return lut[i]*(1-frac) + lut[i+1]*frac
+	}
+	p.each(func(r, g, b float64) (float64, float64, float64) {
+		return curve(r), curve(g), curve(b)
+	})
+}
+
+func sCurve(x, strength, shadowBoost, highlightCompress, midpoint float64) float64 {
+	if x <= midpoint {
+		shadow := x / midpoint
+		return math.Pow(shadow, 1-strength*shadowBoost) * midpoint
+	}
+	highlight := (x - midpoint) / (1 - midpoint)
+	return midpoint + math.Pow(highlight, 1+strength*highlightCompress)*(1-midpoint)
+}
+
+// compressDynamicRange maps the full lightness range onto the range the panel
+// can show, between its darkest and lightest perceived inks, so shadows and
+// highlights keep their detail instead of being clipped by the dither.
+func compressDynamicRange(p *pixels, palette Palette) {
+	minL, maxL := 100.0, 0.0
+	for _, c := range palette.Perceived {
+		l := rgbToLab(float64(c.R), float64(c.G), float64(c.B)).L
+		minL = math.Min(minL, l)
+		maxL = math.Max(maxL, l)
+	}
+	if maxL <= minL {
+		return
+	}
+
+	p.each(func(r, g, b float64) (float64, float64, float64) {
+		c := rgbToLab(r, g, b)
+		c.L = minL + c.L*(maxL-minL)/100
+		return labToRGB(c)
+	})
+}
+
+func rgbToHSL(r, g, b float64) (h, s, l float64) {
+	r, g, b = r/255, g/255, b/255
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	l = (max + min) / 2
+	if max == min {
+		return 0, 0, l
+	}
+
+	d := max - min
+	if l > 0.5 {
+		s = d / (2 - max - min)
+	} else {
+		s = d / (max + min)
+	}
+	switch max {
+	case r:
+		h = (g - b) / d
+		if g < b {
+			h += 6
+		}
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return h / 6, s, l
+}
+
+func hslToRGB(h, s, l float64) (float64, float64, float64) {
+	if s == 0 {
+		return l * 255, l * 255, l * 255
+	}
+	var q float64
+	if l < 0.5 {
+		q = l * (1 + s)
+	} else {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+	return hueToRGB(p, q, h+1.0/3) * 255, hueToRGB(p, q, h) * 255, hueToRGB(p, q, h-1.0/3) * 255
+}
+
+func hueToRGB(p, q, t float64) float64 {
+	if t < 0 {
+		t++
+	}
+	if t > 1 {
+		t--
+	}
+	switch {
+	case t < 1.0/6:
+		return p + (q-p)*6*t
+	case t < 1.0/2:
+		return q
+	case t < 2.0/3:
+		return p + (q-p)*(2.0/3-t)*6
+	default:
+		return p
+	}
+}
@@ -0,0 +1,252 @@
+// Package exif reads the handful of EXIF fields the server needs from JPEG
+// and HEIF (HEIC, AVIF) files: the capture time and the orientation flag.
+package exif
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNoExif is returned when the image carries no EXIF block.
+var ErrNoExif = errors.New("exif: no exif data")
+
+const (
+	tagOrientation       = 0x0112
+	tagDateTime          = 0x0132
+	tagExifIFD           = 0x8769
+	tagDateTimeOriginal  = 0x9003
+	tagDateTimeDigitized = 0x9004
+
+	typeShort = 3
+	typeLong  = 4
+
+	dateTimeLayout = "2006:01:02 15:04:05"
+)
+
+// Info holds the EXIF fields of interest. Zero values mean the field was
+// absent or unreadable.
+type Info struct {
+	// DateTimeOriginal is the camera's wall-clock capture time. EXIF has no
+	// timezone, so it is returned as UTC without conversion.
+	DateTimeOriginal time.Time
+	// Orientation is the TIFF orientation flag (1-8).
+	Orientation int
+}
+
+// DecodeFile reads EXIF data from the file at path.
+func DecodeFile(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(f)
+}
+
+// Decode reads EXIF data from a JPEG or HEIF stream. For JPEG it stops
+// reading at the start of the image data, so only the headers are consumed;
+// HEIF may keep the EXIF block anywhere, so the whole file is read.
+func Decode(r io.Reader) (*Info, error) {
+	br := bufio.NewReader(r)
+	if header, err := br.Peek(8); err == nil && string(header[4:8]) == "ftyp" {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		return decodeHEIF(data)
+	}
+	return decodeJPEG(br)
+}
+
+func decodeJPEG(br *bufio.Reader) (*Info, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil {
+		return nil, err
+	}
+	if soi[0] != 0xFF || soi[1] != 0xD8 {
+		return nil, errors.New("exif: not a jpeg")
+	}
+
+	for {
+		marker, err := nextMarker(br)
+		if err != nil {
+			return nil, err
+		}
+		// Start of scan or end of image: no more metadata segments
+		if marker == 0xDA || marker == 0xD9 {
+			return nil, ErrNoExif
+		}
+		// Standalone markers without a length
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue
+		}
+
+		var lenBuf [2]byte
+		if _, err := io.ReadFull(br, lenBuf[:]); err != nil {
+			return nil, err
+		}
+		length := int(binary.BigEndian.Uint16(lenBuf[:])) - 2
+		if length < 0 {
+			return nil, errors.New("exif: invalid segment length")
+		}
+
+		if marker != 0xE1 {
+			if _, err := br.Discard(length); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(br, segment); err != nil {
+			return nil, err
+		}
+		// APP1 is also used for XMP; only the Exif flavour is of interest
+		if len(segment) < 6 || string(segment[:6]) != "Exif\x00\x00" {
+			continue
+		}
+		return parseTIFF(segment[6:])
+	}
+}
+
+func nextMarker(br *bufio.Reader) (byte, error) {
+	b, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xFF {
+		return 0, errors.New("exif: invalid marker")
+	}
+	// Markers may be preceded by any number of fill bytes
+	for b == 0xFF {
+		if b, err = br.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+	return b, nil
+}
+
+// parseTIFF extracts the fields of interest from a TIFF-structured EXIF block.
+func parseTIFF(data []byte) (*Info, error) {
+	if len(data) < 8 {
+		return nil, ErrNoExif
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("exif: invalid byte order")
+	}
+	if order.Uint16(data[2:4]) != 42 {
+		return nil, errors.New("exif: invalid tiff header")
+	}
+
+	t := &tiff{data: data, order: order}
+	info := &Info{}
+
+	ifd0 := t.entries(order.Uint32(data[4:8]))
+	var dateTime string
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tagOrientation:
+			if v := t.uint(e); v >= 1 && v <= 8 {
+				info.Orientation = int(v)
+			}
+		case tagDateTime:
+			dateTime = t.ascii(e)
+		case tagExifIFD:
+			for _, sub := range t.entries(t.uint(e)) {
+				switch sub.tag {
+				case tagDateTimeOriginal:
+					info.DateTimeOriginal = parseDateTime(t.ascii(sub))
+				case tagDateTimeDigitized:
+					if info.DateTimeOriginal.IsZero() {
+						info.DateTimeOriginal = parseDateTime(t.ascii(sub))
+					}
+				}
+			}
+		}
+	}
+	if info.DateTimeOriginal.IsZero() {
+		info.DateTimeOriginal = parseDateTime(dateTime)
+	}
+	return info, nil
+}
+
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type entry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte // the raw 4-byte value/offset field
+}
+
+func (t *tiff) entries(offset uint32) []entry {
+	if int(offset)+2 > len(t.data) {
+		return nil
+	}
+	n := int(t.order.Uint16(t.data[offset:]))
+	start := int(offset) + 2
+	var entries []entry
+	for i := 0; i < n; i++ {
+		p := start + i*12
+		if p+12 > len(t.data) {
+			break
+		}
+		entries = append(entries, entry{
+			tag:   t.order.Uint16(t.data[p:]),
+			typ:   t.order.Uint16(t.data[p+2:]),
+			count: t.order.Uint32(t.data[p+4:]),
+			value: t.data[p+8 : p+12],
+		})
+	}
+	return entries
+}
+
+func (t *tiff) uint(e entry) uint32 {
+	switch e.typ {
+	case typeShort:
+		return uint32(t.order.Uint16(e.value))
+	case typeLong:
+		return t.order.Uint32(e.value)
+	}
+	return 0
+}
+
+func (t *tiff) ascii(e entry) string {
+	var raw []byte
+	if e.count <= 4 {
+		raw = e.value[:e.count]
+	} else {
+		offset := t.order.Uint32(e.value)
+		end := uint64(offset) + uint64(e.count)
+		if end > uint64(len(t.data)) {
+			return ""
+		}
+		raw = t.data[offset:end]
+	}
+	return strings.TrimRight(string(raw), "\x00 ")
+}
+
+func parseDateTime(s string) time.Time {
+	if len(s) < len(dateTimeLayout) {
+		return time.Time{}
+	}
+	t, err := time.Parse(dateTimeLayout, s[:len(dateTimeLayout)])
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
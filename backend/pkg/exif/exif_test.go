@@ -0,0 +1,126 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTIFF returns an EXIF block holding an orientation in IFD0 and
+// DateTimeOriginal in the Exif sub-IFD.
+func buildTIFF(order binary.ByteOrder, orientation uint16, dateTime string) []byte {
+	var tiff bytes.Buffer
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	binary.Write(&tiff, order, uint16(42))
+	binary.Write(&tiff, order, uint32(8)) // IFD0 offset
+
+	// IFD0: 2 entries
+	exifIFDOffset := uint32(8 + 2 + 2*12 + 4)
+	binary.Write(&tiff, order, uint16(2))
+	binary.Write(&tiff, order, []uint16{tagOrientation, typeShort})
+	binary.Write(&tiff, order, uint32(1))
+	binary.Write(&tiff, order, []uint16{orientation, 0})
+	binary.Write(&tiff, order, []uint16{tagExifIFD, typeLong})
+	binary.Write(&tiff, order, uint32(1))
+	binary.Write(&tiff, order, exifIFDOffset)
+	binary.Write(&tiff, order, uint32(0))
+
+	// Exif IFD: 1 entry pointing at the date string right after it
+	dateOffset := exifIFDOffset + 2 + 12 + 4
+	binary.Write(&tiff, order, uint16(1))
+	binary.Write(&tiff, order, []uint16{tagDateTimeOriginal, 2})
+	binary.Write(&tiff, order, uint32(len(dateTime)+1))
+	binary.Write(&tiff, order, dateOffset)
+	binary.Write(&tiff, order, uint32(0))
+	tiff.WriteString(dateTime + "\x00")
+	return tiff.Bytes()
+}
+
+// buildJPEG returns a minimal JPEG header with an APP1 Exif segment.
+func buildJPEG(order binary.ByteOrder, orientation uint16, dateTime string) []byte {
+	payload := append([]byte("Exif\x00\x00"), buildTIFF(order, orientation, dateTime)...)
+	var jpeg bytes.Buffer
+	jpeg.Write([]byte{0xFF, 0xD8})
+	jpeg.Write([]byte{0xFF, 0xE0, 0x00, 0x04, 0x00, 0x00}) // empty APP0
+	jpeg.Write([]byte{0xFF, 0xE1})
+	binary.Write(&jpeg, binary.BigEndian, uint16(len(payload)+2))
+	jpeg.Write(payload)
+	jpeg.Write([]byte{0xFF, 0xDA})
+	return jpeg.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		info, err := Decode(bytes.NewReader(buildJPEG(order, 6, "2019:07:14 18:30:05")))
+		require.NoError(t, err)
+		assert.Equal(t, 6, info.Orientation)
+		assert.Equal(t, time.Date(2019, 7, 14, 18, 30, 5, 0, time.UTC), info.DateTimeOriginal)
+	}
+}
+
+func TestDecode_NoExif(t *testing.T) {
+	_, err := Decode(bytes.NewReader([]byte{0xFF, 0xD8, 0xFF, 0xDA}))
+	assert.ErrorIs(t, err, ErrNoExif)
+}
+
+// heifBox wraps payload in an ISO BMFF box.
+func heifBox(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, typ...), body...)
+}
+
+// buildHEIF returns a minimal HEIF file whose Exif item (ID 2) holds tiff,
+// either in the mdat box or, inIdat, in the meta box's idat.
+func buildHEIF(tiff []byte, inIdat bool) []byte {
+	item := append(binary.BigEndian.AppendUint32(nil, 6), "Exif\x00\x00"...)
+	item = append(item, tiff...)
+
+	infe := func(id uint16, typ string) []byte {
+		return heifBox("infe", []byte{2, 0, 0, 0}, binary.BigEndian.AppendUint16(nil, id), []byte{0, 0}, []byte(typ), []byte{0})
+	}
+	iinf := heifBox("iinf", []byte{0, 0, 0, 0, 0, 2}, infe(1, "hvc1"), infe(2, "Exif"))
+	ftyp := heifBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+
+	// iloc version 1, 4-byte offsets and lengths, no base offset
+	iloc := func(offset uint32, method byte) []byte {
+		b := []byte{1, 0, 0, 0, 0x44, 0x00, 0, 1}
+		b = append(b, 0, 2, 0, method, 0, 0, 0, 1)
+		b = binary.BigEndian.AppendUint32(b, offset)
+		return heifBox("iloc", binary.BigEndian.AppendUint32(b, uint32(len(item))))
+	}
+	hdlr := heifBox("hdlr", make([]byte, 24))
+	if inIdat {
+		meta := heifBox("meta", []byte{0, 0, 0, 0}, hdlr, iinf, iloc(0, 1), heifBox("idat", item))
+		return append(ftyp, meta...)
+	}
+	// The mdat offset depends on the meta box's size, which doesn't
+	pixels := []byte("image data")
+	meta := heifBox("meta", []byte{0, 0, 0, 0}, hdlr, iinf, iloc(0, 0))
+	offset := uint32(len(ftyp) + len(meta) + 8 + len(pixels))
+	meta = heifBox("meta", []byte{0, 0, 0, 0}, hdlr, iinf, iloc(offset, 0))
+	return bytes.Join([][]byte{ftyp, meta, heifBox("mdat", pixels, item)}, nil)
+}
+
+func TestDecode_HEIF(t *testing.T) {
+	for _, inIdat := range []bool{false, true} {
+		tiff := buildTIFF(binary.BigEndian, 6, "2023:05:01 08:15:00")
+		info, err := Decode(bytes.NewReader(buildHEIF(tiff, inIdat)))
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2023, 5, 1, 8, 15, 0, 0, time.UTC), info.DateTimeOriginal)
+		// The decoders apply the container's rotation instead
+		assert.Zero(t, info.Orientation)
+	}
+
+	noExif := heifBox("ftyp", []byte("heic\x00\x00\x00\x00"))
+	_, err := Decode(bytes.NewReader(noExif))
+	assert.ErrorIs(t, err, ErrNoExif)
+}
@@ -0,0 +1,224 @@
+package exif
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errInvalidHEIF = errors.New("exif: invalid heif")
+
+// decodeHEIF reads the Exif item of a HEIF file (HEIC, AVIF). The item is
+// found through the meta box: iinf names the items, iloc says where their
+// data lives.
+func decodeHEIF(data []byte) (*Info, error) {
+	var meta []byte
+	for _, b := range boxes(data) {
+		if b.typ == "meta" {
+			meta = b.data
+			break
+		}
+	}
+	if len(meta) < 4 {
+		return nil, ErrNoExif
+	}
+
+	var iinf, iloc, idat []byte
+	for _, b := range boxes(meta[4:]) { // meta is a full box
+		switch b.typ {
+		case "iinf":
+			iinf = b.data
+		case "iloc":
+			iloc = b.data
+		case "idat":
+			idat = b.data
+		}
+	}
+	id, ok := exifItem(iinf)
+	if !ok {
+		return nil, ErrNoExif
+	}
+	item, err := itemData(iloc, id, data, idat)
+	if err != nil {
+		return nil, err
+	}
+
+	// The item starts with the offset of the TIFF header past its own field
+	if len(item) < 4 {
+		return nil, errInvalidHEIF
+	}
+	start := 4 + uint64(binary.BigEndian.Uint32(item))
+	if start > uint64(len(item)) {
+		return nil, errInvalidHEIF
+	}
+	info, err := parseTIFF(item[start:])
+	if err != nil {
+		return nil, err
+	}
+	// HEIF carries the rotation in the container, which the decoders apply,
+	// so the EXIF flag must not be applied again
+	info.Orientation = 0
+	return info, nil
+}
+
+type box struct {
+	typ  string
+	data []byte
+}
+
+// boxes splits data into ISO BMFF boxes, stopping at the first malformed one.
+func boxes(data []byte) []box {
+	var out []box
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0: // to the end of the enclosing data
+			size = uint64(len(data))
+		case 1: // 64-bit size follows the type
+			if len(data) < 16 {
+				return out
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return out
+		}
+		out = append(out, box{typ: typ, data: data[header:size]})
+		data = data[size:]
+	}
+	return out
+}
+
+// exifItem returns the ID of the Exif item listed in an iinf box.
+func exifItem(iinf []byte) (uint32, bool) {
+	if len(iinf) < 4 {
+		return 0, false
+	}
+	entries := iinf[4:]
+	if iinf[0] == 0 {
+		if len(entries) < 2 {
+			return 0, false
+		}
+		entries = entries[2:]
+	} else {
+		if len(entries) < 4 {
+			return 0, false
+		}
+		entries = entries[4:]
+	}
+	for _, b := range boxes(entries) {
+		// Only version 2 and later entries have an item type
+		if b.typ != "infe" || len(b.data) < 4 || b.data[0] < 2 {
+			continue
+		}
+		p := b.data[4:]
+		var id uint32
+		if b.data[0] == 2 {
+			if len(p) < 8 {
+				continue
+			}
+			id, p = uint32(binary.BigEndian.Uint16(p)), p[2:]
+		} else {
+			if len(p) < 10 {
+				continue
+			}
+			id, p = binary.BigEndian.Uint32(p), p[4:]
+		}
+		// Skip item_protection_index
+		if string(p[2:6]) == "Exif" {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// itemData returns the data of item id as located by an iloc box, in the
+// file itself or in the meta box's idat.
+func itemData(iloc []byte, id uint32, file, idat []byte) ([]byte, error) {
+	r := &reader{data: iloc}
+	version := r.uint(1)
+	r.skip(3) // flags
+	sizes := r.uint(1)
+	offsetSize, lengthSize := int(sizes>>4), int(sizes&0xF)
+	sizes = r.uint(1)
+	baseOffsetSize, indexSize := int(sizes>>4), int(sizes&0xF)
+	if version != 1 && version != 2 {
+		indexSize = 0
+	}
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	count := r.uint(idSize)
+
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		itemID := r.uint(idSize)
+		method := uint64(0)
+		if version == 1 || version == 2 {
+			method = r.uint(2) & 0xF
+		}
+		r.skip(2) // data_reference_index
+		base := r.uint(baseOffsetSize)
+		extents := r.uint(2)
+
+		var out []byte
+		for e := uint64(0); e < extents && r.err == nil; e++ {
+			r.skip(indexSize)
+			offset := base + r.uint(offsetSize)
+			length := r.uint(lengthSize)
+			if itemID != uint64(id) {
+				continue
+			}
+			src := file
+			if method == 1 {
+				src = idat
+			} else if method != 0 {
+				return nil, errInvalidHEIF
+			}
+			if length == 0 {
+				// Extends to the end of the source
+				length = uint64(len(src)) - min(offset, uint64(len(src)))
+			}
+			if offset > uint64(len(src)) || length > uint64(len(src))-offset {
+				return nil, errInvalidHEIF
+			}
+			out = append(out, src[offset:offset+length]...)
+		}
+		if itemID == uint64(id) && r.err == nil {
+			return out, nil
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return nil, ErrNoExif
+}
+
+// reader reads big-endian fields of varying size, remembering the first
+// read past the end.
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) uint(size int) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if size > len(r.data) {
+		r.err = errInvalidHEIF
+		return 0
+	}
+	var v uint64
+	for _, b := range r.data[:size] {
+		v = v<<8 | uint64(b)
+	}
+	r.data = r.data[size:]
+	return v
+}
+
+func (r *reader) skip(n int) {
+	r.uint(n)
+}
@@ -93,6 +93,15 @@ func (c *Client) GetCalendarList(httpClient *http.Client) ([]Calendar, error) {
 // Returns only current and upcoming events sorted by start time. Returns nil (not error) if the
 // API call fails due to insufficient scopes, so callers can gracefully degrade.
 func (c *Client) GetTodayEvents(httpClient *http.Client, calendarID string, timezone string) ([]Event, error) {
+	return c.GetEvents(httpClient, calendarID, timezone, 1)
+}
+
+// GetEvents is GetTodayEvents for the given number of days starting today,
+// for agendas.
+func (c *Client) GetEvents(httpClient *http.Client, calendarID string, timezone string, days int) ([]Event, error) {
+	if days < 1 {
+		days = 1
+	}
 	if calendarID == "" {
 		calendarID = "primary"
 	}
@@ -107,14 +116,14 @@ func (c *Client) GetTodayEvents(httpClient *http.Client, calendarID string, time
 
 	now := time.Now().In(loc)
 	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
-	endOfDay := startOfDay.Add(24 * time.Hour)
+	endOfRange := startOfDay.AddDate(0, 0, days)
 
 	params := url.Values{}
 	params.Set("timeMin", startOfDay.Format(time.RFC3339))
-	params.Set("timeMax", endOfDay.Format(time.RFC3339))
+	params.Set("timeMax", endOfRange.Format(time.RFC3339))
 	params.Set("singleEvents", "true")
 	params.Set("orderBy", "startTime")
-	params.Set("maxResults", "10")
+	params.Set("maxResults", fmt.Sprintf("%d", min(10*days, 100)))
 
 	apiURL := fmt.Sprintf("https://www.googleapis.com/calendar/v3/calendars/%s/events?%s", url.PathEscape(calendarID), params.Encode())
 
@@ -140,7 +149,7 @@ func (c *Client) GetTodayEvents(httpClient *http.Client, calendarID string, time
 
 	// Parse all-day dates in the device timezone so comparisons are correct.
 	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
-	tomorrow := today.Add(24 * time.Hour)
+	endDay := today.AddDate(0, 0, days)
 
 	var events []Event
 	for _, item := range result.Items {
@@ -175,16 +184,16 @@ func (c *Client) GetTodayEvents(httpClient *http.Client, calendarID string, time
 		events = append(events, ev)
 	}
 
-	// Filter to only events relevant to today:
-	// - All-day events: keep only if they cover today (Start < tomorrow && End > today)
+	// Filter to only events relevant to the range:
+	// - All-day events: keep only if they cover one of its days (Start < endDay && End > today)
 	// - Timed events: keep only if they haven't ended yet
 	nowAbs := time.Now()
 	var filtered []Event
 	for _, ev := range events {
 		if ev.AllDay {
 			// All-day event spans [Start, End) in date granularity.
-			// Keep if it overlaps with today.
-			if ev.Start.Before(tomorrow) && ev.End.After(today) {
+			// Keep if it overlaps with the range.
+			if ev.Start.Before(endDay) && ev.End.After(today) {
 				filtered = append(filtered, ev)
 			}
 		} else {
@@ -0,0 +1,115 @@
+package imageops
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"io"
+	"os"
+
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/exif"
+)
+
+// Decode decodes an image and applies its EXIF orientation, so photos from
+// phones that store the sensor orientation plus a rotation flag come out
+// upright.
+func Decode(r io.Reader) (image.Image, string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+	return DecodeBytes(data)
+}
+
+// DecodeBytes is Decode for an image already in memory.
+func DecodeBytes(data []byte) (image.Image, string, error) {
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, format, err
+	}
+	return Orient(img, exifOrientation(data)), format, nil
+}
+
+// DecodeFile is Decode for the file at path.
+func DecodeFile(path string) (image.Image, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return DecodeBytes(data)
+}
+
+// DecodeConfig returns the dimensions of an image as displayed, i.e. swapped
+// for EXIF orientations that rotate by 90°.
+func DecodeConfig(r io.ReadSeeker) (image.Config, string, error) {
+	cfg, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return cfg, format, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err == nil {
+		if info, err := exif.Decode(r); err == nil && info.Orientation >= 5 {
+			cfg.Width, cfg.Height = cfg.Height, cfg.Width
+		}
+	}
+	return cfg, format, nil
+}
+
+func exifOrientation(data []byte) int {
+	info, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 1
+	}
+	return info.Orientation
+}
+
+// Orient transforms img according to an EXIF orientation flag (1-8). Images
+// that need no transform are returned as is.
+func Orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	src := toRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise to display
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise to display
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[y*src.Stride+x*4:])
+		}
+	}
+	return dst
+}
+
+// toRGBA returns img as an *image.RGBA with bounds starting at the origin,
+// converting only when needed.
+func toRGBA(img image.Image) *image.RGBA {
+	img = Unwrap(img)
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,137 @@
+package imageops
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/gen2brain/avif"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jpegWithOrientation encodes img as a JPEG carrying an EXIF orientation flag.
+func jpegWithOrientation(t *testing.T, img image.Image, orientation uint16) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}))
+
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(app1)+2))
+	out = append(out, app1...)
+	return append(out, buf.Bytes()[2:]...)
+}
+
+func TestDecode_AppliesExifOrientation(t *testing.T) {
+	// Landscape sensor image, red on the left
+	src := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			c := color.RGBA{0, 0, 255, 255}
+			if x < 32 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+	data := jpegWithOrientation(t, src, 6)
+
+	img, format, err := DecodeBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	// Rotated clockwise for display: the left half ends up on top
+	assert.Equal(t, image.Rect(0, 0, 32, 64), img.Bounds())
+	r, _, b, _ := img.At(16, 8).RGBA()
+	assert.Greater(t, r, b)
+	r, _, b, _ = img.At(16, 56).RGBA()
+	assert.Less(t, r, b)
+
+	cfg, _, err := DecodeConfig(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 32, cfg.Width)
+	assert.Equal(t, 64, cfg.Height)
+}
+
+func TestOrient_AllFlags(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	src.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	red := color.RGBA{255, 0, 0, 255}
+
+	// Where the top-left pixel ends up for each orientation
+	want := map[int]image.Point{1: {0, 0}, 2: {2, 0}, 3: {2, 1}, 4: {0, 1}, 5: {0, 0}, 6: {1, 0}, 7: {1, 2}, 8: {0, 2}}
+	for orientation, p := range want {
+		img := Orient(src, orientation)
+		assert.Equal(t, red, img.At(p.X, p.Y), "orientation %d", orientation)
+	}
+}
+
+func TestResize_AreaAverage(t *testing.T) {
+	// 1px black/white checkerboard averages to mid gray
+	src := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v := uint8(0)
+			if (x+y)%2 == 0 {
+				v = 255
+			}
+			src.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	out := Resize(src, src.Bounds(), 10, 10)
+	for _, v := range out.Pix {
+		if v != 255 {
+			assert.InDelta(t, 128, int(v), 8)
+		}
+	}
+
+	// The crop window is honored and upscaling keeps flat areas flat
+	src.Set(40, 40, color.RGBA{255, 0, 0, 255})
+	out = Resize(src, image.Rect(40, 40, 41, 41), 4, 4)
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, out.At(3, 3))
+
+	dst := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	DrawCover(dst, dst.Bounds(), WithFocus(src, CenterFocus))
+	assert.Equal(t, uint8(255), dst.Pix[3])
+}
+
+func TestSniffFormat(t *testing.T) {
+	assert.Equal(t, FormatHEIC, SniffFormat([]byte("\x00\x00\x00\x1cftypheic\x00\x00\x00\x00")))
+	assert.Equal(t, FormatHEIC, SniffFormat([]byte("\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00")))
+	assert.Equal(t, FormatAVIF, SniffFormat([]byte("\x00\x00\x00\x20ftypavif\x00\x00\x00\x00")))
+	assert.Equal(t, FormatWebP, SniffFormat([]byte("RIFF\x10\x00\x00\x00WEBPVP8 ")))
+	assert.Equal(t, FormatJPEG, SniffFormat(jpegWithOrientation(t, image.NewRGBA(image.Rect(0, 0, 8, 8)), 1)))
+	assert.Equal(t, "", SniffFormat([]byte("hello")))
+
+	assert.Equal(t, FormatHEIC, FormatFromName("image/heif"))
+	assert.Equal(t, FormatJPEG, FormatFromName("IMG_0001.JPEG"))
+	assert.Equal(t, FormatWebP, FormatFromName("image/webp"))
+	assert.Equal(t, "", FormatFromName("video/mp4"))
+	assert.Equal(t, ".heic", Extension(FormatHEIC))
+	assert.True(t, NativeFormat(FormatAVIF))
+	assert.False(t, NativeFormat("raw"))
+}
+
+func TestDecode_AVIF(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for i := range src.Pix {
+		src.Pix[i] = 200
+	}
+	var buf bytes.Buffer
+	require.NoError(t, avif.Encode(&buf, src))
+
+	img, format, err := DecodeBytes(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, FormatAVIF, format)
+	assert.Equal(t, image.Rect(0, 0, 16, 8), img.Bounds())
+}
@@ -0,0 +1,352 @@
+package imageops
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"sync/atomic"
+)
+
+// Focus is the point of an image a crop should keep in frame, as fractions of
+// the image's width and height.
+type Focus struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// CenterFocus is the focus of images without a salient subject.
+var CenterFocus = Focus{X: 0.5, Y: 0.5}
+
+// Where a focus point came from, from least to most trusted.
+const (
+	FocusSaliency = "saliency"
+	FocusFaces    = "faces"
+	FocusManual   = "manual"
+)
+
+// faceCascade is the face detector used by FindFocus; nil means focus is
+// found from saliency alone.
+var faceCascade atomic.Pointer[Cascade]
+
+// SetFaceCascade sets the face detector used when planning crops.
+func SetFaceCascade(c *Cascade) {
+	faceCascade.Store(c)
+}
+
+// FocusDetector returns how FindFocus finds the focus right now: FocusFaces
+// when a face cascade is set, FocusSaliency otherwise.
+func FocusDetector() string {
+	if faceCascade.Load() != nil {
+		return FocusFaces
+	}
+	return FocusSaliency
+}
+
+// FocusOutdated reports whether a focus that came from source should be found
+// again because a better detector is available now. Foci from before their
+// source was recorded count as saliency.
+func FocusOutdated(source string) bool {
+	rank := func(source string) int {
+		switch source {
+		case FocusManual:
+			return 2
+		case FocusFaces:
+			return 1
+		}
+		return 0
+	}
+	return rank(source) < rank(FocusDetector())
+}
+
+// Crop is a manual crop window as fractions of an image's width and height.
+type Crop struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	W float64 `json:"w"`
+	H float64 `json:"h"`
+}
+
+// Valid reports whether the window lies within the image and isn't empty.
+func (c Crop) Valid() bool {
+	return c.X >= 0 && c.Y >= 0 && c.W > 0 && c.H > 0 && c.X+c.W <= 1.0001 && c.Y+c.H <= 1.0001
+}
+
+// rect returns the window in the pixel coordinates of b.
+func (c Crop) rect(b image.Rectangle) image.Rectangle {
+	r := image.Rect(
+		b.Min.X+int(c.X*float64(b.Dx())),
+		b.Min.Y+int(c.Y*float64(b.Dy())),
+		b.Min.X+int((c.X+c.W)*float64(b.Dx())+0.5),
+		b.Min.Y+int((c.Y+c.H)*float64(b.Dy())+0.5),
+	).Intersect(b)
+	if r.Empty() {
+		return b
+	}
+	return r
+}
+
+// Framing is how an image is cropped: the point to keep in frame, and
+// optionally windows chosen by hand for landscape and portrait targets
+// that crops stay within.
+type Framing struct {
+	Focus     Focus
+	Landscape *Crop
+	Portrait  *Crop
+}
+
+// CropFor returns the manual window for a dstW x dstH target, nil if there
+// is none. Square targets use the landscape window.
+func (f Framing) CropFor(dstW, dstH int) *Crop {
+	if dstW >= dstH {
+		return f.Landscape
+	}
+	return f.Portrait
+}
+
+// focused is an image carrying a precomputed framing.
+type focused struct {
+	image.Image
+	framing Framing
+}
+
+// WithFocus attaches a focus point to img so crops don't need to detect it.
+func WithFocus(img image.Image, focus Focus) image.Image {
+	return WithFraming(img, Framing{Focus: focus})
+}
+
+// WithFraming attaches a focus point and manual crop windows to img.
+func WithFraming(img image.Image, framing Framing) image.Image {
+	return &focused{Image: Unwrap(img), framing: framing}
+}
+
+// Unwrap returns the underlying image of one returned by WithFocus, so
+// encoders can use their fast paths.
+func Unwrap(img image.Image) image.Image {
+	if f, ok := img.(*focused); ok {
+		return f.Image
+	}
+	return img
+}
+
+// FocusOf returns the focus attached to img, or finds it.
+func FocusOf(img image.Image) Focus {
+	if f, ok := img.(*focused); ok {
+		return f.framing.Focus
+	}
+	return FindFocus(img)
+}
+
+// FramingOf returns the framing attached to img, finding the focus when
+// there is none.
+func FramingOf(img image.Image) Framing {
+	if f, ok := img.(*focused); ok {
+		return f.framing
+	}
+	return Framing{Focus: FindFocus(img)}
+}
+
+// CropTo returns the part of img within its manual window for a dstW x dstH
+// target, with the focus moved along, or img itself when it has no window.
+// It lets a renderer that crops on its own (CSS object-fit) honor the window.
+func CropTo(img image.Image, dstW, dstH int) image.Image {
+	f, ok := img.(*focused)
+	if !ok {
+		return img
+	}
+	c := f.framing.CropFor(dstW, dstH)
+	if c == nil {
+		return img
+	}
+	b := f.Bounds()
+	window := c.rect(b)
+	sub, ok := f.Image.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		sub = toRGBA(f.Image)
+		window = window.Sub(b.Min)
+	}
+	return WithFocus(sub.SubImage(window), focusWithin(f.framing.Focus, b, window))
+}
+
+// focusWithin converts a focus on b to fractions of the window inside b.
+func focusWithin(focus Focus, b, window image.Rectangle) Focus {
+	x := float64(b.Min.X) + focus.X*float64(b.Dx())
+	y := float64(b.Min.Y) + focus.Y*float64(b.Dy())
+	return Focus{
+		X: (x - float64(window.Min.X)) / float64(window.Dx()),
+		Y: (y - float64(window.Min.Y)) / float64(window.Dy()),
+	}.clamp()
+}
+
+// Working sizes (longest side) for face detection and the saliency map.
+const (
+	faceScanSize     = 320
+	saliencyScanSize = 96
+	saliencyCell     = 8
+)
+
+// FindFocus finds the subject of an image: the detected faces when there are
+// any, weighted by size and confidence, otherwise the centroid of an
+// edge/entropy saliency map.
+func FindFocus(img image.Image) Focus {
+	if c := faceCascade.Load(); c != nil {
+		gray := downscaleGray(img, faceScanSize)
+		if faces := c.Detect(gray, 20); len(faces) > 0 {
+			return facesFocus(faces, gray.Rect)
+		}
+	}
+	return saliencyFocus(downscaleGray(img, saliencyScanSize))
+}
+
+func facesFocus(faces []Face, b image.Rectangle) Focus {
+	var sx, sy, sw float64
+	for _, f := range faces {
+		w := float64(f.Rect.Dx()*f.Rect.Dy()) * f.Score
+		c := f.Rect.Min.Add(f.Rect.Max).Div(2).Sub(b.Min)
+		sx += float64(c.X) * w
+		sy += float64(c.Y) * w
+		sw += w
+	}
+	return Focus{X: sx / sw / float64(b.Dx()), Y: sy / sw / float64(b.Dy())}.clamp()
+}
+
+// saliencyFocus splits the image into cells scored by their mean gradient
+// magnitude times their gray level entropy, so detailed regions outweigh flat
+// sky and walls, and returns the centroid of the squared scores, which favors
+// the strongest region over scattered detail.
+func saliencyFocus(gray *image.Gray) Focus {
+	w, h := gray.Rect.Dx(), gray.Rect.Dy()
+	if w < 3 || h < 3 {
+		return CenterFocus
+	}
+	px := func(x, y int) float64 {
+		x = min(max(x, 0), w-1)
+		y = min(max(y, 0), h-1)
+		return float64(gray.Pix[y*gray.Stride+x])
+	}
+
+	var sx, sy, sw float64
+	for cy := 0; cy < h; cy += saliencyCell {
+		for cx := 0; cx < w; cx += saliencyCell {
+			var grad float64
+			var hist [16]int
+			n := 0
+			for y := cy; y < min(cy+saliencyCell, h); y++ {
+				for x := cx; x < min(cx+saliencyCell, w); x++ {
+					// Sobel
+					gx := px(x+1, y-1) + 2*px(x+1, y) + px(x+1, y+1) - px(x-1, y-1) - 2*px(x-1, y) - px(x-1, y+1)
+					gy := px(x-1, y+1) + 2*px(x, y+1) + px(x+1, y+1) - px(x-1, y-1) - 2*px(x, y-1) - px(x+1, y-1)
+					grad += math.Hypot(gx, gy)
+					hist[gray.Pix[y*gray.Stride+x]>>4]++
+					n++
+				}
+			}
+			var entropy float64
+			for _, count := range hist {
+				if count > 0 {
+					p := float64(count) / float64(n)
+					entropy -= p * math.Log2(p)
+				}
+			}
+			score := grad / float64(n) * entropy / 4
+			weight := score * score
+			sx += (float64(cx) + float64(min(saliencyCell, w-cx))/2) * weight
+			sy += (float64(cy) + float64(min(saliencyCell, h-cy))/2) * weight
+			sw += weight
+		}
+	}
+	if sw < 1e-9 {
+		return CenterFocus
+	}
+	return Focus{X: sx / sw / float64(w), Y: sy / sw / float64(h)}.clamp()
+}
+
+func (f Focus) clamp() Focus {
+	return Focus{X: math.Min(math.Max(f.X, 0), 1), Y: math.Min(math.Max(f.Y, 0), 1)}
+}
+
+// downscaleGray box-filters img to grayscale with its longest side at most
+// size pixels.
+func downscaleGray(img image.Image, size int) *image.Gray {
+	b := img.Bounds()
+	scale := math.Max(float64(b.Dx()), float64(b.Dy())) / float64(size)
+	if scale < 1 {
+		scale = 1
+	}
+	w := max(int(float64(b.Dx())/scale), 1)
+	h := max(int(float64(b.Dy())/scale), 1)
+
+	out := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + int(float64(y)*scale)
+		y1 := max(b.Min.Y+int(float64(y+1)*scale), y0+1)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + int(float64(x)*scale)
+			x1 := max(b.Min.X+int(float64(x+1)*scale), x0+1)
+			var sum, n int
+			// Sample at most 4x4 points per box to bound the cost on large photos
+			sy := max((y1-y0)/4, 1)
+			sx := max((x1-x0)/4, 1)
+			for yy := y0; yy < y1; yy += sy {
+				for xx := x0; xx < x1; xx += sx {
+					sum += int(color.GrayModel.Convert(img.At(xx, yy)).(color.Gray).Y)
+					n++
+				}
+			}
+			out.Pix[y*out.Stride+x] = uint8(sum / n)
+		}
+	}
+	return out
+}
+
+// CropRect returns the largest window of b with the aspect ratio of dstW x
+// dstH, centered on the focus as far as the image edges allow.
+func CropRect(b image.Rectangle, dstW, dstH int, focus Focus) image.Rectangle {
+	srcW, srcH := b.Dx(), b.Dy()
+	cropW, cropH := srcW, srcH
+	if float64(srcW)/float64(srcH) > float64(dstW)/float64(dstH) {
+		// Source is wider than target: crop width
+		cropW = int(float64(srcH) * float64(dstW) / float64(dstH))
+	} else {
+		// Source is taller: crop height
+		cropH = int(float64(srcW) * float64(dstH) / float64(dstW))
+	}
+	cropW = max(cropW, 1)
+	cropH = max(cropH, 1)
+
+	x := int(focus.X*float64(srcW)) - cropW/2
+	y := int(focus.Y*float64(srcH)) - cropH/2
+	x = min(max(x, 0), srcW-cropW)
+	y = min(max(y, 0), srcH-cropH)
+	return image.Rect(x, y, x+cropW, y+cropH).Add(b.Min)
+}
+
+// PlanCrop picks the window of src to scale onto a dstW x dstH rectangle so
+// the photo's subject stays in frame, within its manual crop window when it
+// has one for the target's orientation.
+func PlanCrop(src image.Image, dstW, dstH int) image.Rectangle {
+	b := src.Bounds()
+	if f, ok := src.(*focused); ok {
+		if c := f.framing.CropFor(dstW, dstH); c != nil {
+			window := c.rect(b)
+			return CropRect(window, dstW, dstH, focusWithin(f.framing.Focus, b, window))
+		}
+	}
+	if b.Dx()*dstH == b.Dy()*dstW {
+		return b
+	}
+	return CropRect(b, dstW, dstH, FocusOf(src))
+}
+
+// ObjectPosition returns the CSS object-position for showing an image with
+// object-fit: cover. Using the focus fractions as percentages keeps the focus
+// point inside the visible area whatever the box's aspect ratio.
+func ObjectPosition(focus Focus) string {
+	return formatPercent(focus.X) + " " + formatPercent(focus.Y)
+}
+
+func formatPercent(v float64) string {
+	return strconv.FormatFloat(v*100, 'f', 1, 64) + "%"
+}
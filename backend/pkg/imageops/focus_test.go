@@ -0,0 +1,135 @@
+package imageops
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCropRect_CentersOnFocusWithinBounds(t *testing.T) {
+	b := image.Rect(0, 0, 400, 600)
+
+	// Portrait photo on a landscape slot: keep the top third
+	assert.Equal(t, image.Rect(0, 80, 400, 320), CropRect(b, 800, 480, Focus{X: 0.5, Y: 1.0 / 3}))
+	// Focus near the edge clamps to the image
+	assert.Equal(t, image.Rect(0, 0, 400, 240), CropRect(b, 800, 480, Focus{X: 0.5, Y: 0}))
+	assert.Equal(t, image.Rect(0, 360, 400, 600), CropRect(b, 800, 480, Focus{X: 0.5, Y: 1}))
+	// Same aspect ratio: nothing to crop
+	assert.Equal(t, b, CropRect(b, 200, 300, Focus{X: 0.9, Y: 0.9}))
+}
+
+func TestFindFocus_Saliency(t *testing.T) {
+	// Flat background with a detailed patch in the top right
+	img := image.NewGray(image.Rect(0, 0, 300, 200))
+	rng := rand.New(rand.NewSource(1))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 300; x++ {
+			v := uint8(120)
+			if x >= 210 && x < 270 && y >= 20 && y < 80 {
+				v = uint8(rng.Intn(256))
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+
+	focus := FindFocus(img)
+	assert.InDelta(t, 0.8, focus.X, 0.05)
+	assert.InDelta(t, 0.25, focus.Y, 0.05)
+
+	// The planned crop keeps the patch
+	crop := PlanCrop(img, 100, 200)
+	assert.True(t, image.Rect(210, 20, 270, 80).In(crop), "crop %v", crop)
+
+	// An attached focus wins over detection
+	assert.Equal(t, CenterFocus, FocusOf(WithFocus(img, CenterFocus)))
+	assert.Equal(t, CenterFocus, FindFocus(image.NewGray(image.Rect(0, 0, 50, 50))))
+}
+
+func TestPlanCrop_ManualWindow(t *testing.T) {
+	img := WithFraming(image.NewRGBA(image.Rect(0, 0, 400, 600)), Framing{
+		Focus:     Focus{X: 0.5, Y: 0.9},
+		Landscape: &Crop{X: 0, Y: 0.5, W: 1, H: 0.5},
+	})
+
+	// Landscape targets stay within the window, near the focus
+	assert.Equal(t, image.Rect(0, 360, 400, 600), PlanCrop(img, 800, 480))
+	assert.Equal(t, image.Rect(50, 300, 350, 600), PlanCrop(img, 400, 400))
+	// Portrait targets have no window and use the whole photo
+	assert.Equal(t, image.Rect(0, 0, 400, 600), PlanCrop(img, 200, 300))
+
+	// CropTo hands renderers the window with the focus moved along
+	cropped := CropTo(img, 800, 480)
+	assert.Equal(t, image.Rect(0, 300, 400, 600), cropped.Bounds())
+	assert.InDelta(t, 0.8, FocusOf(cropped).Y, 1e-9)
+	assert.Equal(t, img, CropTo(img, 480, 800))
+
+	assert.False(t, Crop{X: 0.5, Y: 0, W: 0.6, H: 1}.Valid())
+	assert.False(t, Crop{X: 0, Y: 0, W: 0, H: 1}.Valid())
+	assert.True(t, Crop{X: 0.2, Y: 0.1, W: 0.8, H: 0.9}.Valid())
+}
+
+// testCascade builds a one-tree cascade accepting windows whose lower half is
+// darker than their upper half.
+func testCascade() []byte {
+	var data []byte
+	u32 := func(v uint32) { data = binary.LittleEndian.AppendUint32(data, v) }
+	f32 := func(v float32) { u32(math.Float32bits(v)) }
+
+	data = append(data, make([]byte, 8)...)
+	u32(1) // depth
+	u32(1) // trees
+	// Root node: compare the pixel below the center with the one above
+	data = append(data, 64, 0, 0xc0, 0) // row offsets +64 and -64 (int8)
+	f32(-1)                             // below brighter than above
+	f32(1)                              // below darker or equal
+	f32(0)                              // threshold
+	return data
+}
+
+func TestCascade_DetectsAndSteersFocus(t *testing.T) {
+	cascade, err := ParseCascade(testCascade())
+	require.NoError(t, err)
+	_, err = ParseCascade(testCascade()[:20])
+	assert.Error(t, err)
+
+	// Brightening downwards everywhere except an inverted square
+	img := image.NewGray(image.Rect(0, 0, 320, 240))
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 320; x++ {
+			v := uint8(y)
+			if x >= 40 && x < 100 && y >= 150 && y < 210 {
+				v = uint8(255 - y)
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+
+	faces := cascade.Detect(img, 20)
+	require.NotEmpty(t, faces)
+	assert.True(t, faces[0].Rect.Overlaps(image.Rect(40, 150, 100, 210)), "face %v", faces[0].Rect)
+
+	assert.False(t, FocusOutdated(FocusSaliency))
+	SetFaceCascade(cascade)
+	defer SetFaceCascade(nil)
+	// Foci found without face detection are found again
+	assert.True(t, FocusOutdated(FocusSaliency))
+	assert.True(t, FocusOutdated(""))
+	assert.False(t, FocusOutdated(FocusFaces))
+	assert.False(t, FocusOutdated(FocusManual))
+	focus := FindFocus(img)
+	assert.InDelta(t, 70.0/320, focus.X, 0.1)
+	assert.InDelta(t, 180.0/240, focus.Y, 0.1)
+}
+
+func TestDefaultCascade(t *testing.T) {
+	cascade, err := DefaultCascade()
+	require.NoError(t, err)
+	// A flat image has no faces
+	assert.Empty(t, cascade.Detect(image.NewGray(image.Rect(0, 0, 200, 200)), 40))
+}
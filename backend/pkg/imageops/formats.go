@@ -0,0 +1,121 @@
+package imageops
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"  // Register GIF decoder
+	_ "image/jpeg" // Register JPEG decoder
+	"mime"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/gen2brain/avif" // Register AVIF decoder; libavif as WASM, or the system libavif when present
+	"github.com/gen2brain/heic"   // Also registers the "heic" brand; libheif as WASM, or the system libheif when present
+	_ "golang.org/x/image/bmp"    // Register BMP decoder
+	_ "golang.org/x/image/webp"   // Register WebP decoder
+)
+
+// Image formats as reported by Decode and recorded on images.
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+	FormatBMP  = "bmp"
+	FormatWebP = "webp"
+	FormatHEIC = "heic"
+	FormatAVIF = "avif"
+)
+
+func init() {
+	// HEIF stills from other encoders use these brands
+	for _, brand := range []string{"heix", "hevc", "heim", "heis", "mif1", "msf1"} {
+		image.RegisterFormat(FormatHEIC, "????ftyp"+brand, heic.Decode, heic.DecodeConfig)
+	}
+}
+
+// SniffFormat identifies an image format from the first bytes of a file,
+// returning "" when unknown. It reads only the header, so it is cheap enough
+// for every download.
+func SniffFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF}):
+		return FormatJPEG
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG
+	case bytes.HasPrefix(header, []byte("GIF8")):
+		return FormatGIF
+	case bytes.HasPrefix(header, []byte("BM")):
+		return FormatBMP
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WEBP":
+		return FormatWebP
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		switch string(header[8:12]) {
+		case "avif", "avis":
+			return FormatAVIF
+		case "heic", "heix", "hevc", "heim", "heis", "mif1", "msf1":
+			return FormatHEIC
+		}
+	}
+	return ""
+}
+
+// NativeFormat reports whether a format decodes in process, without
+// external tools.
+func NativeFormat(format string) bool {
+	switch format {
+	case FormatJPEG, FormatPNG, FormatGIF, FormatBMP, FormatWebP, FormatHEIC, FormatAVIF:
+		return true
+	}
+	return false
+}
+
+var formatExtensions = map[string]string{
+	FormatJPEG: ".jpg",
+	FormatPNG:  ".png",
+	FormatGIF:  ".gif",
+	FormatBMP:  ".bmp",
+	FormatWebP: ".webp",
+	FormatHEIC: ".heic",
+	FormatAVIF: ".avif",
+}
+
+// Extension returns the file extension for a format, ".jpg" when unknown.
+func Extension(format string) string {
+	if ext, ok := formatExtensions[format]; ok {
+		return ext
+	}
+	return ".jpg"
+}
+
+// FormatFromName guesses the format from a file name or MIME type, returning
+// "" when unknown.
+func FormatFromName(name string) string {
+	if mediaType, _, err := mime.ParseMediaType(name); err == nil && strings.HasPrefix(mediaType, "image/") {
+		switch sub := strings.TrimPrefix(mediaType, "image/"); sub {
+		case "jpeg", "jpg", "pjpeg":
+			return FormatJPEG
+		case "heif", "heic", "heif-sequence", "heic-sequence":
+			return FormatHEIC
+		case "x-ms-bmp":
+			return FormatBMP
+		default:
+			if _, ok := formatExtensions[sub]; ok {
+				return sub
+			}
+			return ""
+		}
+	}
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".jpg", ".jpeg", ".jpe":
+		return FormatJPEG
+	case ".heic", ".heif", ".hif":
+		return FormatHEIC
+	default:
+		for format, e := range formatExtensions {
+			if e == ext {
+				return format
+			}
+		}
+	}
+	return ""
+}
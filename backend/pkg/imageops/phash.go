@@ -0,0 +1,88 @@
+package imageops
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+)
+
+// PHash returns the 64-bit perceptual hash of an image: the signs of its
+// lowest 8x8 DCT frequencies of a 32x32 grayscale version relative to their
+// median. Resized, re-encoded or slightly edited copies of a photo hash
+// within a few bits of each other, so compare hashes with HammingDistance.
+func PHash(img image.Image) uint64 {
+	const size, low = 32, 8
+	rgba := Resize(img, img.Bounds(), size, size)
+
+	var lum [size][size]float64
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			p := rgba.Pix[y*rgba.Stride+x*4:]
+			lum[y][x] = 0.299*float64(p[0]) + 0.587*float64(p[1]) + 0.114*float64(p[2])
+		}
+	}
+
+	// Only the low frequencies are needed, so the 2D DCT-II is computed
+	// directly for those rather than in full
+	var cos [low][size]float64
+	for u := 0; u < low; u++ {
+		for x := 0; x < size; x++ {
+			cos[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * size))
+		}
+	}
+	var rows [size][low]float64
+	for y := 0; y < size; y++ {
+		for u := 0; u < low; u++ {
+			var sum float64
+			for x := 0; x < size; x++ {
+				sum += lum[y][x] * cos[u][x]
+			}
+			rows[y][u] = sum
+		}
+	}
+	coeffs := make([]float64, 0, low*low)
+	for v := 0; v < low; v++ {
+		for u := 0; u < low; u++ {
+			var sum float64
+			for y := 0; y < size; y++ {
+				sum += rows[y][u] * cos[v][y]
+			}
+			coeffs = append(coeffs, sum)
+		}
+	}
+
+	// The DC term is the average brightness and would skew the median
+	sorted := append([]float64(nil), coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for i, c := range coeffs {
+		if c > median {
+			hash |= 1 << uint(63-i)
+		}
+	}
+	return hash
+}
+
+// HammingDistance is the number of bits two hashes differ in.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// FormatHash formats a hash as 16 hex digits.
+func FormatHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// ParseHash parses a hash formatted by FormatHash.
+func ParseHash(s string) (uint64, bool) {
+	if len(s) != 16 {
+		return 0, false
+	}
+	hash, err := strconv.ParseUint(s, 16, 64)
+	return hash, err == nil
+}
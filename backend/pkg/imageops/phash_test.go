@@ -0,0 +1,57 @@
+package imageops
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func noisyImage(seed int64, w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	rng := rand.New(rand.NewSource(seed))
+	// Random blocks so the picture has low-frequency structure
+	for by := 0; by < h; by += h / 8 {
+		for bx := 0; bx < w; bx += w / 8 {
+			c := color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255}
+			for y := by; y < min(by+h/8, h); y++ {
+				for x := bx; x < min(bx+w/8, w); x++ {
+					img.SetRGBA(x, y, c)
+				}
+			}
+		}
+	}
+	return img
+}
+
+func TestPHash_NearDuplicates(t *testing.T) {
+	orig := noisyImage(1, 640, 480)
+	hash := PHash(orig)
+
+	// A smaller JPEG re-encode of the same photo
+	small := Resize(orig, orig.Bounds(), 320, 240)
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, small, &jpeg.Options{Quality: 60}))
+	reencoded, _, err := DecodeBytes(buf.Bytes())
+	require.NoError(t, err)
+	assert.LessOrEqual(t, HammingDistance(hash, PHash(reencoded)), 4)
+
+	// A different photo
+	assert.Greater(t, HammingDistance(hash, PHash(noisyImage(2, 640, 480))), 16)
+}
+
+func TestHash_FormatRoundTrip(t *testing.T) {
+	s := FormatHash(0x00ff00000000beef)
+	assert.Equal(t, "00ff00000000beef", s)
+	hash, ok := ParseHash(s)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0x00ff00000000beef), hash)
+
+	_, ok = ParseHash("")
+	assert.False(t, ok)
+}
@@ -0,0 +1,192 @@
+package imageops
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"sort"
+)
+
+// Cascade is a pico-style face detector: a cascade of pixel-comparison
+// decision trees evaluated on a grayscale image. It reads the binary cascade
+// format of the original pico implementation (e.g. its "facefinder" file).
+type Cascade struct {
+	depth      int
+	codes      []int8    // 4 comparison offsets per node, 2^depth nodes per tree
+	preds      []float32 // 2^depth leaf predictions per tree
+	thresholds []float32 // one rejection threshold per tree
+}
+
+// Face is a detected face in image coordinates.
+type Face struct {
+	Rect  image.Rectangle
+	Score float64
+}
+
+// minFaceScore is the clustered detection score a face needs to count.
+const minFaceScore = 5
+
+// facefinder is the frontal face cascade trained by the pico authors
+// (github.com/nenadmarkus/pico, rnt/cascades/facefinder).
+//
+//go:embed facefinder
+var facefinder []byte
+
+// DefaultCascade returns the built-in frontal face cascade.
+func DefaultCascade() (*Cascade, error) {
+	return ParseCascade(facefinder)
+}
+
+// LoadCascade reads a cascade file.
+func LoadCascade(path string) (*Cascade, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCascade(data)
+}
+
+// ParseCascade decodes a binary pico cascade.
+func ParseCascade(data []byte) (*Cascade, error) {
+	errTruncated := errors.New("truncated cascade")
+	// The first 8 bytes hold the training parameters
+	if len(data) < 16 {
+		return nil, errTruncated
+	}
+	pos := 8
+	depth := int(binary.LittleEndian.Uint32(data[pos:]))
+	trees := int(binary.LittleEndian.Uint32(data[pos+4:]))
+	pos += 8
+	if depth < 1 || depth > 16 || trees < 1 {
+		return nil, fmt.Errorf("invalid cascade: depth %d, %d trees", depth, trees)
+	}
+
+	leaves := 1 << depth
+	c := &Cascade{depth: depth}
+	for t := 0; t < trees; t++ {
+		codeLen := 4*leaves - 4
+		if len(data) < pos+codeLen+4*leaves+4 {
+			return nil, errTruncated
+		}
+		// Node indexes start at 1, so pad the unused slot 0
+		c.codes = append(c.codes, 0, 0, 0, 0)
+		for _, b := range data[pos : pos+codeLen] {
+			c.codes = append(c.codes, int8(b))
+		}
+		pos += codeLen
+		for i := 0; i < leaves; i++ {
+			c.preds = append(c.preds, math.Float32frombits(binary.LittleEndian.Uint32(data[pos:])))
+			pos += 4
+		}
+		c.thresholds = append(c.thresholds, math.Float32frombits(binary.LittleEndian.Uint32(data[pos:])))
+		pos += 4
+	}
+	return c, nil
+}
+
+// classify scores the square region of size s centered at (r, col); negative
+// scores are rejections.
+func (c *Cascade) classify(r, col, s int, gray *image.Gray) float32 {
+	rows, cols := gray.Rect.Dy(), gray.Rect.Dx()
+	at := func(dr, dc int8) uint8 {
+		y := (r*256 + int(dr)*s) >> 8
+		x := (col*256 + int(dc)*s) >> 8
+		y = min(max(y, 0), rows-1)
+		x = min(max(x, 0), cols-1)
+		return gray.Pix[y*gray.Stride+x]
+	}
+
+	leaves := 1 << c.depth
+	var out float32
+	for t := range c.thresholds {
+		codes := c.codes[t*4*leaves:]
+		idx := 1
+		for d := 0; d < c.depth; d++ {
+			node := codes[4*idx:]
+			idx *= 2
+			if at(node[0], node[1]) <= at(node[2], node[3]) {
+				idx++
+			}
+		}
+		out += c.preds[t*leaves+idx-leaves]
+		if out <= c.thresholds[t] {
+			return -1
+		}
+	}
+	return out - c.thresholds[len(c.thresholds)-1]
+}
+
+// Detect scans gray at growing window sizes and returns the faces found,
+// overlapping detections merged.
+func (c *Cascade) Detect(gray *image.Gray, minSize int) []Face {
+	rows, cols := gray.Rect.Dy(), gray.Rect.Dx()
+	maxSize := min(rows, cols)
+
+	var raw []Face
+	for scale := float64(minSize); int(scale) <= maxSize; scale *= 1.1 {
+		s := int(scale)
+		step := max(int(0.1*scale), 1)
+		offset := s/2 + 1
+		for r := offset; r <= rows-offset; r += step {
+			for col := offset; col <= cols-offset; col += step {
+				if q := c.classify(r, col, s, gray); q > 0 {
+					raw = append(raw, Face{
+						Rect:  image.Rect(col-s/2, r-s/2, col-s/2+s, r-s/2+s).Add(gray.Rect.Min),
+						Score: float64(q),
+					})
+				}
+			}
+		}
+	}
+	return clusterFaces(raw)
+}
+
+// clusterFaces merges detections overlapping by more than 20%, averaging
+// their boxes and summing their scores, and drops weak clusters.
+func clusterFaces(raw []Face) []Face {
+	assigned := make([]bool, len(raw))
+	var faces []Face
+	for i := range raw {
+		if assigned[i] {
+			continue
+		}
+		var sx0, sy0, sx1, sy1, score float64
+		n := 0
+		for j := i; j < len(raw); j++ {
+			if assigned[j] || iou(raw[i].Rect, raw[j].Rect) <= 0.2 {
+				continue
+			}
+			assigned[j] = true
+			r := raw[j].Rect
+			sx0 += float64(r.Min.X)
+			sy0 += float64(r.Min.Y)
+			sx1 += float64(r.Max.X)
+			sy1 += float64(r.Max.Y)
+			score += raw[j].Score
+			n++
+		}
+		if score < minFaceScore {
+			continue
+		}
+		fn := float64(n)
+		faces = append(faces, Face{
+			Rect:  image.Rect(int(sx0/fn), int(sy0/fn), int(sx1/fn), int(sy1/fn)),
+			Score: score,
+		})
+	}
+	sort.Slice(faces, func(i, j int) bool { return faces[i].Score > faces[j].Score })
+	return faces
+}
+
+func iou(a, b image.Rectangle) float64 {
+	inter := a.Intersect(b)
+	if inter.Empty() {
+		return 0
+	}
+	ia := float64(inter.Dx() * inter.Dy())
+	return ia / (float64(a.Dx()*a.Dy()+b.Dx()*b.Dy()) - ia)
+}
@@ -0,0 +1,114 @@
+package imageops
+
+import (
+	"image"
+	"math"
+)
+
+// qualitySize is the longest side images are scaled to before measuring, so
+// metrics of thumbnails and full-size photos are comparable.
+const qualitySize = 256
+
+// Quality holds the metrics that predict how a photo survives dithering
+// onto a few-color panel.
+type Quality struct {
+	// Sharpness is the variance of the Laplacian; blurry photos score low.
+	Sharpness float64
+	// Exposure is the mean luminance from 0 (black) to 1 (white).
+	Exposure float64
+	// Colorfulness is the Hasler-Süsstrunk metric: about 0 for grayscale,
+	// 30-50 for typical photos, over 100 for vivid ones.
+	Colorfulness float64
+	// Screenshot is set for screenshots and document scans: large
+	// perfectly flat areas with sharp edges and few distinct tones.
+	Screenshot bool
+}
+
+// MeasureQuality computes the quality metrics of an image.
+func MeasureQuality(img image.Image) Quality {
+	b := img.Bounds()
+	scale := math.Max(float64(b.Dx()), float64(b.Dy())) / qualitySize
+	if scale < 1 {
+		scale = 1
+	}
+	w := max(int(float64(b.Dx())/scale), 1)
+	h := max(int(float64(b.Dy())/scale), 1)
+	rgba := Resize(img, b, w, h)
+
+	lum := make([]float64, w*h)
+	var lumSum float64
+	var rgSum, rgSq, ybSum, ybSq float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p := rgba.Pix[y*rgba.Stride+x*4:]
+			r, g, bl := float64(p[0]), float64(p[1]), float64(p[2])
+			l := 0.299*r + 0.587*g + 0.114*bl
+			lum[y*w+x] = l
+			lumSum += l
+
+			rg := r - g
+			yb := 0.5*(r+g) - bl
+			rgSum += rg
+			rgSq += rg * rg
+			ybSum += yb
+			ybSq += yb * yb
+		}
+	}
+	n := float64(w * h)
+
+	var q Quality
+	q.Exposure = lumSum / n / 255
+
+	rgMean, ybMean := rgSum/n, ybSum/n
+	rgStd := math.Sqrt(math.Max(rgSq/n-rgMean*rgMean, 0))
+	ybStd := math.Sqrt(math.Max(ybSq/n-ybMean*ybMean, 0))
+	q.Colorfulness = math.Hypot(rgStd, ybStd) + 0.3*math.Hypot(rgMean, ybMean)
+
+	if w < 3 || h < 3 {
+		return q
+	}
+
+	// Laplacian variance, and the share of flat pixels and strong edges
+	var lapSum, lapSq float64
+	var flat, edges int
+	var tones [32]int
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			c := lum[i]
+			up, down, left, right := lum[i-w], lum[i+w], lum[i-1], lum[i+1]
+			lap := up + down + left + right - 4*c
+			lapSum += lap
+			lapSq += lap * lap
+
+			spread := math.Max(math.Max(math.Abs(up-c), math.Abs(down-c)), math.Max(math.Abs(left-c), math.Abs(right-c)))
+			switch {
+			case spread < 1.5:
+				flat++
+			case spread > 64:
+				edges++
+			}
+			tones[int(c)/8]++
+		}
+	}
+	inner := float64((w - 2) * (h - 2))
+	lapMean := lapSum / inner
+	q.Sharpness = lapSq/inner - lapMean*lapMean
+
+	// Photos, even of clear skies, have noise and soft gradients; UI and
+	// paper are largely flat fills in a couple of tones, broken by the hard
+	// edges of text
+	top1, top2 := 0, 0
+	for _, count := range tones {
+		switch {
+		case count > top1:
+			top1, top2 = count, top1
+		case count > top2:
+			top2 = count
+		}
+	}
+	q.Screenshot = float64(flat)/inner > 0.3 &&
+		float64(edges)/inner > 0.03 &&
+		float64(top1+top2)/inner > 0.5
+	return q
+}
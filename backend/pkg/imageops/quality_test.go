@@ -0,0 +1,61 @@
+package imageops
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// photoLike is a block image with sensor-like noise.
+func photoLike(seed int64, w, h int) *image.RGBA {
+	img := noisyImage(seed, w, h)
+	rng := rand.New(rand.NewSource(seed))
+	for i := range img.Pix {
+		if i%4 != 3 {
+			img.Pix[i] = uint8(min(max(int(img.Pix[i])+rng.Intn(21)-10, 0), 255))
+		}
+	}
+	return img
+}
+
+func TestMeasureQuality_Sharpness(t *testing.T) {
+	sharp := photoLike(1, 800, 600)
+	// Blur by scaling down and back up
+	blurry := Resize(Resize(sharp, sharp.Bounds(), 80, 60), image.Rect(0, 0, 80, 60), 800, 600)
+
+	assert.Greater(t, MeasureQuality(sharp).Sharpness, 4*MeasureQuality(blurry).Sharpness)
+}
+
+func TestMeasureQuality_ExposureAndColor(t *testing.T) {
+	dark := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(dark, dark.Bounds(), &image.Uniform{C: color.RGBA{10, 12, 8, 255}}, image.Point{}, draw.Src)
+	q := MeasureQuality(dark)
+	assert.Less(t, q.Exposure, 0.1)
+	assert.Less(t, q.Colorfulness, 5.0)
+
+	q = MeasureQuality(photoLike(2, 400, 300))
+	assert.InDelta(t, 0.5, q.Exposure, 0.2)
+	assert.Greater(t, q.Colorfulness, 30.0)
+}
+
+func TestMeasureQuality_Screenshot(t *testing.T) {
+	// White page with a title bar and lines of "text"
+	shot := image.NewRGBA(image.Rect(0, 0, 390, 844))
+	draw.Draw(shot, shot.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(shot, image.Rect(0, 0, 390, 90), &image.Uniform{C: color.RGBA{30, 90, 200, 255}}, image.Point{}, draw.Src)
+	rng := rand.New(rand.NewSource(1))
+	for y := 120; y < 800; y += 28 {
+		for x := 20; x < 370; x += 9 {
+			if rng.Intn(5) > 0 {
+				draw.Draw(shot, image.Rect(x, y, x+6, y+14), &image.Uniform{C: color.Black}, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	assert.True(t, MeasureQuality(shot).Screenshot)
+	assert.False(t, MeasureQuality(photoLike(3, 640, 480)).Screenshot)
+}
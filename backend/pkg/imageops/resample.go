@@ -0,0 +1,129 @@
+package imageops
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Resize scales the crop window of src to w x h. Downscaling averages the
+// source pixels each output pixel covers (area averaging), which keeps fine
+// detail from aliasing into moiré before dithering; upscaling interpolates
+// bilinearly. The work is done on RGBA pixel buffers directly.
+func Resize(src image.Image, crop image.Rectangle, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	crop = crop.Intersect(src.Bounds())
+	if w <= 0 || h <= 0 || crop.Empty() {
+		return dst
+	}
+
+	var in *image.RGBA
+	if rgba, ok := Unwrap(src).(*image.RGBA); ok {
+		in = rgba.SubImage(crop).(*image.RGBA)
+	} else {
+		in = image.NewRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+		draw.Draw(in, in.Bounds(), Unwrap(src), crop.Min, draw.Src)
+	}
+	sw, sh := in.Rect.Dx(), in.Rect.Dy()
+	if sw == w && sh == h {
+		copyRGBA(dst, in)
+		return dst
+	}
+
+	// Horizontal pass into 8.8 fixed point, then the vertical pass
+	xs := contributions(sw, w)
+	tmp := make([]uint16, w*sh*4)
+	for y := 0; y < sh; y++ {
+		row := in.Pix[y*in.Stride:]
+		out := tmp[y*w*4:]
+		for x, c := range xs {
+			var r, g, b, a float32
+			for k, weight := range c.weights {
+				p := (c.start + k) * 4
+				r += float32(row[p]) * weight
+				g += float32(row[p+1]) * weight
+				b += float32(row[p+2]) * weight
+				a += float32(row[p+3]) * weight
+			}
+			out[x*4] = fixed(r)
+			out[x*4+1] = fixed(g)
+			out[x*4+2] = fixed(b)
+			out[x*4+3] = fixed(a)
+		}
+	}
+
+	ys := contributions(sh, h)
+	for y, c := range ys {
+		out := dst.Pix[y*dst.Stride:]
+		for x := 0; x < w; x++ {
+			var r, g, b, a float32
+			for k, weight := range c.weights {
+				p := ((c.start+k)*w + x) * 4
+				r += float32(tmp[p]) * weight
+				g += float32(tmp[p+1]) * weight
+				b += float32(tmp[p+2]) * weight
+				a += float32(tmp[p+3]) * weight
+			}
+			out[x*4] = unfixed(r)
+			out[x*4+1] = unfixed(g)
+			out[x*4+2] = unfixed(b)
+			out[x*4+3] = unfixed(a)
+		}
+	}
+	return dst
+}
+
+// contribution lists the source pixels, from start on, that make up one
+// output pixel and their weights.
+type contribution struct {
+	start   int
+	weights []float32
+}
+
+func contributions(srcLen, dstLen int) []contribution {
+	scale := float64(srcLen) / float64(dstLen)
+	cs := make([]contribution, dstLen)
+	for i := range cs {
+		if scale >= 1 {
+			// Area average over [lo, hi) in source pixels
+			lo := float64(i) * scale
+			hi := lo + scale
+			start := int(lo)
+			end := min(int(math.Ceil(hi)), srcLen)
+			weights := make([]float32, end-start)
+			for j := start; j < end; j++ {
+				overlap := math.Min(hi, float64(j+1)) - math.Max(lo, float64(j))
+				weights[j-start] = float32(overlap / scale)
+			}
+			cs[i] = contribution{start: start, weights: weights}
+			continue
+		}
+		// Bilinear between the two nearest source pixels
+		center := (float64(i)+0.5)*scale - 0.5
+		j := int(math.Floor(center))
+		f := float32(center - float64(j))
+		switch {
+		case j < 0:
+			cs[i] = contribution{start: 0, weights: []float32{1}}
+		case j >= srcLen-1:
+			cs[i] = contribution{start: srcLen - 1, weights: []float32{1}}
+		default:
+			cs[i] = contribution{start: j, weights: []float32{1 - f, f}}
+		}
+	}
+	return cs
+}
+
+func fixed(v float32) uint16 {
+	return uint16(math.Min(float64(v)*256+0.5, 65535))
+}
+
+func unfixed(v float32) uint8 {
+	return uint8(math.Min(float64(v)/256+0.5, 255))
+}
+
+func copyRGBA(dst, src *image.RGBA) {
+	for y := 0; y < src.Rect.Dy(); y++ {
+		copy(dst.Pix[y*dst.Stride:y*dst.Stride+src.Rect.Dx()*4], src.Pix[y*src.Stride:])
+	}
+}
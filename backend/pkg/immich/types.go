@@ -1,5 +1,7 @@
 package immich
 
+import "time"
+
 // Album represents an Immich album
 type Album struct {
 	ID         string `json:"id"`
@@ -9,16 +11,21 @@ type Album struct {
 
 // ExifInfo holds EXIF metadata for an asset
 type ExifInfo struct {
-	ExifImageWidth  int `json:"exifImageWidth"`
-	ExifImageHeight int `json:"exifImageHeight"`
+	ExifImageWidth   int        `json:"exifImageWidth"`
+	ExifImageHeight  int        `json:"exifImageHeight"`
+	Rating           int        `json:"rating"` // 0 when unrated
+	DateTimeOriginal *time.Time `json:"dateTimeOriginal"`
 }
 
 // Asset represents an Immich media asset
 type Asset struct {
-	ID               string   `json:"id"`
-	Type             string   `json:"type"` // "IMAGE", "VIDEO"
-	OriginalFileName string   `json:"originalFileName"`
-	ExifInfo         ExifInfo `json:"exifInfo"`
+	ID               string     `json:"id"`
+	Type             string     `json:"type"` // "IMAGE", "VIDEO"
+	OriginalFileName string     `json:"originalFileName"`
+	OriginalMimeType string     `json:"originalMimeType"`
+	IsFavorite       bool       `json:"isFavorite"`
+	LocalDateTime    *time.Time `json:"localDateTime"` // Capture time in the photo's own timezone, encoded as UTC
+	ExifInfo         ExifInfo   `json:"exifInfo"`
 }
 
 // AlbumDetail is the full album response including assets
@@ -27,3 +34,14 @@ type AlbumDetail struct {
 	AlbumName string  `json:"albumName"`
 	Assets    []Asset `json:"assets"`
 }
+
+// TakenAt returns the capture wall-clock time as UTC, or nil when unknown.
+func (a Asset) TakenAt() *time.Time {
+	if a.LocalDateTime != nil && !a.LocalDateTime.IsZero() {
+		return a.LocalDateTime
+	}
+	if a.ExifInfo.DateTimeOriginal != nil && !a.ExifInfo.DateTimeOriginal.IsZero() {
+		return a.ExifInfo.DateTimeOriginal
+	}
+	return nil
+}
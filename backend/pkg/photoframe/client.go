@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"mime/multipart"
 	"net"
 	"net/http"
+	"net/textproto"
 	"strings"
 	"time"
 )
@@ -43,8 +45,22 @@ func NewClient() *Client {
 	}
 }
 
+// Frame is an encoded frame for the device's display-image API.
+type Frame struct {
+	Data        []byte
+	ContentType string // e.g. "image/png"
+	Filename    string // e.g. "image.png"
+}
+
 // PushImage pushes a PNG image and an optional thumbnail to the device.
 func (c *Client) PushImage(host string, pngBytes []byte, thumbBytes []byte) error {
+	return c.PushFrame(host, Frame{Data: pngBytes, ContentType: "image/png", Filename: "image.png"}, thumbBytes)
+}
+
+// PushFrame pushes a frame in any format the device supports, such as a
+// packed framebuffer, and an optional thumbnail. The frame's CRC32 is sent in
+// the X-Checksum-CRC32 header so the device can verify it before drawing.
+func (c *Client) PushFrame(host string, frame Frame, thumbBytes []byte) error {
 	// Resolve Host to IP manually to bypass HTTP client resolver issues with mDNS
 	ip, err := c.resolveHost(host)
 	if err != nil {
@@ -60,13 +76,16 @@ func (c *Client) PushImage(host string, pngBytes []byte, thumbBytes []byte) erro
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
-	// 1. Add PNG part
-	part, err := writer.CreateFormFile("image", "image.png")
+	// 1. Add frame part
+	partHeader := make(textproto.MIMEHeader)
+	partHeader.Set("Content-Disposition", fmt.Sprintf(`form-data; name="image"; filename="%s"`, frame.Filename))
+	partHeader.Set("Content-Type", frame.ContentType)
+	part, err := writer.CreatePart(partHeader)
 	if err != nil {
 		return fmt.Errorf("failed to create form file: %w", err)
 	}
-	if _, err := io.Copy(part, bytes.NewReader(pngBytes)); err != nil {
-		return fmt.Errorf("failed to copy png bytes: %w", err)
+	if _, err := io.Copy(part, bytes.NewReader(frame.Data)); err != nil {
+		return fmt.Errorf("failed to copy frame bytes: %w", err)
 	}
 
 	// 2. Add Thumbnail part (if available)
@@ -92,6 +111,7 @@ func (c *Client) PushImage(host string, pngBytes []byte, thumbBytes []byte) erro
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-Checksum-CRC32", Checksum(frame.Data))
 	// Set Host header just in case, though usually not needed for direct IP
 	req.Host = host
 
@@ -108,6 +128,12 @@ func (c *Client) PushImage(host string, pngBytes []byte, thumbBytes []byte) erro
 	return nil
 }
 
+// Checksum returns the IEEE CRC32 of data as 8 hex digits, the format of the
+// X-Checksum-CRC32 header.
+func Checksum(data []byte) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE(data))
+}
+
 func (c *Client) resolveHost(host string) (string, error) {
 	// If it's already an IP, return it
 	if net.ParseIP(host) != nil {
@@ -201,21 +227,6 @@ type ProcessingSettings struct {
 	CompressDynamicRange bool    `json:"compressDynamicRange"`
 }
 
-type PaletteColor struct {
-	R int `json:"r"`
-	G int `json:"g"`
-	B int `json:"b"`
-}
-
-type Palette struct {
-	Black  PaletteColor `json:"black"`
-	White  PaletteColor `json:"white"`
-	Yellow PaletteColor `json:"yellow"`
-	Red    PaletteColor `json:"red"`
-	Blue   PaletteColor `json:"blue"`
-	Green  PaletteColor `json:"green"`
-}
-
 func (c *Client) FetchProcessingSettings(host string) (*ProcessingSettings, error) {
 	ip, err := c.resolveHost(host)
 	if err != nil {
@@ -250,6 +261,7 @@ func (c *Client) FetchProcessingSettings(host string) (*ProcessingSettings, erro
 type DeviceConfig struct {
 	DisplayOrientation string `json:"display_orientation"`
 	AccessToken        string `json:"access_token"`
+	RotateInterval     *int   `json:"rotate_interval"` // Seconds between wake-ups, nil when the firmware doesn't report it
 }
 
 func (c *Client) FetchDeviceConfig(host string) (*DeviceConfig, error) {
@@ -0,0 +1,131 @@
+package photoframe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+type PaletteColor struct {
+	R int `json:"r"`
+	G int `json:"g"`
+	B int `json:"b"`
+}
+
+// NamedColor is one ink of a panel, e.g. "black" or "red".
+type NamedColor struct {
+	Name string `json:"name"`
+	PaletteColor
+}
+
+// Palette is a panel's inks in index order, with the colors they show on the
+// panel. Any set of names is allowed: Spectra 6 panels report black, white,
+// yellow, red, blue and green, other panels have fewer (or more) inks.
+//
+// It is encoded as a JSON object keyed by ink name, the form the device
+// reports ({"black": {"r": 2, "g": 2, "b": 2}, ...}), and the key order is
+// the index order. A JSON array of {"name", "r", "g", "b"} is also accepted.
+type Palette struct {
+	Colors []NamedColor
+}
+
+// Get returns the color of the named ink.
+func (p *Palette) Get(name string) (PaletteColor, bool) {
+	for _, c := range p.Colors {
+		if c.Name == name {
+			return c.PaletteColor, true
+		}
+	}
+	return PaletteColor{}, false
+}
+
+// Names returns the ink names in index order.
+func (p *Palette) Names() []string {
+	names := make([]string, len(p.Colors))
+	for i, c := range p.Colors {
+		names[i] = c.Name
+	}
+	return names
+}
+
+func (p Palette) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, c := range p.Colors {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(c.Name)
+		if err != nil {
+			return nil, err
+		}
+		color, err := json.Marshal(c.PaletteColor)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(color)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (p *Palette) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var colors []NamedColor
+		if err := json.Unmarshal(data, &colors); err != nil {
+			return err
+		}
+		p.Colors = colors
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return errors.New("palette must be a JSON object or array")
+	}
+	p.Colors = nil
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		name, _ := tok.(string)
+		var color PaletteColor
+		if err := dec.Decode(&color); err != nil {
+			return fmt.Errorf("invalid color %q: %w", name, err)
+		}
+		p.Colors = append(p.Colors, NamedColor{Name: name, PaletteColor: color})
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// Validate checks that the palette has at least two uniquely named inks with
+// 8-bit color components.
+func (p *Palette) Validate() error {
+	if len(p.Colors) < 2 {
+		return errors.New("palette needs at least two colors")
+	}
+	seen := make(map[string]bool, len(p.Colors))
+	for _, c := range p.Colors {
+		if c.Name == "" {
+			return errors.New("palette colors must be named")
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("duplicate palette color %q", c.Name)
+		}
+		seen[c.Name] = true
+		for _, v := range []int{c.R, c.G, c.B} {
+			if v < 0 || v > 255 {
+				return fmt.Errorf("palette color %q must have components between 0 and 255", c.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -186,7 +186,7 @@ func (c *Client) ListPhotos(offset, limit int, albumID int) ([]Item, error) {
 	params.Set("type", "photo")
 	params.Set("offset", fmt.Sprintf("%d", offset))
 	params.Set("limit", fmt.Sprintf("%d", limit))
-	params.Set("additional", `["thumbnail","resolution"]`)
+	params.Set("additional", `["thumbnail","resolution","rating"]`)
 	if albumID != 0 {
 		params.Set("album_id", fmt.Sprintf("%d", albumID))
 	}
@@ -1,5 +1,7 @@
 package synology
 
+import "time"
+
 type BrowseItemResponse struct {
 	Success bool `json:"success"`
 	Data    struct {
@@ -14,7 +16,7 @@ type Item struct {
 	ID          int    `json:"id"`
 	Filename    string `json:"filename"`
 	Filesize    int    `json:"filesize"`
-	Time        int64  `json:"time"`
+	Time        int64  `json:"time"` // Capture time: local wall clock encoded as a Unix timestamp
 	IndexedTime int64  `json:"indexed_time"`
 	OwnerUserID int    `json:"owner_user_id"`
 	FolderID    int    `json:"folder_id"`
@@ -29,9 +31,19 @@ type Item struct {
 			Width  int `json:"width"`
 			Height int `json:"height"`
 		} `json:"resolution"`
+		Rating int `json:"rating"` // 0-5 stars, 0 when unrated
 	} `json:"additional"`
 }
 
+// TakenAt returns the capture time as UTC, or nil when Synology has none.
+func (i Item) TakenAt() *time.Time {
+	if i.Time <= 0 {
+		return nil
+	}
+	t := time.Unix(i.Time, 0).UTC()
+	return &t
+}
+
 type BrowseAlbumResponse struct {
 	Success bool `json:"success"`
 	Data    struct {
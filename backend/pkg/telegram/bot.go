@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/aitjcize/esp32-photoframe-server/backend/internal/model"
+	"github.com/aitjcize/esp32-photoframe-server/backend/pkg/imageops"
 	tele "gopkg.in/telebot.v3"
 	"gorm.io/gorm"
 )
@@ -67,23 +68,36 @@ func (bot *Bot) registerHandlers() {
 	})
 
 	bot.b.Handle(tele.OnPhoto, bot.handlePhoto)
+	bot.b.Handle(tele.OnDocument, bot.handleDocument)
 }
 
 func (bot *Bot) handlePhoto(c tele.Context) error {
-	// Download photo
-	photo := c.Message().Photo
+	return bot.handleImage(c, &c.Message().Photo.File)
+}
+
+// handleDocument accepts images sent as files, which keeps the original
+// (often HEIC from iPhones) instead of Telegram's recompressed JPEG.
+func (bot *Bot) handleDocument(c tele.Context) error {
+	doc := c.Message().Document
+	if !strings.HasPrefix(doc.MIME, "image/") && imageops.FormatFromName(doc.FileName) == "" {
+		return c.Send("Please send a photo or an image file.")
+	}
+	return bot.handleImage(c, &doc.File)
+}
 
+func (bot *Bot) handleImage(c tele.Context, file *tele.File) error {
 	// Create directory if not exists
 	photosDir := filepath.Join(bot.dataDir, "photos")
 	if err := os.MkdirAll(photosDir, 0755); err != nil {
 		return c.Send("Failed to create photos directory.")
 	}
 
-	// Target file path
+	// Target file path. The content may be any supported format; decoding
+	// sniffs it, so the name stays fixed.
 	destPath := filepath.Join(photosDir, "telegram_last.jpg")
 
 	// Download
-	if err := bot.b.Download(&photo.File, destPath); err != nil {
+	if err := bot.b.Download(file, destPath); err != nil {
 		return c.Send("Failed to download photo: " + err.Error())
 	}
 
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 type Weather struct {
@@ -26,6 +27,45 @@ type HourlyWeather struct {
 	WeatherCode        []int    `json:"weathercode"`
 }
 
+// Forecast is the hourly and daily outlook at a location, in its timezone.
+type Forecast struct {
+	Hourly   []HourlyForecast
+	Daily    []DailyForecast
+	Timezone string
+}
+
+type HourlyForecast struct {
+	Time                     time.Time
+	Temperature              float64
+	WeatherCode              int
+	PrecipitationProbability int // Percent
+}
+
+type DailyForecast struct {
+	Date                     time.Time
+	TemperatureMax           float64
+	TemperatureMin           float64
+	WeatherCode              int
+	PrecipitationProbability int // Highest of the day, percent
+}
+
+type forecastResponse struct {
+	Timezone string `json:"timezone"`
+	Hourly   struct {
+		Time                     []string  `json:"time"`
+		Temperature              []float64 `json:"temperature_2m"`
+		WeatherCode              []int     `json:"weathercode"`
+		PrecipitationProbability []int     `json:"precipitation_probability"`
+	} `json:"hourly"`
+	Daily struct {
+		Time                        []string  `json:"time"`
+		WeatherCode                 []int     `json:"weathercode"`
+		TemperatureMax              []float64 `json:"temperature_2m_max"`
+		TemperatureMin              []float64 `json:"temperature_2m_min"`
+		PrecipitationProbabilityMax []int     `json:"precipitation_probability_max"`
+	} `json:"daily"`
+}
+
 type Client struct {
 	httpClient *http.Client
 }
@@ -89,6 +129,96 @@ func (c *Client) GetWeather(lat, lon string) (*CurrentWeather, error) {
 	return &result.Current, nil
 }
 
+// GetForecast fetches the forecast for the given number of days (1-16)
+// starting today. Hours before the current one are left out.
+func (c *Client) GetForecast(lat, lon string, days int) (*Forecast, error) {
+	days = max(1, min(days, 16))
+	url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%s&longitude=%s&hourly=temperature_2m,weathercode,precipitation_probability&daily=weathercode,temperature_2m_max,temperature_2m_min,precipitation_probability_max&timezone=auto&forecast_days=%d", lat, lon, days)
+
+	resp, err := c.httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("weather api returned status: %d", resp.StatusCode)
+	}
+
+	var result forecastResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return parseForecast(&result, time.Now()), nil
+}
+
+// parseForecast converts the API's local times, which have no offset, in
+// the location's timezone.
+func parseForecast(result *forecastResponse, now time.Time) *Forecast {
+	loc, err := time.LoadLocation(result.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	forecast := &Forecast{Timezone: result.Timezone}
+
+	hour := now.In(loc).Truncate(time.Hour)
+	for i, s := range result.Hourly.Time {
+		t, err := time.ParseInLocation("2006-01-02T15:04", s, loc)
+		if err != nil || t.Before(hour) {
+			continue
+		}
+		h := HourlyForecast{Time: t}
+		if i < len(result.Hourly.Temperature) {
+			h.Temperature = result.Hourly.Temperature[i]
+		}
+		if i < len(result.Hourly.WeatherCode) {
+			h.WeatherCode = result.Hourly.WeatherCode[i]
+		}
+		if i < len(result.Hourly.PrecipitationProbability) {
+			h.PrecipitationProbability = result.Hourly.PrecipitationProbability[i]
+		}
+		forecast.Hourly = append(forecast.Hourly, h)
+	}
+
+	for i, s := range result.Daily.Time {
+		t, err := time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			continue
+		}
+		d := DailyForecast{Date: t}
+		if i < len(result.Daily.TemperatureMax) {
+			d.TemperatureMax = result.Daily.TemperatureMax[i]
+		}
+		if i < len(result.Daily.TemperatureMin) {
+			d.TemperatureMin = result.Daily.TemperatureMin[i]
+		}
+		if i < len(result.Daily.WeatherCode) {
+			d.WeatherCode = result.Daily.WeatherCode[i]
+		}
+		if i < len(result.Daily.PrecipitationProbabilityMax) {
+			d.PrecipitationProbability = result.Daily.PrecipitationProbabilityMax[i]
+		}
+		forecast.Daily = append(forecast.Daily, d)
+	}
+	return forecast
+}
+
+func (f HourlyForecast) Description() string {
+	return CurrentWeather{WeatherCode: f.WeatherCode}.Description()
+}
+
+func (f HourlyForecast) IconName() string {
+	return CurrentWeather{WeatherCode: f.WeatherCode}.IconName()
+}
+
+func (f DailyForecast) Description() string {
+	return CurrentWeather{WeatherCode: f.WeatherCode}.Description()
+}
+
+func (f DailyForecast) IconName() string {
+	return CurrentWeather{WeatherCode: f.WeatherCode}.IconName()
+}
+
 func (c CurrentWeather) Description() string {
 	switch c.WeatherCode {
 	case 0: